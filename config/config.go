@@ -0,0 +1,486 @@
+// Package config loads settings of the server and the storage.
+//
+// Settings are taken (each next source overrides the previous ones):
+//
+//  1. defaults;
+//  2. YAML or JSON file set by -config flag or AURA_CONFIG variable;
+//  3. environment variables AURA_<FLAG NAME> ("-max-data-size" is AURA_MAX_DATA_SIZE);
+//  4. command-line flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/iostrovok/aura-test/jwt"
+	"github.com/iostrovok/aura-test/server"
+	"github.com/iostrovok/aura-test/storage"
+)
+
+const (
+	// EnvPrefix is a prefix of environment variables.
+	EnvPrefix = "AURA_"
+
+	configFlag = "config"
+)
+
+var ErrInvalid = errors.New("invalid config")
+
+// Config is settings of the server and the storage.
+type Config struct {
+	Listen           string        `yaml:"listen"`
+	ShutdownTimeout  time.Duration `yaml:"shutdown_timeout"`
+	MaxBatchSize     int           `yaml:"max_batch_size"`
+	Bunches          uint32        `yaml:"bunches"`
+	DefaultTTL       uint32        `yaml:"default_ttl"`
+	MaxExtendedTTL   uint32        `yaml:"max_extended_ttl"`
+	CleanerIdleDelay time.Duration `yaml:"cleaner_idle_delay"`
+	MaxDataSize      int           `yaml:"max_data_size"`
+	MaxLifetime      uint32        `yaml:"max_lifetime"`
+	MaxSessions      int           `yaml:"max_sessions"`
+	MaxMemory        int64         `yaml:"max_memory"`
+	Eviction         string        `yaml:"eviction"`
+	MaxOwnerSessions int           `yaml:"max_owner_sessions"`
+	SnapshotFile     string        `yaml:"snapshot_file"`
+	SnapshotInterval time.Duration `yaml:"snapshot_interval"`
+	WALFile          string        `yaml:"wal_file"`
+	WALSync          string        `yaml:"wal_sync"`
+	WALSyncInterval  time.Duration `yaml:"wal_sync_interval"`
+	APIKeysFile      string        `yaml:"api_keys_file"`
+	JWKSFile         string        `yaml:"jwks_file"`
+	JWTIssuer        string        `yaml:"jwt_issuer"`
+	JWTAudience      string        `yaml:"jwt_audience"`
+	JWTSubjectScope  bool          `yaml:"jwt_subject_scope"`
+	RateLimitsFile   string        `yaml:"rate_limits_file"`
+
+	// Namespaces are set by the file only
+	Namespaces []NamespaceConfig `yaml:"namespaces"`
+
+	// apiKeys are loaded from APIKeysFile
+	apiKeys []server.APIKey
+	// jwt is the verifier of JWKSFile keys
+	jwt *jwt.Verifier
+	// rateLimits are loaded from RateLimitsFile
+	rateLimits *FileRateLimits
+}
+
+// NamespaceConfig is settings of a namespace. Zero TTLs, empty eviction and unset (nil) limits are taken
+// from the main settings, so a namespace turns off a limit of the main settings by 0.
+type NamespaceConfig struct {
+	Name             string `yaml:"name"`
+	DefaultTTL       uint32 `yaml:"default_ttl"`
+	MaxExtendedTTL   uint32 `yaml:"max_extended_ttl"`
+	MaxSessions      *int   `yaml:"max_sessions"`
+	MaxMemory        *int64 `yaml:"max_memory"`
+	Eviction         string `yaml:"eviction"`
+	MaxOwnerSessions *int   `yaml:"max_owner_sessions"`
+}
+
+// apiKeysFile is a format of the file of API keys.
+type apiKeysFile struct {
+	Keys []struct {
+		Name       string   `yaml:"name"`
+		Key        string   `yaml:"key"`
+		Scopes     []string `yaml:"scopes"`
+		Namespaces []string `yaml:"namespaces"`
+	} `yaml:"keys"`
+}
+
+// Default returns settings by default.
+func Default() *Config {
+	return &Config{
+		Listen:           server.DefaultListen,
+		ShutdownTimeout:  server.DefaultShutdownTimeout,
+		MaxBatchSize:     server.DefaultMaxBatchSize,
+		Bunches:          storage.CountBunches,
+		DefaultTTL:       uint32(server.DefaultTTL),
+		MaxExtendedTTL:   uint32(storage.MaxAllowedExtendedTTL),
+		CleanerIdleDelay: time.Minute,
+		MaxDataSize:      storage.DefaultMaxDataSize,
+		SnapshotInterval: time.Minute,
+		Eviction:         "reject",
+		WALSync:          "batch",
+		WALSyncInterval:  100 * time.Millisecond,
+	}
+}
+
+// Load reads settings from the file, environment variables (by lookupEnv, see os.LookupEnv)
+// and command-line arguments (without the program name) and validates them.
+func Load(name string, args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	path := fs.String(configFlag, "", "YAML or JSON file of settings (env "+envName(configFlag)+")")
+	cfg.flags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// flags are applied at the end, over the file and the environment
+	set := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
+
+	*cfg = *Default()
+
+	if *path == "" {
+		*path, _ = lookupEnv(envName(configFlag))
+	}
+
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := lookupEnv(envName(f.Name))
+		if err != nil || !ok || f.Name == configFlag {
+			return
+		}
+
+		if e := f.Value.Set(value); e != nil {
+			err = fmt.Errorf("%w: %s=%q: %s", ErrInvalid, envName(f.Name), value, e.Error())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range set {
+		if name != configFlag {
+			_ = fs.Lookup(name).Value.Set(value)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.APIKeysFile != "" {
+		if err := cfg.loadAPIKeys(cfg.APIKeysFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.JWKSFile != "" {
+		keys, err := jwt.NewFileKeySet(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: jwks file: %s", ErrInvalid, err.Error())
+		}
+		cfg.jwt = &jwt.Verifier{Keys: keys, Issuer: cfg.JWTIssuer, Audience: cfg.JWTAudience}
+	}
+
+	if cfg.RateLimitsFile != "" {
+		if cfg.rateLimits, err = NewFileRateLimits(cfg.RateLimitsFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// flags binds command-line flags to the settings.
+func (c *Config) flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Listen, "listen", c.Listen, "address of HTTP server")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "time of draining connections on shutdown")
+	fs.IntVar(&c.MaxBatchSize, "max-batch-size", c.MaxBatchSize, "limit of operations of one batch request")
+	fs.Var((*uint32Value)(&c.Bunches), "bunches", "number of bunches (shards) of sessions")
+	fs.Var((*uint32Value)(&c.DefaultTTL), "default-ttl", "TTL of new and extended sessions in seconds")
+	fs.Var((*uint32Value)(&c.MaxExtendedTTL), "max-extended-ttl", "limit of TTL for extending and sliding in seconds")
+	fs.DurationVar(&c.CleanerIdleDelay, "cleaner-idle-delay", c.CleanerIdleDelay, "sleeping time of cleaners of empty bunches")
+	fs.IntVar(&c.MaxDataSize, "max-data-size", c.MaxDataSize, "limit of the session data (in bytes)")
+	fs.Var((*uint32Value)(&c.MaxLifetime), "max-lifetime", "default absolute max lifetime of sessions in seconds (0 - no limit)")
+	fs.IntVar(&c.MaxSessions, "max-sessions", c.MaxSessions, "limit of stored sessions (0 - no limit)")
+	fs.Int64Var(&c.MaxMemory, "max-memory", c.MaxMemory, "limit of estimated memory of sessions in bytes (0 - no limit)")
+	fs.StringVar(&c.Eviction, "eviction", c.Eviction, "behaviour of the full storage: reject, expiring or lru")
+	fs.IntVar(&c.MaxOwnerSessions, "max-owner-sessions", c.MaxOwnerSessions,
+		"limit of sessions of one owner, the oldest ones are evicted (0 - no limit)")
+	fs.StringVar(&c.SnapshotFile, "snapshot-file", c.SnapshotFile, "file for saving sessions between restarts (disabled if empty)")
+	fs.DurationVar(&c.SnapshotInterval, "snapshot-interval", c.SnapshotInterval, "period of saving sessions to the snapshot file")
+	fs.StringVar(&c.WALFile, "wal-file", c.WALFile, "write-ahead log of all changes of sessions (disabled if empty, needs -snapshot-file)")
+	fs.StringVar(&c.WALSync, "wal-sync", c.WALSync, "fsync policy of the write-ahead log: always, batch or never")
+	fs.DurationVar(&c.WALSyncInterval, "wal-sync-interval", c.WALSyncInterval, "period of fsync for \"batch\" policy")
+	fs.StringVar(&c.APIKeysFile, "api-keys-file", c.APIKeysFile, "YAML file of API keys and their scopes (authentication is disabled if empty)")
+	fs.StringVar(&c.JWKSFile, "jwks-file", c.JWKSFile, "JSON web key set for bearer tokens, reloaded on change (JWT is disabled if empty)")
+	fs.StringVar(&c.JWTIssuer, "jwt-issuer", c.JWTIssuer, "expected \"iss\" claim of tokens (any if empty)")
+	fs.StringVar(&c.JWTAudience, "jwt-audience", c.JWTAudience, "expected \"aud\" claim of tokens (any if empty)")
+	fs.BoolVar(&c.JWTSubjectScope, "jwt-subject-scope", c.JWTSubjectScope, "clients with tokens see only sessions of their subject")
+	fs.StringVar(&c.RateLimitsFile, "rate-limits-file", c.RateLimitsFile, "YAML file of rate limits by routes, reloaded on change (disabled if empty)")
+}
+
+// loadFile reads settings from YAML or JSON file. Unknown keys are errors.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("%w: %s: %s", ErrInvalid, path, err.Error())
+	}
+
+	return nil
+}
+
+// loadAPIKeys reads and checks API keys.
+func (c *Config) loadAPIKeys(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	file := &apiKeysFile{}
+	if err := yaml.UnmarshalStrict(data, file); err != nil {
+		return fmt.Errorf("%w: %s: %s", ErrInvalid, path, err.Error())
+	}
+
+	keys := make([]server.APIKey, 0, len(file.Keys))
+	for _, k := range file.Keys {
+		key := server.APIKey{Name: k.Name, Key: k.Key, Namespaces: k.Namespaces}
+		for _, scope := range k.Scopes {
+			key.Scopes = append(key.Scopes, server.Scope(scope))
+		}
+		keys = append(keys, key)
+	}
+
+	if err := server.ValidateAPIKeys(keys); err != nil {
+		return fmt.Errorf("%w: %s: %s", ErrInvalid, path, err.Error())
+	}
+
+	c.apiKeys = keys
+
+	return nil
+}
+
+// Validate checks the settings.
+func (c *Config) Validate() error {
+	switch {
+	case c.Listen == "":
+		return fmt.Errorf("%w: listen is empty", ErrInvalid)
+	case c.ShutdownTimeout <= 0:
+		return fmt.Errorf("%w: shutdown timeout should be positive", ErrInvalid)
+	case c.MaxBatchSize <= 0:
+		return fmt.Errorf("%w: max batch size should be positive", ErrInvalid)
+	case c.Bunches == 0:
+		return fmt.Errorf("%w: bunches should be positive", ErrInvalid)
+	case c.MaxExtendedTTL == 0:
+		return fmt.Errorf("%w: max extended TTL should be positive", ErrInvalid)
+	case c.DefaultTTL == 0 || c.DefaultTTL > c.MaxExtendedTTL:
+		return fmt.Errorf("%w: default TTL should be between 1 and max extended TTL (%d)", ErrInvalid, c.MaxExtendedTTL)
+	case c.CleanerIdleDelay <= 0:
+		return fmt.Errorf("%w: cleaner idle delay should be positive", ErrInvalid)
+	case c.MaxDataSize <= 0:
+		return fmt.Errorf("%w: max data size should be positive", ErrInvalid)
+	case c.SnapshotInterval < 0:
+		return fmt.Errorf("%w: snapshot interval is negative", ErrInvalid)
+	case c.WALSyncInterval < 0:
+		return fmt.Errorf("%w: WAL sync interval is negative", ErrInvalid)
+	case c.WALFile != "" && c.SnapshotFile == "":
+		return fmt.Errorf("%w: WAL file needs snapshot file, the log is compacted by snapshots only", ErrInvalid)
+	case c.MaxSessions < 0 || c.MaxMemory < 0 || c.MaxOwnerSessions < 0:
+		return fmt.Errorf("%w: max sessions, max memory and max owner sessions should not be negative", ErrInvalid)
+	}
+
+	if _, err := storage.ParseEvictionPolicy(c.Eviction); err != nil {
+		return fmt.Errorf("%w: eviction %q: %s", ErrInvalid, c.Eviction, err.Error())
+	}
+
+	if _, err := storage.ParseWALSync(c.WALSync); err != nil {
+		return fmt.Errorf("%w: wal sync %q: %s", ErrInvalid, c.WALSync, err.Error())
+	}
+
+	if err := server.ValidateNamespaces(c.Server().Namespaces); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalid, err.Error())
+	}
+
+	for _, ns := range c.Namespaces {
+		n := c.namespace(ns)
+		switch {
+		case n.DefaultTTL > n.MaxExtendedTTL:
+			return fmt.Errorf("%w: default TTL of namespace %q should not be greater then its max extended TTL (%d)",
+				ErrInvalid, ns.Name, n.MaxExtendedTTL)
+		case *n.MaxSessions < 0 || *n.MaxMemory < 0 || *n.MaxOwnerSessions < 0:
+			return fmt.Errorf("%w: max sessions, max memory and max owner sessions of namespace %q should not be negative",
+				ErrInvalid, ns.Name)
+		}
+
+		if _, err := storage.ParseEvictionPolicy(n.Eviction); err != nil {
+			return fmt.Errorf("%w: eviction %q of namespace %q: %s", ErrInvalid, n.Eviction, ns.Name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// namespace returns settings of the namespace with values of the main settings instead of zeros and nils.
+// Limits of the result are never nil.
+func (c *Config) namespace(ns NamespaceConfig) NamespaceConfig {
+	if ns.DefaultTTL == 0 {
+		ns.DefaultTTL = c.DefaultTTL
+	}
+
+	if ns.MaxExtendedTTL == 0 {
+		ns.MaxExtendedTTL = c.MaxExtendedTTL
+	}
+
+	if ns.MaxSessions == nil {
+		maxSessions := c.MaxSessions
+		ns.MaxSessions = &maxSessions
+	}
+
+	if ns.MaxMemory == nil {
+		maxMemory := c.MaxMemory
+		ns.MaxMemory = &maxMemory
+	}
+
+	if ns.Eviction == "" {
+		ns.Eviction = c.Eviction
+	}
+
+	if ns.MaxOwnerSessions == nil {
+		maxOwnerSessions := c.MaxOwnerSessions
+		ns.MaxOwnerSessions = &maxOwnerSessions
+	}
+
+	return ns
+}
+
+// Server returns settings of HTTP server.
+func (c *Config) Server() server.Config {
+	cfg := server.Config{
+		Listen:         c.Listen,
+		DefaultTTL:     int64(c.DefaultTTL),
+		MaxExtendedTTL: int64(c.MaxExtendedTTL),
+
+		ShutdownTimeout: c.ShutdownTimeout,
+
+		APIKeys: c.apiKeys,
+
+		JWT:             c.jwt,
+		JWTSubjectScope: c.JWTSubjectScope,
+
+		Namespaces: c.serverNamespaces(),
+
+		MaxBatchSize: c.MaxBatchSize,
+	}
+
+	if c.rateLimits != nil {
+		cfg.RateLimits = c.rateLimits
+	}
+
+	return cfg
+}
+
+// serverNamespaces returns namespaces of HTTP server without stores, see NamespaceStorageOptions.
+func (c *Config) serverNamespaces() []server.Namespace {
+	var out []server.Namespace
+	for _, ns := range c.Namespaces {
+		ns = c.namespace(ns)
+		out = append(out, server.Namespace{
+			Name:           ns.Name,
+			DefaultTTL:     int64(ns.DefaultTTL),
+			MaxExtendedTTL: int64(ns.MaxExtendedTTL),
+		})
+	}
+
+	return out
+}
+
+// StorageOptions returns options of storage.New. The settings should be valid.
+func (c *Config) StorageOptions() []storage.Option {
+	opts := []storage.Option{
+		storage.WithBunches(c.Bunches),
+		storage.WithMaxExtendedTTL(c.MaxExtendedTTL),
+		storage.WithCleanerIdleDelay(c.CleanerIdleDelay),
+		storage.WithMaxDataSize(c.MaxDataSize),
+		storage.WithMaxLifetime(c.MaxLifetime),
+	}
+
+	if c.MaxSessions > 0 || c.MaxMemory > 0 {
+		policy, _ := storage.ParseEvictionPolicy(c.Eviction)
+		opts = append(opts,
+			storage.WithMaxSessions(c.MaxSessions),
+			storage.WithMaxMemory(c.MaxMemory),
+			storage.WithEviction(policy),
+		)
+	}
+
+	if c.MaxOwnerSessions > 0 {
+		opts = append(opts, storage.WithMaxOwnerSessions(c.MaxOwnerSessions))
+	}
+
+	if c.SnapshotFile != "" {
+		opts = append(opts, storage.WithSnapshot(c.SnapshotFile, c.SnapshotInterval))
+	}
+
+	if c.WALFile != "" {
+		policy, _ := storage.ParseWALSync(c.WALSync)
+		opts = append(opts, storage.WithWAL(c.WALFile, policy, c.WALSyncInterval))
+	}
+
+	return opts
+}
+
+// NamespaceStorageOptions returns options of storage.New for the namespace. The snapshot and the write-ahead log
+// of the namespace are the files of the main settings with ".<name>" suffix.
+func (c *Config) NamespaceStorageOptions(name string) []storage.Option {
+	for _, ns := range c.Namespaces {
+		if ns.Name != name {
+			continue
+		}
+
+		ns = c.namespace(ns)
+		nc := *c
+		nc.MaxExtendedTTL = ns.MaxExtendedTTL
+		nc.MaxSessions, nc.MaxMemory, nc.Eviction = *ns.MaxSessions, *ns.MaxMemory, ns.Eviction
+		nc.MaxOwnerSessions = *ns.MaxOwnerSessions
+		if nc.SnapshotFile != "" {
+			nc.SnapshotFile += "." + name
+		}
+		if nc.WALFile != "" {
+			nc.WALFile += "." + name
+		}
+
+		return nc.StorageOptions()
+	}
+
+	return nil
+}
+
+// envName converts name of flag to name of environment variable.
+func envName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// uint32Value is flag.Value for uint32.
+type uint32Value uint32
+
+func (v *uint32Value) Set(s string) error {
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return err
+	}
+
+	*v = uint32Value(n)
+
+	return nil
+}
+
+func (v *uint32Value) String() string {
+	if v == nil {
+		return "0"
+	}
+
+	return strconv.FormatUint(uint64(*v), 10)
+}
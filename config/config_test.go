@@ -0,0 +1,228 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/iostrovok/check"
+
+	"github.com/iostrovok/aura-test/server"
+)
+
+type testSuite struct{}
+
+var _ = Suite(&testSuite{})
+
+func TestConfig(t *testing.T) { TestingT(t) }
+
+// helper.
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+
+		return value, ok
+	}
+}
+
+// helper.
+func writeFile(c *C, name, data string) string {
+	path := filepath.Join(c.MkDir(), name)
+	c.Assert(os.WriteFile(path, []byte(data), 0o600), IsNil)
+
+	return path
+}
+
+func (s *testSuite) TestDefault(c *C) {
+	cfg, err := Load("aura", nil, env(nil))
+	c.Assert(err, IsNil)
+	c.Assert(cfg, DeepEquals, Default())
+	c.Assert(cfg.Server(), DeepEquals, server.DefaultConfig())
+	c.Assert(cfg.StorageOptions(), HasLen, 5)
+}
+
+func (s *testSuite) TestFile(c *C) {
+	path := writeFile(c, "aura.yaml", `
+listen: ":9090"
+bunches: 16
+default_ttl: 60
+max_extended_ttl: 600
+snapshot_file: sessions.snapshot
+snapshot_interval: 30s
+`)
+
+	cfg, err := Load("aura", []string{"-config", path}, env(nil))
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Listen, Equals, ":9090")
+	c.Assert(cfg.Bunches, Equals, uint32(16))
+	c.Assert(cfg.DefaultTTL, Equals, uint32(60))
+	c.Assert(cfg.MaxExtendedTTL, Equals, uint32(600))
+	c.Assert(cfg.SnapshotInterval, Equals, 30*time.Second)
+	c.Assert(cfg.StorageOptions(), HasLen, 6)
+
+	// JSON is read by the same way
+	path = writeFile(c, "aura.json", `{"bunches": 8, "snapshot_file": "sessions.snapshot", "wal_file": "sessions.wal", "wal_sync": "always"}`)
+	cfg, err = Load("aura", nil, env(map[string]string{"AURA_CONFIG": path}))
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Bunches, Equals, uint32(8))
+	c.Assert(cfg.WALSync, Equals, "always")
+	c.Assert(cfg.StorageOptions(), HasLen, 7)
+}
+
+func (s *testSuite) TestPrecedence(c *C) {
+	path := writeFile(c, "aura.yaml", "bunches: 16\ndefault_ttl: 60\nmax_data_size: 100\n")
+
+	cfg, err := Load("aura",
+		[]string{"-config", path, "-default-ttl", "90"},
+		env(map[string]string{"AURA_DEFAULT_TTL": "70", "AURA_MAX_DATA_SIZE": "200"}),
+	)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Bunches, Equals, uint32(16))    // file
+	c.Assert(cfg.MaxDataSize, Equals, 200)       // env over file
+	c.Assert(cfg.DefaultTTL, Equals, uint32(90)) // flag over env and file
+}
+
+func (s *testSuite) TestValidate(c *C) {
+	for _, args := range [][]string{
+		{"-bunches", "0"},
+		{"-default-ttl", "301"},
+		{"-max-extended-ttl", "0"},
+		{"-wal-sync", "sometimes"},
+		{"-snapshot-interval", "-1s"},
+		{"-listen", ""},
+		{"-shutdown-timeout", "0s"},
+		{"-max-batch-size", "0"},
+		{"-max-sessions", "-1"},
+		{"-eviction", "random"},
+		{"-max-owner-sessions", "-1"},
+		{"-wal-file", "sessions.wal"},
+	} {
+		_, err := Load("aura", args, env(nil))
+		c.Assert(errors.Is(err, ErrInvalid), Equals, true, Commentf("%v", args))
+	}
+
+	_, err := Load("aura", nil, env(map[string]string{"AURA_BUNCHES": "many"}))
+	c.Assert(errors.Is(err, ErrInvalid), Equals, true)
+
+	_, err = Load("aura", []string{"-config", writeFile(c, "aura.yaml", "bunchez: 10\n")}, env(nil))
+	c.Assert(errors.Is(err, ErrInvalid), Equals, true)
+
+	_, err = Load("aura", []string{"-config", filepath.Join(c.MkDir(), "nothing.yaml")}, env(nil))
+	c.Assert(err, NotNil)
+}
+
+func (s *testSuite) TestAPIKeys(c *C) {
+	path := writeFile(c, "keys.yaml", `
+keys:
+  - name: admin
+    key: secret
+    scopes: [admin]
+  - name: reader
+    key: other
+    scopes: [read]
+`)
+
+	cfg, err := Load("aura", nil, env(map[string]string{"AURA_API_KEYS_FILE": path}))
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Server().APIKeys, DeepEquals, []server.APIKey{
+		{Name: "admin", Key: "secret", Scopes: []server.Scope{server.ScopeAdmin}},
+		{Name: "reader", Key: "other", Scopes: []server.Scope{server.ScopeRead}},
+	})
+
+	path = writeFile(c, "keys.yaml", "keys:\n  - name: admin\n    key: secret\n    scopes: [root]\n")
+	_, err = Load("aura", []string{"-api-keys-file", path}, env(nil))
+	c.Assert(errors.Is(err, ErrInvalid), Equals, true)
+}
+
+func (s *testSuite) TestJWKS(c *C) {
+	path := writeFile(c, "jwks.json", `{"keys": [{"kty": "oct", "kid": "one", "k": "c2VjcmV0"}]}`)
+
+	cfg, err := Load("aura", []string{"-jwks-file", path, "-jwt-issuer", "auth", "-jwt-subject-scope"}, env(nil))
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Server().JWT, NotNil)
+	c.Assert(cfg.Server().JWT.Issuer, Equals, "auth")
+	c.Assert(cfg.Server().JWT.Keys.KeySet().Len(), Equals, 1)
+	c.Assert(cfg.Server().JWTSubjectScope, Equals, true)
+
+	cfg, err = Load("aura", nil, env(nil))
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Server().JWT, IsNil)
+
+	path = writeFile(c, "jwks.json", `{"keys": [{"kty": "oct"}]}`)
+	_, err = Load("aura", []string{"-jwks-file", path}, env(nil))
+	c.Assert(errors.Is(err, ErrInvalid), Equals, true)
+}
+
+func (s *testSuite) TestNamespaces(c *C) {
+	path := writeFile(c, "aura.yaml", `
+default_ttl: 60
+snapshot_file: sessions.snapshot
+namespaces:
+  - name: team-a
+    default_ttl: 100
+    max_extended_ttl: 1000
+    max_sessions: 5000
+  - name: team-b
+`)
+
+	cfg, err := Load("aura", []string{"-config", path}, env(nil))
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Server().Namespaces, DeepEquals, []server.Namespace{
+		{Name: "team-a", DefaultTTL: 100, MaxExtendedTTL: 1000},
+		{Name: "team-b", DefaultTTL: 60, MaxExtendedTTL: 300},
+	})
+	c.Assert(cfg.NamespaceStorageOptions("team-a"), HasLen, 9) // with snapshot and capacity
+	c.Assert(cfg.NamespaceStorageOptions("team-c"), IsNil)
+
+	for _, data := range []string{
+		"namespaces:\n  - name: Team\n",
+		"namespaces:\n  - name: default\n",
+		"namespaces:\n  - name: a\n  - name: a\n",
+		"namespaces:\n  - name: a\n    default_ttl: 500\n",
+		"namespaces:\n  - name: a\n    max_sessions: -1\n",
+		"namespaces:\n  - name: a\n    eviction: random\n",
+	} {
+		_, err = Load("aura", []string{"-config", writeFile(c, "aura.yaml", data)}, env(nil))
+		c.Assert(errors.Is(err, ErrInvalid), Equals, true, Commentf(data))
+	}
+}
+
+func (s *testSuite) TestCapacity(c *C) {
+	cfg, err := Load("aura", []string{"-max-sessions", "1000", "-eviction", "lru"}, env(map[string]string{"AURA_MAX_MEMORY": "1048576"}))
+	c.Assert(err, IsNil)
+	c.Assert(cfg.MaxSessions, Equals, 1000)
+	c.Assert(cfg.MaxMemory, Equals, int64(1048576))
+	c.Assert(cfg.StorageOptions(), HasLen, 8)
+
+	// namespaces take the capacity of the main settings
+	maxSessions := 10
+	cfg.Namespaces = []NamespaceConfig{{Name: "a"}, {Name: "b", MaxSessions: &maxSessions, Eviction: "reject"}}
+	c.Assert(cfg.Validate(), IsNil)
+	c.Assert(*cfg.namespace(cfg.Namespaces[0]).MaxSessions, Equals, 1000)
+	c.Assert(*cfg.namespace(cfg.Namespaces[0]).MaxMemory, Equals, int64(1048576))
+	c.Assert(cfg.namespace(cfg.Namespaces[0]).Eviction, Equals, "lru")
+	c.Assert(*cfg.namespace(cfg.Namespaces[1]).MaxSessions, Equals, 10)
+
+	// zero turns off the limit of the main settings
+	path := writeFile(c, "aura.yaml", "max_sessions: 1000\nnamespaces:\n  - name: a\n    max_sessions: 0\n  - name: b\n")
+	cfg, err = Load("aura", []string{"-config", path}, env(nil))
+	c.Assert(err, IsNil)
+	c.Assert(cfg.NamespaceStorageOptions("a"), HasLen, 5) // without capacity
+	c.Assert(cfg.NamespaceStorageOptions("b"), HasLen, 8)
+}
+
+func (s *testSuite) TestMaxOwnerSessions(c *C) {
+	cfg, err := Load("aura", []string{"-max-owner-sessions", "5"}, env(nil))
+	c.Assert(err, IsNil)
+	c.Assert(cfg.MaxOwnerSessions, Equals, 5)
+	c.Assert(cfg.StorageOptions(), HasLen, 6)
+
+	one, zero := 1, 0
+	cfg.Namespaces = []NamespaceConfig{{Name: "a"}, {Name: "b", MaxOwnerSessions: &one}, {Name: "c", MaxOwnerSessions: &zero}}
+	c.Assert(cfg.Validate(), IsNil)
+	c.Assert(*cfg.namespace(cfg.Namespaces[0]).MaxOwnerSessions, Equals, 5)
+	c.Assert(*cfg.namespace(cfg.Namespaces[1]).MaxOwnerSessions, Equals, 1)
+	c.Assert(cfg.NamespaceStorageOptions("c"), HasLen, 5)
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/iostrovok/aura-test/filewatch"
+	"github.com/iostrovok/aura-test/server"
+)
+
+// DefaultRateLimitsReload is a default period of checking the rate limits file for changes.
+const DefaultRateLimitsReload = 5 * time.Second
+
+// rateLimitsFile is a format of the file of rate limits: route => limit.
+type rateLimitsFile map[string]struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// FileRateLimits is server.RateLimitSource of the YAML file, so limits are tuned without restarts.
+// The file is polled on requests at most once per ReloadInterval.
+// Limits of a changed file are validated as a whole, an invalid file keeps the previous limits.
+type FileRateLimits struct {
+	ReloadInterval time.Duration
+
+	file *filewatch.File
+}
+
+// NewFileRateLimits loads rate limits from the file.
+func NewFileRateLimits(path string) (*FileRateLimits, error) {
+	return newFileRateLimits(path, time.Now)
+}
+
+func newFileRateLimits(path string, now func() time.Time) (*FileRateLimits, error) {
+	file, err := filewatch.New("rate limits", path, func(data []byte) (interface{}, error) {
+		limits, err := parseRateLimits(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrInvalid, path, err.Error())
+		}
+
+		return limits, nil
+	}, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileRateLimits{ReloadInterval: DefaultRateLimitsReload, file: file}, nil
+}
+
+// RateLimits returns the current limits.
+// The map is replaced on reloads, never changed, so it's safe to use it without locks.
+func (f *FileRateLimits) RateLimits() server.RateLimits {
+	return f.file.Value(f.ReloadInterval).(server.RateLimits)
+}
+
+func parseRateLimits(data []byte) (server.RateLimits, error) {
+	file := rateLimitsFile{}
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, err
+	}
+
+	limits := make(server.RateLimits, len(file))
+	for route, l := range file {
+		limits[route] = server.RateLimit{Rate: l.Rate, Burst: l.Burst}
+	}
+
+	if err := server.ValidateRateLimits(limits); err != nil {
+		return nil, err
+	}
+
+	return limits, nil
+}
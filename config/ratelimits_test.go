@@ -0,0 +1,51 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	. "github.com/iostrovok/check"
+
+	"github.com/iostrovok/aura-test/server"
+)
+
+func (s *testSuite) TestRateLimits(c *C) {
+	path := writeFile(c, "limits.yaml", "create: {rate: 10, burst: 20}\n")
+
+	cfg, err := Load("aura", []string{"-rate-limits-file", path}, env(nil))
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Server().RateLimits.RateLimits(), DeepEquals, server.RateLimits{
+		server.RouteCreate: {Rate: 10, Burst: 20},
+	})
+
+	cfg, err = Load("aura", nil, env(nil))
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Server().RateLimits, IsNil)
+
+	for _, data := range []string{"sessions: {rate: 1}\n", "create: {rate: 0}\n", "create: {speed: 1}\n"} {
+		_, err = Load("aura", []string{"-rate-limits-file", writeFile(c, "limits.yaml", data)}, env(nil))
+		c.Assert(errors.Is(err, ErrInvalid), Equals, true, Commentf(data))
+	}
+}
+
+func (s *testSuite) TestFileRateLimits(c *C) {
+	path := writeFile(c, "limits.yaml", "create: {rate: 10}\n")
+
+	now := time.Unix(1600000000, 0)
+	limits, err := newFileRateLimits(path, func() time.Time { return now })
+	c.Assert(err, IsNil)
+	c.Assert(limits.RateLimits(), HasLen, 1)
+
+	// the file is changed, it's reloaded after the interval
+	c.Assert(os.WriteFile(path, []byte("create: {rate: 10}\nlist: {rate: 1, burst: 5}\n"), 0o600), IsNil)
+	c.Assert(limits.RateLimits(), HasLen, 1)
+
+	now = now.Add(DefaultRateLimitsReload)
+	c.Assert(limits.RateLimits(), HasLen, 2)
+
+	// the wrong file is not loaded
+	c.Assert(os.WriteFile(path, []byte("list: {rate: -1}\n"), 0o600), IsNil)
+	now = now.Add(DefaultRateLimitsReload)
+	c.Assert(limits.RateLimits()[server.RouteList], Equals, server.RateLimit{Rate: 1, Burst: 5})
+}
@@ -25,5 +25,8 @@ func main() {
 	code, err = helpers.DestroySession(client, id)
 	fmt.Printf("code: %d, err: %+v\n", code, err)
 
+	codes, err := helpers.DestroySessions(client, []string{helpers.CreateSession(client), helpers.CreateSession(client)})
+	fmt.Printf("codes: %v, err: %+v\n", codes, err)
+
 	helpers.List()
 }
@@ -1,6 +1,8 @@
 package helpers
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -58,17 +60,57 @@ func DestroySession(client *http.Client, id string) (int, error) {
 	}
 
 	resp, err := client.Do(req)
-	defer resp.Body.Close()
-
 	if err != nil {
 		logrus.Errorf("err: %s\n", err.Error())
 
 		return 0, err
 	}
+	defer resp.Body.Close()
 
 	return resp.StatusCode, nil
 }
 
+// DestroySessions destroys sessions by one batch request and returns statuses of sessions.
+func DestroySessions(client *http.Client, ids []string) ([]int, error) {
+	ops := make([]map[string]string, 0, len(ids))
+	for _, id := range ids {
+		ops = append(ops, map[string]string{"op": "destroy", "id": id})
+	}
+
+	body, err := json.Marshal(ops)
+	if err != nil {
+		logrus.Errorf("err: %s\n", err.Error())
+
+		return nil, err
+	}
+
+	resp, err := client.Post(host+"/sessions:batch", "application/json", bytes.NewReader(body))
+	if err != nil {
+		logrus.Errorf("err: %s\n", err.Error())
+
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("batch request: status %d", resp.StatusCode)
+	}
+
+	items := make([]response.BatchItem, 0)
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		logrus.Errorf("err: %s\n", err.Error())
+
+		return nil, err
+	}
+
+	out := make([]int, 0, len(items))
+	for _, item := range items {
+		out = append(out, item.Status)
+	}
+
+	return out, nil
+}
+
 func CreateSession(client *http.Client) string {
 	req, err := http.NewRequest(http.MethodPost, host+"/sessions", nil)
 	if err != nil {
@@ -78,12 +120,12 @@ func CreateSession(client *http.Client) string {
 	}
 
 	resp, err := client.Do(req)
-	defer resp.Body.Close()
 	if err != nil {
 		logrus.Errorf("err: %s\n", err.Error())
 
 		return ""
 	}
+	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -0,0 +1,93 @@
+// Package filewatch keeps values parsed from files and reloads them when the files are changed.
+package filewatch
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Parse parses the content of the file.
+type Parse func(data []byte) (interface{}, error)
+
+// File is a value of the file which is reloaded when the file is changed.
+// The file is stat'ed on use but no more then once per the interval given to Value,
+// it's parsed again only if its modification time or size differ.
+// If the changed file can't be parsed, the previous value is kept.
+type File struct {
+	name  string
+	path  string
+	parse Parse
+	now   func() time.Time
+
+	mu      sync.Mutex
+	value   interface{}
+	modTime time.Time
+	size    int64
+	checked time.Time
+}
+
+// New loads the value of the file, name is used in logs.
+func New(name, path string, parse Parse, now func() time.Time) (*File, error) {
+	f := &File{name: name, path: path, parse: parse, now: now}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.load(info); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Value returns the current value, the file is checked if interval is passed since the previous check.
+func (f *File) Value(interval time.Duration) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	if now.Sub(f.checked) < interval {
+		return f.value
+	}
+	f.checked = now
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		logrus.Errorf("%s %s: %s", f.name, f.path, err.Error())
+
+		return f.value
+	}
+
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.value
+	}
+
+	if err := f.load(info); err != nil {
+		logrus.Errorf("%s %s is not reloaded: %s", f.name, f.path, err.Error())
+	} else {
+		logrus.Infof("%s %s is reloaded", f.name, f.path)
+	}
+
+	return f.value
+}
+
+func (f *File) load(info os.FileInfo) error {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	value, err := f.parse(data)
+	if err != nil {
+		return err
+	}
+
+	f.value, f.modTime, f.size, f.checked = value, info.ModTime(), info.Size(), f.now()
+
+	return nil
+}
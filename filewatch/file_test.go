@@ -0,0 +1,54 @@
+package filewatch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/iostrovok/check"
+)
+
+type testSuite struct{}
+
+var _ = Suite(&testSuite{})
+
+func TestFileWatch(t *testing.T) { TestingT(t) }
+
+func parseText(data []byte) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty")
+	}
+
+	return string(data), nil
+}
+
+func (s *testSuite) TestFile(c *C) {
+	path := filepath.Join(c.MkDir(), "value.txt")
+	c.Assert(os.WriteFile(path, []byte("first"), 0o600), IsNil)
+
+	now := time.Unix(1600000000, 0)
+	f, err := New("text", path, parseText, func() time.Time { return now })
+	c.Assert(err, IsNil)
+	c.Assert(f.Value(time.Second), Equals, "first")
+
+	// the file is changed, it's reloaded after the interval
+	c.Assert(os.WriteFile(path, []byte("second"), 0o600), IsNil)
+	c.Assert(f.Value(time.Second), Equals, "first")
+
+	now = now.Add(time.Second)
+	c.Assert(f.Value(time.Second), Equals, "second")
+
+	// the wrong or removed file keeps the previous value
+	c.Assert(os.WriteFile(path, nil, 0o600), IsNil)
+	now = now.Add(time.Second)
+	c.Assert(f.Value(time.Second), Equals, "second")
+
+	c.Assert(os.Remove(path), IsNil)
+	now = now.Add(time.Second)
+	c.Assert(f.Value(time.Second), Equals, "second")
+
+	_, err = New("text", path, parseText, time.Now)
+	c.Assert(err, NotNil)
+}
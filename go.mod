@@ -7,6 +7,8 @@ require (
 	github.com/google/uuid v1.1.2
 	github.com/iostrovok/check v0.0.7
 	github.com/json-iterator/go v1.1.11
+	github.com/prometheus/client_golang v1.10.0
 	github.com/sirupsen/logrus v1.8.1
-	github.com/stretchr/testify v1.5.1 // indirect
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,200 @@
+// Package jwt validates JSON Web Tokens signed by HS256, RS256 or ES256 against a local JSON Web Key Set.
+//
+// Only the algorithm of the key type is accepted (HS256 - "oct", RS256 - "RSA", ES256 - "EC" P-256),
+// so a token can't switch the algorithm of a key. Tokens without "exp" claim are rejected.
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/iostrovok/aura-test/filewatch"
+)
+
+// Algorithms of tokens.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// DefaultReloadInterval is a default period of checking the key set file for changes.
+const DefaultReloadInterval = 5 * time.Second
+
+var ErrKeySet = errors.New("wrong JSON web key set")
+
+// jwk is a JSON Web Key (RFC 7517) of the supported types.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	K   string `json:"k"`   // oct
+	N   string `json:"n"`   // RSA
+	E   string `json:"e"`   // RSA
+	Crv string `json:"crv"` // EC
+	X   string `json:"x"`   // EC
+	Y   string `json:"y"`   // EC
+}
+
+// Key is a verification key of the key set.
+type Key struct {
+	ID        string
+	Algorithm string
+	key       interface{} // []byte, *rsa.PublicKey or *ecdsa.PublicKey
+}
+
+// KeySet is a parsed key set. It's never changed after parsing.
+type KeySet struct {
+	keys []*Key
+}
+
+// ParseKeySet parses JSON Web Key Set: {"keys": [...]}. Keys for encryption ("use": "enc") are skipped.
+func ParseKeySet(data []byte) (*KeySet, error) {
+	in := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrKeySet, err.Error())
+	}
+
+	set := &KeySet{keys: make([]*Key, 0, len(in.Keys))}
+	for i, k := range in.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.parse()
+		if err != nil {
+			return nil, fmt.Errorf("%w: key #%d (%q): %s", ErrKeySet, i+1, k.Kid, err.Error())
+		}
+		set.keys = append(set.keys, key)
+	}
+
+	return set, nil
+}
+
+// Len returns the number of keys.
+func (s *KeySet) Len() int {
+	return len(s.keys)
+}
+
+// find returns keys of the algorithm with the id (any id if kid is empty).
+func (s *KeySet) find(kid, alg string) []*Key {
+	out := make([]*Key, 0, 1)
+	for _, key := range s.keys {
+		if key.Algorithm == alg && (kid == "" || key.ID == kid) {
+			out = append(out, key)
+		}
+	}
+
+	return out
+}
+
+func (k *jwk) parse() (*Key, error) {
+	key := &Key{ID: k.Kid}
+
+	switch k.Kty {
+	case "oct":
+		secret, err := decodeField("k", k.K)
+		if err != nil {
+			return nil, err
+		}
+		key.Algorithm, key.key = HS256, secret
+	case "RSA":
+		n, err := decodeField("n", k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeField("e", k.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(e) > 4 {
+			return nil, errors.New("RSA exponent is too large")
+		}
+		key.Algorithm = RS256
+		key.key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeField("x", k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeField("y", k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		key.Algorithm, key.key = ES256, pub
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+
+	if k.Alg != "" && k.Alg != key.Algorithm {
+		return nil, fmt.Errorf("algorithm %q doesn't match key type %q", k.Alg, k.Kty)
+	}
+
+	return key, nil
+}
+
+func decodeField(name, value string) ([]byte, error) {
+	out, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(out) == 0 {
+		return nil, fmt.Errorf("wrong %q", name)
+	}
+
+	return out, nil
+}
+
+// KeySource returns the current key set.
+type KeySource interface {
+	KeySet() *KeySet
+}
+
+// KeySet returns the key set itself, so KeySet is KeySource of static keys.
+func (s *KeySet) KeySet() *KeySet {
+	return s
+}
+
+// FileKeySet is a key set of the JWKS file, so keys are rotated by replacing the file without restarts.
+// The file is checked on use but no more then once per ReloadInterval.
+// If the changed file is not a valid key set, the previous keys are kept.
+type FileKeySet struct {
+	ReloadInterval time.Duration
+
+	file *filewatch.File
+}
+
+// NewFileKeySet loads the key set from the file.
+func NewFileKeySet(path string) (*FileKeySet, error) {
+	return newFileKeySet(path, time.Now)
+}
+
+func newFileKeySet(path string, now func() time.Time) (*FileKeySet, error) {
+	file, err := filewatch.New("jwks", path, func(data []byte) (interface{}, error) {
+		return ParseKeySet(data)
+	}, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileKeySet{ReloadInterval: DefaultReloadInterval, file: file}, nil
+}
+
+// KeySet returns the current key set.
+func (f *FileKeySet) KeySet() *KeySet {
+	return f.file.Value(f.ReloadInterval).(*KeySet)
+}
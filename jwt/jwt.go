@@ -0,0 +1,205 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed   = errors.New("malformed token")
+	ErrAlgorithm   = errors.New("unsupported token algorithm")
+	ErrUnknownKey  = errors.New("unknown token key")
+	ErrSignature   = errors.New("wrong token signature")
+	ErrExpired     = errors.New("token is expired")
+	ErrNotYetValid = errors.New("token is not valid yet")
+	ErrIssuer      = errors.New("wrong token issuer")
+	ErrAudience    = errors.New("wrong token audience")
+)
+
+// Claims are registered claims of the token, its scopes and namespaces.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  Audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	Scope     string   `json:"scope"`  // space separated scopes (OAuth 2.0)
+	Scopes    []string `json:"scopes"` // scopes as array
+
+	Namespace  string   `json:"ns"`         // one namespace of the client
+	Namespaces []string `json:"namespaces"` // namespaces as array
+}
+
+// AllScopes returns scopes of "scope" and "scopes" claims.
+func (c *Claims) AllScopes() []string {
+	return append(strings.Fields(c.Scope), c.Scopes...)
+}
+
+// AllNamespaces returns namespaces of "ns" and "namespaces" claims.
+func (c *Claims) AllNamespaces() []string {
+	out := make([]string, 0, len(c.Namespaces)+1)
+	if c.Namespace != "" {
+		out = append(out, c.Namespace)
+	}
+
+	return append(out, c.Namespaces...)
+}
+
+// Audience is "aud" claim which may be a string or an array of strings.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = Audience{one}
+
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+
+	return nil
+}
+
+// Contains checks that the audience has the value.
+func (a Audience) Contains(value string) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Verifier validates tokens.
+type Verifier struct {
+	Keys     KeySource
+	Issuer   string        // expected "iss", any if empty
+	Audience string        // expected value of "aud", any if empty
+	Leeway   time.Duration // allowed clock skew for "exp" and "nbf"
+	Now      func() time.Time
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the signature and the claims of the token and returns the claims.
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	h := header{}
+	if err := decodeJSON(parts[0], &h); err != nil {
+		return nil, ErrMalformed
+	}
+
+	switch h.Alg {
+	case HS256, RS256, ES256:
+	default:
+		return nil, ErrAlgorithm
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	keys := v.Keys.KeySet().find(h.Kid, h.Alg)
+	if len(keys) == 0 {
+		return nil, ErrUnknownKey
+	}
+
+	input := []byte(parts[0] + "." + parts[1])
+	valid := false
+	for _, key := range keys {
+		if verify(key, input, signature) {
+			valid = true
+
+			break
+		}
+	}
+	if !valid {
+		return nil, ErrSignature
+	}
+
+	claims := &Claims{}
+	if err := decodeJSON(parts[1], claims); err != nil {
+		return nil, ErrMalformed
+	}
+
+	return claims, v.check(claims)
+}
+
+// check validates time, issuer and audience of the claims.
+func (v *Verifier) check(c *Claims) error {
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	t := now().Unix()
+	leeway := int64(v.Leeway / time.Second)
+
+	switch {
+	case c.ExpiresAt == 0 || t > c.ExpiresAt+leeway:
+		return ErrExpired
+	case c.NotBefore > 0 && t < c.NotBefore-leeway:
+		return ErrNotYetValid
+	case v.Issuer != "" && c.Issuer != v.Issuer:
+		return ErrIssuer
+	case v.Audience != "" && !c.Audience.Contains(v.Audience):
+		return ErrAudience
+	}
+
+	return nil
+}
+
+func verify(key *Key, input, signature []byte) bool {
+	hash := sha256.Sum256(input)
+
+	switch k := key.key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write(input)
+
+		return hmac.Equal(mac.Sum(nil), signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, hash[:], signature) == nil
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+
+		return ecdsa.Verify(k, hash[:], r, s)
+	}
+
+	return false
+}
+
+func decodeJSON(part string, out interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,213 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/iostrovok/check"
+)
+
+type testSuite struct {
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+	secret []byte
+}
+
+var _ = Suite(&testSuite{})
+
+func TestJWT(t *testing.T) { TestingT(t) }
+
+var testNow = time.Unix(1600000000, 0)
+
+func (s *testSuite) SetUpSuite(c *C) {
+	var err error
+	s.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+	s.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	s.secret = []byte("top secret of the test")
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// helper.
+func (s *testSuite) jwks(c *C) []byte {
+	pad := func(n *big.Int) string {
+		b := make([]byte, 32)
+		return b64(n.FillBytes(b))
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "oct", "kid": "hs", "k": b64(s.secret)},
+		{"kty": "RSA", "kid": "rs", "alg": RS256, "n": b64(s.rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(s.rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "es", "crv": "P-256", "x": pad(s.ecKey.X), "y": pad(s.ecKey.Y)},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQ", "e": "AQ"},
+	}})
+	c.Assert(err, IsNil)
+
+	return data
+}
+
+// helper.
+func (s *testSuite) sign(c *C, alg, kid string, claims map[string]interface{}) string {
+	head, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	c.Assert(err, IsNil)
+	body, err := json.Marshal(claims)
+	c.Assert(err, IsNil)
+
+	input := b64(head) + "." + b64(body)
+	hash := sha256.Sum256([]byte(input))
+
+	var signature []byte
+	switch alg {
+	case HS256:
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write([]byte(input))
+		signature = mac.Sum(nil)
+	case RS256:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, s.rsaKey, crypto.SHA256, hash[:])
+		c.Assert(err, IsNil)
+	case ES256:
+		r, ss, err := ecdsa.Sign(rand.Reader, s.ecKey, hash[:])
+		c.Assert(err, IsNil)
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		ss.FillBytes(signature[32:])
+	}
+
+	return input + "." + b64(signature)
+}
+
+// helper.
+func (s *testSuite) verifier(c *C) *Verifier {
+	keys, err := ParseKeySet(s.jwks(c))
+	c.Assert(err, IsNil)
+	c.Assert(keys.Len(), Equals, 3)
+
+	return &Verifier{Keys: keys, Now: func() time.Time { return testNow }}
+}
+
+func claims(extra map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{"sub": "user-1", "exp": testNow.Unix() + 60, "scope": "read write"}
+	for k, v := range extra {
+		out[k] = v
+	}
+
+	return out
+}
+
+func (s *testSuite) TestVerify(c *C) {
+	v := s.verifier(c)
+
+	for alg, kid := range map[string]string{HS256: "hs", RS256: "rs", ES256: "es"} {
+		out, err := v.Verify(s.sign(c, alg, kid, claims(nil)))
+		c.Assert(err, IsNil, Commentf(alg))
+		c.Assert(out.Subject, Equals, "user-1")
+		c.Assert(out.AllScopes(), DeepEquals, []string{"read", "write"})
+
+		// without kid all keys of the algorithm are tried
+		_, err = v.Verify(s.sign(c, alg, "", claims(nil)))
+		c.Assert(err, IsNil, Commentf(alg))
+	}
+
+	out, err := v.Verify(s.sign(c, HS256, "hs", claims(map[string]interface{}{"scope": nil, "scopes": []string{"admin"}})))
+	c.Assert(err, IsNil)
+	c.Assert(out.AllScopes(), DeepEquals, []string{"admin"})
+	c.Assert(out.AllNamespaces(), HasLen, 0)
+
+	out, err = v.Verify(s.sign(c, HS256, "hs", claims(map[string]interface{}{"ns": "a", "namespaces": []string{"b"}})))
+	c.Assert(err, IsNil)
+	c.Assert(out.AllNamespaces(), DeepEquals, []string{"a", "b"})
+}
+
+func (s *testSuite) TestVerifyErrors(c *C) {
+	v := s.verifier(c)
+	v.Issuer = "auth"
+	v.Audience = "aura"
+	good := map[string]interface{}{"iss": "auth", "aud": []string{"other", "aura"}}
+
+	_, err := v.Verify(s.sign(c, RS256, "rs", claims(good)))
+	c.Assert(err, IsNil)
+
+	token := s.sign(c, RS256, "rs", claims(good))
+	for in, expected := range map[string]error{
+		"abc":                                ErrMalformed,
+		token[:len(token)-4]:                 ErrSignature,
+		s.sign(c, "none", "", nil):           ErrAlgorithm,
+		s.sign(c, RS256, "es", claims(good)): ErrUnknownKey, // the key of other type
+		s.sign(c, HS256, "rs", claims(good)): ErrUnknownKey,
+		s.sign(c, RS256, "rs", claims(map[string]interface{}{"iss": "auth", "aud": "aura", "exp": testNow.Unix() - 1})):  ErrExpired,
+		s.sign(c, RS256, "rs", claims(map[string]interface{}{"iss": "auth", "aud": "aura", "exp": nil})):                 ErrExpired,
+		s.sign(c, RS256, "rs", claims(map[string]interface{}{"iss": "auth", "aud": "aura", "nbf": testNow.Unix() + 10})): ErrNotYetValid,
+		s.sign(c, RS256, "rs", claims(map[string]interface{}{"iss": "other", "aud": "aura"})):                            ErrIssuer,
+		s.sign(c, RS256, "rs", claims(map[string]interface{}{"iss": "auth"})):                                            ErrAudience,
+	} {
+		_, err := v.Verify(in)
+		c.Assert(err, Equals, expected, Commentf(in))
+	}
+
+	// leeway
+	v.Leeway = 10 * time.Second
+	_, err = v.Verify(s.sign(c, RS256, "rs", claims(map[string]interface{}{"iss": "auth", "aud": "aura", "exp": testNow.Unix() - 5})))
+	c.Assert(err, IsNil)
+}
+
+func (s *testSuite) TestParseKeySetErrors(c *C) {
+	for _, data := range []string{
+		`[]`,
+		`{"keys": [{"kty": "oct", "k": ""}]}`,
+		`{"keys": [{"kty": "oct", "k": "c2VjcmV0", "alg": "RS256"}]}`,
+		`{"keys": [{"kty": "EC", "crv": "P-384", "x": "AQ", "y": "AQ"}]}`,
+		`{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`,
+		`{"keys": [{"kty": "OKP"}]}`,
+	} {
+		_, err := ParseKeySet([]byte(data))
+		c.Assert(err, ErrorMatches, ErrKeySet.Error()+".*", Commentf(data))
+	}
+}
+
+func (s *testSuite) TestFileKeySet(c *C) {
+	path := filepath.Join(c.MkDir(), "jwks.json")
+	c.Assert(os.WriteFile(path, []byte(`{"keys": []}`), 0o600), IsNil)
+
+	now := testNow
+	keys, err := newFileKeySet(path, func() time.Time { return now })
+	c.Assert(err, IsNil)
+	v := &Verifier{Keys: keys, Now: func() time.Time { return testNow }}
+
+	token := s.sign(c, HS256, "hs", claims(nil))
+	_, err = v.Verify(token)
+	c.Assert(err, Equals, ErrUnknownKey)
+
+	// the file is changed, it's reloaded after the interval
+	c.Assert(os.WriteFile(path, s.jwks(c), 0o600), IsNil)
+	_, err = v.Verify(token)
+	c.Assert(err, Equals, ErrUnknownKey)
+
+	now = now.Add(DefaultReloadInterval)
+	_, err = v.Verify(token)
+	c.Assert(err, IsNil)
+
+	// the wrong file is not loaded
+	c.Assert(os.WriteFile(path, []byte(`{"keys": [{"kty": "OKP"}]}`), 0o600), IsNil)
+	now = now.Add(DefaultReloadInterval)
+	_, err = v.Verify(token)
+	c.Assert(err, IsNil)
+
+	_, err = NewFileKeySet(filepath.Join(c.MkDir(), "nothing.json"))
+	c.Assert(err, NotNil)
+}
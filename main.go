@@ -2,10 +2,56 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"os"
 
+	"github.com/sirupsen/logrus"
+
+	"github.com/iostrovok/aura-test/config"
 	"github.com/iostrovok/aura-test/server"
+	"github.com/iostrovok/aura-test/storage"
 )
 
 func main() {
-	server.Start(context.Background())
+	cfg, err := config.Load(os.Args[0], os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		logrus.Fatalf("config: %s", err.Error())
+	}
+
+	ctx := context.Background()
+	keeper := storage.New(ctx, cfg.StorageOptions()...)
+	stores := []*storage.Storage{keeper}
+
+	// each namespace has its own storage
+	srvCfg := cfg.Server()
+	for i := range srvCfg.Namespaces {
+		store := storage.New(ctx, cfg.NamespaceStorageOptions(srvCfg.Namespaces[i].Name)...)
+		srvCfg.Namespaces[i].Store = store
+		stores = append(stores, store)
+	}
+
+	// it returns on SIGINT/SIGTERM after draining of connections
+	serverErr := server.StartWithStore(ctx, keeper, srvCfg)
+
+	// stop cleaners, save snapshots and flush logs
+	closeErr := false
+	for _, store := range stores {
+		if err := store.Close(); err != nil {
+			logrus.Errorf("storage is closed with error: %s", err.Error())
+			closeErr = true
+		}
+	}
+	if closeErr {
+		logrus.Fatalf("storage is not closed properly")
+	}
+
+	if serverErr != nil {
+		logrus.Fatalf("server is stopped with error: %s", serverErr.Error())
+	}
+
+	logrus.Infof("server is stopped gracefully")
 }
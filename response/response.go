@@ -1,5 +1,7 @@
 package response
 
+import "encoding/json"
+
 /*
 	response package providers information about returning data from server.
 */
@@ -9,7 +11,43 @@ type Response struct {
 	ID    string `json:"id"`
 }
 
+// List is an item of sessions list.
+// TTL is idle remaining time, AbsoluteTTL is remaining time till the end of the max lifetime.
 type List struct {
-	ID  string `json:"id"`
-	TTL int    `json:"ttl"`
+	ID          string   `json:"id" msgpack:"id"`
+	TTL         int      `json:"ttl" msgpack:"ttl"`
+	AbsoluteTTL int      `json:"absolute_ttl,omitempty" msgpack:"absolute_ttl,omitempty"`
+	DataSize    int      `json:"data_size,omitempty" msgpack:"data_size,omitempty"`
+	Owner       string   `json:"owner,omitempty" msgpack:"owner,omitempty"`
+	Tags        []string `json:"tags,omitempty" msgpack:"tags,omitempty"` // "key=value"
+}
+
+// ListPage is a page of sessions list.
+// Total is the number of sessions which match the filters, NextCursor is empty on the last page.
+type ListPage struct {
+	Sessions   []List `json:"sessions"`
+	Total      int    `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Destroyed is a result of destroying of several sessions.
+type Destroyed struct {
+	Destroyed int `json:"destroyed"`
+}
+
+// BatchItem is a result of the batch operation: HTTP status, id of the session and error.
+type BatchItem struct {
+	Status int    `json:"status"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Session struct {
+	ID          string          `json:"id"`
+	TTL         int             `json:"ttl"`
+	AbsoluteTTL int             `json:"absolute_ttl,omitempty"`
+	Created     int64           `json:"created,omitempty"`
+	Owner       string          `json:"owner,omitempty"`
+	Tags        []string        `json:"tags,omitempty"` // "key=value"
+	Data        json.RawMessage `json:"data,omitempty"`
 }
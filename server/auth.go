@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/iostrovok/aura-test/jwt"
+	"github.com/iostrovok/aura-test/response"
+)
+
+/*
+	API keys are sent in X-API-Key header, JWTs in "Authorization: Bearer <token>" header.
+	Each route requires a scope:
+
+		read  - get and check one session, metrics
+		write - create, extend, update and destroy sessions
+		admin - list all sessions and stream events, admin key has all scopes
+
+	Authentication is disabled if there are no keys and JWT verifier. Keys are compared by their SHA-256 hashes
+	in constant time, all keys are checked for each request.
+
+	Scopes of tokens are taken from "scope" (space separated) and "scopes" claims, "sessions:" prefix
+	is allowed ("sessions:read"), unknown scopes are ignored. If Config.JWTSubjectScope is set,
+	clients with tokens see only sessions of their subject ("sub" claim is the session owner).
+
+	API keys may be limited by namespaces ("default" is the root /sessions), other namespaces are forbidden.
+*/
+
+// Scope is a permission of API key or token.
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+	ScopeAdmin Scope = "admin"
+
+	APIKeyHeader      = "X-API-Key"
+	bearerPrefix      = "Bearer "
+	jwtScopePrefix    = "sessions:"
+	UnauthorizedError = "unauthorized"
+	ForbiddenError    = "forbidden"
+)
+
+var ErrAPIKey = errors.New("wrong API key")
+
+// APIKey is a key of a client with its scopes.
+type APIKey struct {
+	Name       string // name of the client for logs and metrics
+	Key        string
+	Scopes     []Scope
+	Namespaces []string // allowed namespaces, all if it's empty
+}
+
+// ValidateAPIKeys checks that keys are not empty, unique and have known scopes.
+func ValidateAPIKeys(keys []APIKey) error {
+	seen := make(map[string]bool, len(keys))
+	for i, key := range keys {
+		if key.Name == "" || key.Key == "" {
+			return fmt.Errorf("%w: key #%d has empty name or key", ErrAPIKey, i+1)
+		}
+
+		if seen[key.Key] {
+			return fmt.Errorf("%w: key %q is duplicated", ErrAPIKey, key.Name)
+		}
+		seen[key.Key] = true
+
+		for _, scope := range key.Scopes {
+			switch scope {
+			case ScopeRead, ScopeWrite, ScopeAdmin:
+			default:
+				return fmt.Errorf("%w: key %q has unknown scope %q", ErrAPIKey, key.Name, scope)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Principal is the authenticated client of the request.
+type Principal struct {
+	Name       string
+	Scopes     []Scope
+	Owner      string   // if it's not empty, the client sees only sessions of this owner
+	Namespaces []string // if it's not empty, the client has access to these namespaces only
+}
+
+// Has checks that the client has the scope.
+func (p *Principal) Has(scope Scope) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// In checks that the client has access to the namespace.
+func (p *Principal) In(namespace string) bool {
+	if len(p.Namespaces) == 0 {
+		return true
+	}
+
+	for _, ns := range p.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+
+	return false
+}
+
+type principalKey struct{}
+
+// PrincipalFrom returns the authenticated client of the request context.
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+
+	return p, ok
+}
+
+// auth checks API keys and tokens of requests.
+type auth struct {
+	keys         []authKey
+	jwt          *jwt.Verifier
+	subjectScope bool
+}
+
+type authKey struct {
+	hash      [sha256.Size]byte
+	principal *Principal
+}
+
+func newAuth(cfg Config) *auth {
+	a := &auth{keys: make([]authKey, 0, len(cfg.APIKeys)), jwt: cfg.JWT, subjectScope: cfg.JWTSubjectScope}
+	for _, key := range cfg.APIKeys {
+		a.keys = append(a.keys, authKey{
+			hash:      sha256.Sum256([]byte(key.Key)),
+			principal: &Principal{Name: key.Name, Scopes: key.Scopes, Namespaces: key.Namespaces},
+		})
+	}
+
+	return a
+}
+
+// enabled checks that any authentication is set.
+func (a *auth) enabled() bool {
+	return len(a.keys) > 0 || a.jwt != nil
+}
+
+// authenticate returns the client of the request key or token or false.
+func (a *auth) authenticate(req *http.Request) (*Principal, bool) {
+	if key := req.Header.Get(APIKeyHeader); key != "" {
+		return a.authenticateKey(key)
+	}
+
+	header := req.Header.Get("Authorization")
+	if a.jwt != nil && strings.HasPrefix(header, bearerPrefix) {
+		return a.authenticateToken(strings.TrimSpace(header[len(bearerPrefix):]))
+	}
+
+	return nil, false
+}
+
+// authenticateKey returns the client of API key.
+func (a *auth) authenticateKey(key string) (*Principal, bool) {
+	hash := sha256.Sum256([]byte(key))
+
+	var found *Principal
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], a.keys[i].hash[:]) == 1 {
+			found = a.keys[i].principal
+		}
+	}
+
+	return found, found != nil
+}
+
+// authenticateToken returns the client of JWT.
+func (a *auth) authenticateToken(token string) (*Principal, bool) {
+	claims, err := a.jwt.Verify(token)
+	if err != nil {
+		logrus.Debugf("jwt: %s", err.Error())
+
+		return nil, false
+	}
+
+	principal := &Principal{Name: "jwt:" + claims.Subject, Scopes: make([]Scope, 0)}
+	for _, s := range claims.AllScopes() {
+		switch scope := Scope(strings.TrimPrefix(s, jwtScopePrefix)); scope {
+		case ScopeRead, ScopeWrite, ScopeAdmin:
+			principal.Scopes = append(principal.Scopes, scope)
+		}
+	}
+
+	// tokens are issued outside of the server, so a token without namespaces is limited by the default one
+	principal.Namespaces = claims.AllNamespaces()
+	if len(principal.Namespaces) == 0 {
+		principal.Namespaces = []string{DefaultNamespace}
+	}
+
+	if a.subjectScope {
+		if claims.Subject == "" {
+			return nil, false
+		}
+		principal.Owner = claims.Subject
+	}
+
+	return principal, true
+}
+
+// require returns the handler which checks that the client has the scope.
+func (a *auth) require(scope Scope, h http.HandlerFunc) http.HandlerFunc {
+	return a.requireIn("", scope, h)
+}
+
+// requireIn returns the handler which checks that the client has the scope in the namespace.
+// Empty namespace is not checked.
+func (a *auth) requireIn(namespace string, scope Scope, h http.HandlerFunc) http.HandlerFunc {
+	if !a.enabled() {
+		return h
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		principal, ok := a.authenticate(req)
+		if !ok {
+			if len(a.keys) > 0 {
+				w.Header().Add("WWW-Authenticate", "APIKey header=\""+APIKeyHeader+"\"")
+			}
+			if a.jwt != nil {
+				w.Header().Add("WWW-Authenticate", "Bearer")
+			}
+			jsonPrint(w, http.StatusUnauthorized, response.Response{Error: UnauthorizedError})
+
+			return
+		}
+
+		if !principal.Has(scope) || (namespace != "" && !principal.In(namespace)) {
+			jsonPrint(w, http.StatusForbidden, response.Response{Error: ForbiddenError})
+
+			return
+		}
+
+		h(w, req.WithContext(context.WithValue(req.Context(), principalKey{}, principal)))
+	}
+}
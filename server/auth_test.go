@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/iostrovok/check"
+
+	"github.com/iostrovok/aura-test/jwt"
+	"github.com/iostrovok/aura-test/response"
+	"github.com/iostrovok/aura-test/storage"
+)
+
+func (s *testSuite) TestAuth(c *C) {
+	keeper := storage.New(context.Background())
+	id, _ := keeper.Create(30)
+
+	cfg := DefaultConfig()
+	cfg.APIKeys = []APIKey{
+		{Name: "reader", Key: "read-key", Scopes: []Scope{ScopeRead}},
+		{Name: "writer", Key: "write-key", Scopes: []Scope{ScopeRead, ScopeWrite}},
+		{Name: "admin", Key: "admin-key", Scopes: []Scope{ScopeAdmin}},
+	}
+
+	ts := httptest.NewServer(newHandler(keeper, cfg))
+	defer ts.Close()
+
+	do := func(method, path, key string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, nil)
+		c.Assert(err, IsNil)
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		res, err := http.DefaultClient.Do(req)
+		c.Assert(err, IsNil)
+
+		return res
+	}
+
+	// health check is public
+	res := do(http.MethodGet, "/healthcheck", "")
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	readResponse(c, res)
+
+	for _, key := range []string{"", "wrong-key", "read-key-"} {
+		res = do(http.MethodGet, "/sessions/"+id, key)
+		c.Assert(res.StatusCode, Equals, http.StatusUnauthorized)
+		c.Assert(res.Header.Get("WWW-Authenticate"), Not(Equals), "")
+		c.Assert(responseParser(c, res).Error, Equals, UnauthorizedError)
+	}
+
+	for _, tc := range []struct {
+		method, path, key string
+		status            int
+	}{
+		{http.MethodGet, "/sessions/" + id, "read-key", http.StatusOK},
+		{http.MethodGet, "/sessions", "read-key", http.StatusForbidden},
+		{http.MethodDelete, "/sessions/" + id, "read-key", http.StatusForbidden},
+		{http.MethodPost, "/sessions", "read-key", http.StatusForbidden},
+		{http.MethodPost, "/sessions", "write-key", http.StatusOK},
+		{http.MethodGet, "/sessions", "write-key", http.StatusForbidden},
+		{http.MethodGet, "/sessions", "admin-key", http.StatusOK},
+		{http.MethodGet, "/metrics", "read-key", http.StatusOK},
+		{http.MethodDelete, "/sessions/" + id, "admin-key", http.StatusOK},
+	} {
+		res = do(tc.method, tc.path, tc.key)
+		c.Assert(res.StatusCode, Equals, tc.status, Commentf("%s %s %s", tc.method, tc.path, tc.key))
+		if tc.status == http.StatusForbidden {
+			c.Assert(responseParser(c, res).Error, Equals, ForbiddenError)
+		} else {
+			readResponse(c, res)
+		}
+	}
+}
+
+func (s *testSuite) TestValidateAPIKeys(c *C) {
+	c.Assert(ValidateAPIKeys(nil), IsNil)
+	c.Assert(ValidateAPIKeys([]APIKey{{Name: "a", Key: "1", Scopes: []Scope{ScopeRead}}}), IsNil)
+
+	for _, keys := range [][]APIKey{
+		{{Name: "", Key: "1"}},
+		{{Name: "a", Key: ""}},
+		{{Name: "a", Key: "1"}, {Name: "b", Key: "1"}},
+		{{Name: "a", Key: "1", Scopes: []Scope{"root"}}},
+	} {
+		c.Assert(errors.Is(ValidateAPIKeys(keys), ErrAPIKey), Equals, true, Commentf("%+v", keys))
+	}
+}
+
+var jwtSecret = []byte("secret of the test tokens")
+
+// helper.
+func signHS256(c *C, sub, scope string) string {
+	return signClaims(c, map[string]interface{}{"sub": sub, "scope": scope})
+}
+
+// helper.
+func signClaims(c *C, claims map[string]interface{}) string {
+	claims["exp"] = time.Now().Unix() + 60
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	body, err := json.Marshal(claims)
+	c.Assert(err, IsNil)
+
+	input := b64([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + b64(body)
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte(input))
+
+	return input + "." + b64(mac.Sum(nil))
+}
+
+func (s *testSuite) TestJWT(c *C) {
+	keys, err := jwt.ParseKeySet([]byte(`{"keys": [{"kty": "oct", "k": "` + base64.RawURLEncoding.EncodeToString(jwtSecret) + `"}]}`))
+	c.Assert(err, IsNil)
+
+	keeper := storage.New(context.Background())
+	cfg := DefaultConfig()
+	cfg.JWT = &jwt.Verifier{Keys: keys}
+	cfg.JWTSubjectScope = true
+
+	ts := httptest.NewServer(newHandler(keeper, cfg))
+	defer ts.Close()
+
+	do := func(method, path, token string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(`{"ttl": 30}`))
+		c.Assert(err, IsNil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		c.Assert(err, IsNil)
+
+		return res
+	}
+
+	alice := signHS256(c, "alice", "sessions:read sessions:write")
+	bob := signHS256(c, "bob", "read write admin")
+
+	for _, token := range []string{"", "abc", alice[:len(alice)-2], signHS256(c, "", "read write")} {
+		res := do(http.MethodPost, "/sessions", token)
+		c.Assert(res.StatusCode, Equals, http.StatusUnauthorized, Commentf(token))
+		c.Assert(res.Header.Get("WWW-Authenticate"), Equals, "Bearer")
+		readResponse(c, res)
+	}
+
+	res := do(http.MethodGet, "/sessions", alice)
+	c.Assert(res.StatusCode, Equals, http.StatusForbidden)
+	readResponse(c, res)
+
+	res = do(http.MethodPost, "/sessions", alice)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	aliceID := responseParser(c, res).ID
+	res = do(http.MethodPost, "/sessions", bob)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	bobID := responseParser(c, res).ID
+
+	owner, _ := keeper.Owner(aliceID)
+	c.Assert(owner, Equals, "alice")
+
+	// sessions of other subjects are not found
+	res = do(http.MethodGet, "/sessions/"+bobID, alice)
+	c.Assert(res.StatusCode, Equals, http.StatusNotFound)
+	readResponse(c, res)
+	res = do(http.MethodDelete, "/sessions/"+aliceID, bob)
+	c.Assert(res.StatusCode, Equals, http.StatusNotFound)
+	readResponse(c, res)
+
+	res = do(http.MethodGet, "/sessions/"+aliceID, alice)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	readResponse(c, res)
+
+	// even admin sees only own sessions
+	res = do(http.MethodGet, "/sessions", bob)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	list := make([]response.List, 0)
+	c.Assert(json.Unmarshal(readResponse(c, res), &list), IsNil)
+	c.Assert(list, HasLen, 1)
+	c.Assert(list[0].ID, Equals, bobID)
+	c.Assert(list[0].Owner, Equals, "bob")
+
+	res = do(http.MethodDelete, "/sessions/"+aliceID, alice)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	readResponse(c, res)
+}
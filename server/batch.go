@@ -0,0 +1,174 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/iostrovok/aura-test/response"
+	"github.com/iostrovok/aura-test/storage"
+)
+
+/*
+	POST /sessions:batch applies a JSON array of operations:
+
+		[
+			{"op": "create", "ttl": 10, "data": {...}},
+			{"op": "extend", "id": "<id>", "ttl": 100},
+			{"op": "destroy", "id": "<id>"}
+		]
+
+	Create takes all fields of the create request, extend takes TTL like PUT /sessions/{id}/{ttl}.
+	The response is 200 with the array of results in the order of operations:
+
+		[{"status": 200, "id": "<id>"}, {"status": 404, "id": "<id>", "error": "NotFound"}, ...]
+
+	Batches with more then Config.MaxBatchSize operations get 413. Each operation takes a token of the rate limit
+	of its route (create, update or destroy), operations without tokens get 429.
+*/
+
+const (
+	// DefaultMaxBatchSize is a default of Config.MaxBatchSize.
+	DefaultMaxBatchSize = 1000
+
+	BatchTooLargeError  = "batch is too large"
+	WrongOperationError = "wrong operation"
+)
+
+// batchRequest is an operation of the batch.
+type batchRequest struct {
+	Op  string `json:"op"`  // "create", "extend" or "destroy"
+	ID  string `json:"id"`  // session of extend and destroy
+	TTL *int64 `json:"ttl"` // nil - default TTL like PUT /sessions/{id}
+	createRequest
+}
+
+var batchOps = map[string]storage.BatchOpType{
+	"create":  storage.BatchCreate,
+	"extend":  storage.BatchExtend,
+	"destroy": storage.BatchDestroy,
+}
+
+// batchRoutes are routes of rate limits of operations.
+var batchRoutes = map[storage.BatchOpType]string{
+	storage.BatchCreate:  RouteCreate,
+	storage.BatchExtend:  RouteUpdate,
+	storage.BatchDestroy: RouteDestroy,
+}
+
+// batchHandler returns interface method. It applies operations of the batch and returns their results.
+// Operations take tokens of rate limits of their routes.
+func batchHandler(l *rateLimiter) sessionHandler {
+	return func(keeper storage.SessionStore, cfg Config, w http.ResponseWriter, req *http.Request) {
+		applyBatch(keeper, cfg, l, w, req)
+	}
+}
+
+// applyBatch is just helper, see batchHandler.
+func applyBatch(keeper storage.SessionStore, cfg Config, l *rateLimiter, w http.ResponseWriter, req *http.Request) {
+	requests := make([]batchRequest, 0)
+	body, err := readBody(w, req)
+	if err == nil {
+		err = json.Unmarshal(body, &requests)
+	}
+
+	if err != nil {
+		logrus.Error(err.Error())
+		jsonPrint(w, http.StatusBadRequest, response.Response{Error: WrongBodyError})
+
+		return
+	}
+
+	if cfg.MaxBatchSize > 0 && len(requests) > cfg.MaxBatchSize {
+		jsonPrint(w, http.StatusRequestEntityTooLarge, response.Response{Error: BatchTooLargeError})
+
+		return
+	}
+
+	owner, client := ownerOf(req), clientOf(req)
+	results := make([]response.BatchItem, len(requests))
+	ops := make([]storage.BatchOp, 0, len(requests))
+	indexes := make([]int, 0, len(requests)) // indexes of results of ops
+	for i := range requests {
+		op, item, ok := requests[i].operation(keeper, cfg, owner)
+		if !ok {
+			results[i] = item
+
+			continue
+		}
+
+		if !l.allow(batchRoutes[op.Type], client) {
+			results[i] = response.BatchItem{Status: http.StatusTooManyRequests, ID: op.ID, Error: RateLimitedError}
+
+			continue
+		}
+
+		ops = append(ops, op)
+		indexes = append(indexes, i)
+	}
+
+	for i, res := range storage.ApplyBatch(keeper, ops) {
+		item := response.BatchItem{Status: http.StatusOK, ID: res.ID}
+		if res.Err != nil {
+			item.Status, item.Error = storageStatus(res.Err)
+		}
+		results[indexes[i]] = item
+	}
+
+	jsonPrint(w, http.StatusOK, results)
+}
+
+// operation converts the request to the storage operation. If the request is wrong or the client
+// can't apply it, it returns the result of the request and false.
+func (r *batchRequest) operation(keeper storage.SessionStore, cfg Config, owner string) (storage.BatchOp, response.BatchItem, bool) {
+	op := storage.BatchOp{ID: r.ID}
+	item := response.BatchItem{ID: r.ID}
+
+	typ, ok := batchOps[r.Op]
+	if !ok {
+		item.Status, item.Error = http.StatusBadRequest, WrongOperationError
+
+		return op, item, false
+	}
+	op.Type = typ
+
+	if typ == storage.BatchCreate {
+		if !r.ownedBy(owner) {
+			item.Status, item.Error = http.StatusForbidden, ForbiddenError
+
+			return op, item, false
+		}
+
+		if r.TTL != nil {
+			r.createRequest.TTL = *r.TTL
+		}
+		op.TTL, op.Opts = r.options(cfg)
+
+		return op, item, true
+	}
+
+	if len(r.ID) != 36 {
+		item.Status, item.Error = http.StatusBadRequest, WrongIDError
+
+		return op, item, false
+	}
+
+	if owner != "" {
+		if sessionOwner, find := keeper.Owner(r.ID); !find || sessionOwner != owner {
+			item.Status, item.Error = http.StatusNotFound, NotFoundError
+
+			return op, item, false
+		}
+	}
+
+	if typ == storage.BatchExtend {
+		ttl := cfg.DefaultTTL
+		if r.TTL != nil {
+			ttl = extendTTL(*r.TTL, cfg)
+		}
+		op.TTL = uint32(ttl)
+	}
+
+	return op, item, true
+}
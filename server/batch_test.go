@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/iostrovok/check"
+
+	"github.com/iostrovok/aura-test/jwt"
+	"github.com/iostrovok/aura-test/response"
+	"github.com/iostrovok/aura-test/storage"
+)
+
+// helper.
+func BatchRequest(c *C, url, body string) []response.BatchItem {
+	res := JSONRequest(c, http.MethodPost, url+"/sessions:batch", body)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+
+	out := make([]response.BatchItem, 0)
+	c.Assert(json.Unmarshal(readResponse(c, res), &out), IsNil)
+
+	return out
+}
+
+func (s *testSuite) TestBatch(c *C) {
+	keeper := storage.New(context.Background())
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
+	defer ts.Close()
+
+	first, _ := keeper.Create(10)
+	second, _ := keeper.Create(10)
+	missing := "11111111-1111-1111-1111-111111111111"
+
+	items := BatchRequest(c, ts.URL, fmt.Sprintf(`[
+		{"op": "create", "ttl": 20, "owner": "user-1", "data": {"user": "bla"}},
+		{"op": "extend", "id": %q, "ttl": 1000},
+		{"op": "destroy", "id": %q},
+		{"op": "destroy", "id": %q},
+		{"op": "extend", "id": "short"},
+		{"op": "update"},
+		{"op": "create", "data": [1]}
+	]`, first, second, missing))
+	c.Assert(items, HasLen, 7)
+
+	c.Assert(items[0].Status, Equals, http.StatusOK)
+	session := getSession(c, ts.URL, items[0].ID)
+	c.Assert(session.TTL, Equals, 20)
+	c.Assert(session.Owner, Equals, "user-1")
+	c.Assert(string(session.Data), Equals, `{"user":"bla"}`)
+
+	c.Assert(items[1:], DeepEquals, []response.BatchItem{
+		{Status: http.StatusOK, ID: first},
+		{Status: http.StatusOK, ID: second},
+		{Status: http.StatusNotFound, ID: missing, Error: NotFoundError},
+		{Status: http.StatusBadRequest, ID: "short", Error: WrongIDError},
+		{Status: http.StatusBadRequest, Error: WrongOperationError},
+		{Status: http.StatusBadRequest, Error: storage.ErrWrongData.Error()},
+	})
+
+	// extending is limited by max extended TTL
+	c.Assert(getSession(c, ts.URL, first).TTL, Equals, 300)
+	_, find := keeper.Get(second)
+	c.Assert(find, Equals, false)
+
+	// extend takes TTL like PUT /sessions/{id}/{ttl}: 0 extends by nothing, no TTL extends by the default
+	third, _ := keeper.Create(10)
+	items = BatchRequest(c, ts.URL, fmt.Sprintf(`[{"op": "extend", "id": %q, "ttl": 0}, {"op": "extend", "id": %q}]`, third, third))
+	c.Assert(items, DeepEquals, []response.BatchItem{{Status: http.StatusOK, ID: third}, {Status: http.StatusOK, ID: third}})
+	c.Assert(getSession(c, ts.URL, third).TTL, Equals, 10+int(DefaultConfig().DefaultTTL))
+
+	c.Assert(BatchRequest(c, ts.URL, `[]`), HasLen, 0)
+
+	res := JSONRequest(c, http.MethodPost, ts.URL+"/sessions:batch", `{"op": "create"}`)
+	c.Assert(res.StatusCode, Equals, http.StatusBadRequest)
+	c.Assert(responseParser(c, res).Error, Equals, WrongBodyError)
+
+	res = JSONRequest(c, http.MethodPost, ts.URL+"/sessions:batch", "["+strings.Repeat(`{"op": "create"},`, DefaultMaxBatchSize)+`{"op": "create"}]`)
+	c.Assert(res.StatusCode, Equals, http.StatusRequestEntityTooLarge)
+	c.Assert(responseParser(c, res).Error, Equals, BatchTooLargeError)
+	c.Assert(keeper.Len(), Equals, 3)
+}
+
+func (s *testSuite) TestBatchOwner(c *C) {
+	keys, err := jwt.ParseKeySet([]byte(`{"keys": [{"kty": "oct", "k": "` + base64.RawURLEncoding.EncodeToString(jwtSecret) + `"}]}`))
+	c.Assert(err, IsNil)
+
+	keeper := storage.New(context.Background())
+	cfg := DefaultConfig()
+	cfg.JWT = &jwt.Verifier{Keys: keys}
+	cfg.JWTSubjectScope = true
+
+	ts := httptest.NewServer(newHandler(keeper, cfg))
+	defer ts.Close()
+
+	own, _ := keeper.Create(30, storage.SessionOwner("alice"))
+	other, _ := keeper.Create(30, storage.SessionOwner("bob"))
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/sessions:batch", strings.NewReader(fmt.Sprintf(`[
+		{"op": "create"},
+		{"op": "create", "owner": "bob"},
+		{"op": "destroy", "id": %q},
+		{"op": "destroy", "id": %q}
+	]`, own, other)))
+	c.Assert(err, IsNil)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+signHS256(c, "alice", "read write"))
+	res, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+
+	items := make([]response.BatchItem, 0)
+	c.Assert(json.Unmarshal(readResponse(c, res), &items), IsNil)
+	c.Assert(items, HasLen, 4)
+	c.Assert(items[0].Status, Equals, http.StatusOK)
+	c.Assert(items[1:], DeepEquals, []response.BatchItem{
+		{Status: http.StatusForbidden, Error: ForbiddenError},
+		{Status: http.StatusOK, ID: own},
+		{Status: http.StatusNotFound, ID: other, Error: NotFoundError},
+	})
+
+	owner, _ := keeper.Owner(items[0].ID)
+	c.Assert(owner, Equals, "alice")
+	_, find := keeper.Get(other)
+	c.Assert(find, Equals, true)
+}
+
+func (s *testSuite) TestBatchRateLimit(c *C) {
+	keeper := storage.New(context.Background())
+	cfg := DefaultConfig()
+	cfg.RateLimits = RateLimits{RouteCreate: {Rate: 0.01, Burst: 2}, RouteDestroy: {Rate: 0.01, Burst: 1}}
+
+	ts := httptest.NewServer(newHandler(keeper, cfg))
+	defer ts.Close()
+
+	first, _ := keeper.Create(10)
+	second, _ := keeper.Create(10)
+
+	// operations take tokens of their routes
+	items := BatchRequest(c, ts.URL, fmt.Sprintf(`[
+		{"op": "create"},
+		{"op": "create"},
+		{"op": "create"},
+		{"op": "destroy", "id": %q},
+		{"op": "destroy", "id": %q},
+		{"op": "extend", "id": %q}
+	]`, first, second, second))
+	c.Assert(items, HasLen, 6)
+	c.Assert(items[0].Status, Equals, http.StatusOK)
+	c.Assert(items[1].Status, Equals, http.StatusOK)
+	c.Assert(items[2:], DeepEquals, []response.BatchItem{
+		{Status: http.StatusTooManyRequests, Error: RateLimitedError},
+		{Status: http.StatusOK, ID: first},
+		{Status: http.StatusTooManyRequests, ID: second, Error: RateLimitedError},
+		{Status: http.StatusOK, ID: second},
+	})
+	c.Assert(keeper.Len(), Equals, 3)
+
+	// the single create route is limited by the same tokens
+	res := CreateRequest(c, ts.URL, "")
+	c.Assert(res.StatusCode, Equals, http.StatusTooManyRequests)
+	readResponse(c, res)
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/iostrovok/aura-test/response"
+)
+
+/*
+	Sessions list is written by encoders of the format chosen by Accept header:
+
+		application/json     - JSON array (default)
+		application/x-ndjson - one JSON object per line
+		text/csv             - "id,ttl,absolute_ttl,data_size,owner,tags" header and one session per line,
+		                       tags are separated by spaces
+		application/msgpack  - sequence of MessagePack maps (one map per session)
+
+	Encoders write sessions one by one, so the list is never kept in memory.
+*/
+
+const (
+	JSONContentType    = "application/json"
+	CSVContentType     = "text/csv"
+	MsgPackContentType = "application/msgpack"
+)
+
+// listWriter writes sessions list in some format. Close finishes the list, it must be called once.
+type listWriter interface {
+	Write(l response.List) error
+	Close() error
+}
+
+// listFormat is a format of sessions list.
+type listFormat struct {
+	contentType string
+	aliases     []string
+	newWriter   func(w io.Writer) listWriter
+}
+
+var (
+	jsonFormat    = &listFormat{contentType: JSONContentType, newWriter: newJSONListWriter}
+	ndjsonFormat  = &listFormat{contentType: NDJSONContentType, newWriter: newNDJSONListWriter}
+	csvFormat     = &listFormat{contentType: CSVContentType, newWriter: newCSVListWriter}
+	msgpackFormat = &listFormat{
+		contentType: MsgPackContentType,
+		aliases:     []string{"application/x-msgpack"},
+		newWriter:   newMsgPackListWriter,
+	}
+
+	// listFormats are ordered by preference for wildcards.
+	listFormats = []*listFormat{jsonFormat, ndjsonFormat, csvFormat, msgpackFormat}
+)
+
+// matches checks that the media range ("text/csv", "text/*", "*/*") includes the format.
+func (f *listFormat) matches(mediaRange string) bool {
+	if mediaRange == "*/*" || mediaRange == f.contentType {
+		return true
+	}
+
+	for _, alias := range f.aliases {
+		if mediaRange == alias {
+			return true
+		}
+	}
+
+	return strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(f.contentType, strings.TrimSuffix(mediaRange, "*"))
+}
+
+// acceptRange is a media range of Accept header with its quality.
+type acceptRange struct {
+	mediaRange string
+	q          float64
+}
+
+// specificity is 0 for "*/*", 1 for "type/*" and 2 for the media type.
+func (r acceptRange) specificity() int {
+	switch {
+	case r.mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(r.mediaRange, "/*"):
+		return 1
+	}
+
+	return 2
+}
+
+// negotiateList returns the format of sessions list by Accept header or false if no format is acceptable.
+// Empty header means JSON. Ranges with q=0 exclude formats from less specific ranges,
+// so "application/json;q=0, */*" is any format but JSON.
+func negotiateList(accept string) (*listFormat, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return jsonFormat, true
+	}
+
+	ranges, excluded := make([]acceptRange, 0), make([]acceptRange, 0)
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		r := acceptRange{mediaRange: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					r.q = q
+				}
+			}
+		}
+
+		if r.q > 0 {
+			ranges = append(ranges, r)
+		} else {
+			excluded = append(excluded, r)
+		}
+	}
+
+	// the format is excluded if the more specific range excludes it
+	isExcluded := func(f *listFormat, r acceptRange) bool {
+		for _, e := range excluded {
+			if f.matches(e.mediaRange) && e.specificity() > r.specificity() {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	// the order of the header is kept for equal quality
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	for _, r := range ranges {
+		for _, f := range listFormats {
+			if f.matches(r.mediaRange) && !isExcluded(f, r) {
+				return f, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// jsonListWriter writes JSON array.
+type jsonListWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func newJSONListWriter(w io.Writer) listWriter {
+	return &jsonListWriter{w: w}
+}
+
+func (j *jsonListWriter) Write(l response.List) error {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	sep := byte(',')
+	if !j.started {
+		j.started = true
+		sep = '['
+	}
+
+	_, err = j.w.Write(append([]byte{sep}, b...))
+
+	return err
+}
+
+func (j *jsonListWriter) Close() error {
+	end := "]"
+	if !j.started {
+		end = "[]"
+	}
+
+	_, err := io.WriteString(j.w, end)
+
+	return err
+}
+
+// ndjsonListWriter writes one JSON object per line.
+type ndjsonListWriter struct {
+	encoder *json.Encoder
+}
+
+func newNDJSONListWriter(w io.Writer) listWriter {
+	return &ndjsonListWriter{encoder: json.NewEncoder(w)}
+}
+
+func (n *ndjsonListWriter) Write(l response.List) error {
+	return n.encoder.Encode(l)
+}
+
+func (n *ndjsonListWriter) Close() error {
+	return nil
+}
+
+// csvListWriter writes CSV with header.
+type csvListWriter struct {
+	w       *csv.Writer
+	started bool
+}
+
+var csvHeader = []string{"id", "ttl", "absolute_ttl", "data_size", "owner", "tags"}
+
+func newCSVListWriter(w io.Writer) listWriter {
+	return &csvListWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvListWriter) header() error {
+	if c.started {
+		return nil
+	}
+	c.started = true
+
+	return c.w.Write(csvHeader)
+}
+
+func (c *csvListWriter) Write(l response.List) error {
+	if err := c.header(); err != nil {
+		return err
+	}
+
+	return c.w.Write([]string{
+		l.ID, strconv.Itoa(l.TTL), strconv.Itoa(l.AbsoluteTTL), strconv.Itoa(l.DataSize),
+		csvText(l.Owner), csvText(strings.Join(l.Tags, " ")),
+	})
+}
+
+// csvText escapes the text cell which spreadsheets would run as a formula (CSV injection).
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+
+	return s
+}
+
+func (c *csvListWriter) Close() error {
+	if err := c.header(); err != nil {
+		return err
+	}
+	c.w.Flush()
+
+	return c.w.Error()
+}
+
+// msgpackListWriter writes MessagePack map per session.
+type msgpackListWriter struct {
+	encoder *msgpack.Encoder
+}
+
+func newMsgPackListWriter(w io.Writer) listWriter {
+	return &msgpackListWriter{encoder: msgpack.NewEncoder(w)}
+}
+
+func (m *msgpackListWriter) Write(l response.List) error {
+	return m.encoder.Encode(&l)
+}
+
+func (m *msgpackListWriter) Close() error {
+	return nil
+}
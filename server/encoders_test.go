@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bytes"
+	"io"
+
+	. "github.com/iostrovok/check"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/iostrovok/aura-test/response"
+)
+
+func (s *testSuite) TestNegotiateList(c *C) {
+	for accept, contentType := range map[string]string{
+		"":                                  JSONContentType,
+		"*/*":                               JSONContentType,
+		"application/json":                  JSONContentType,
+		"text/csv":                          CSVContentType,
+		"text/*":                            CSVContentType,
+		"application/x-ndjson":              NDJSONContentType,
+		"application/x-msgpack":             MsgPackContentType,
+		"text/html, application/msgpack":    MsgPackContentType,
+		"application/json;q=0.5, text/csv":  CSVContentType,
+		"text/csv;q=0, application/*;q=0.1": JSONContentType,
+		"application/json;q=0, */*":         NDJSONContentType,
+		"application/*;q=0, */*":            CSVContentType,
+		"text/*;q=0, text/csv":              CSVContentType,
+	} {
+		format, ok := negotiateList(accept)
+		c.Assert(ok, Equals, true, Commentf(accept))
+		c.Assert(format.contentType, Equals, contentType, Commentf(accept))
+	}
+
+	for _, accept := range []string{"text/html", "image/*", "application/json;q=0", "*/*;q=0", "text/csv;q=0, text/*"} {
+		_, ok := negotiateList(accept)
+		c.Assert(ok, Equals, false, Commentf(accept))
+	}
+}
+
+// helper.
+func encodeList(c *C, format *listFormat, list []response.List) string {
+	buf := &bytes.Buffer{}
+	lw := format.newWriter(buf)
+	for _, l := range list {
+		c.Assert(lw.Write(l), IsNil)
+	}
+	c.Assert(lw.Close(), IsNil)
+
+	return buf.String()
+}
+
+func (s *testSuite) TestListWriters(c *C) {
+	list := []response.List{
+		{ID: "a", TTL: 10},
+		{ID: "b", TTL: 20, AbsoluteTTL: 30, DataSize: 5, Owner: "user-1", Tags: []string{"app=web", "region=eu"}},
+	}
+
+	c.Assert(encodeList(c, jsonFormat, nil), Equals, "[]")
+	c.Assert(encodeList(c, jsonFormat, list), Equals,
+		`[{"id":"a","ttl":10},{"id":"b","ttl":20,"absolute_ttl":30,"data_size":5,"owner":"user-1","tags":["app=web","region=eu"]}]`)
+
+	c.Assert(encodeList(c, ndjsonFormat, nil), Equals, "")
+	c.Assert(encodeList(c, ndjsonFormat, list), Equals,
+		`{"id":"a","ttl":10}`+"\n"+`{"id":"b","ttl":20,"absolute_ttl":30,"data_size":5,"owner":"user-1","tags":["app=web","region=eu"]}`+"\n")
+
+	c.Assert(encodeList(c, csvFormat, nil), Equals, "id,ttl,absolute_ttl,data_size,owner,tags\n")
+	c.Assert(encodeList(c, csvFormat, list), Equals,
+		"id,ttl,absolute_ttl,data_size,owner,tags\na,10,0,0,,\nb,20,30,5,user-1,app=web region=eu\n")
+
+	// formulas are not run by spreadsheets
+	c.Assert(encodeList(c, csvFormat, []response.List{{ID: "c", Owner: "=1+2", Tags: []string{"-x=1"}}, {ID: "d", Owner: "@user"}}), Equals,
+		"id,ttl,absolute_ttl,data_size,owner,tags\nc,0,0,0,'=1+2,'-x=1\nd,0,0,0,'@user,\n")
+
+	c.Assert(encodeList(c, msgpackFormat, nil), Equals, "")
+	decoder := msgpack.NewDecoder(bytes.NewBufferString(encodeList(c, msgpackFormat, list)))
+	for _, expected := range list {
+		l := response.List{}
+		c.Assert(decoder.Decode(&l), IsNil)
+		c.Assert(l, DeepEquals, expected)
+	}
+	c.Assert(decoder.Decode(&response.List{}), Equals, io.EOF)
+}
@@ -1,11 +1,17 @@
 package server
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"errors"
+	"io"
+	"math"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/sirupsen/logrus"
@@ -15,15 +21,36 @@ import (
 )
 
 const (
+	// MaxAllowedExtendedTTL and DefaultTTL are defaults of Config.
 	MaxAllowedExtendedTTL = int64(300)
 	DefaultTTL            = int64(30)
+	MaxRequestBodySize    = int64(1 << 20)
 	WrongPathError        = "wrong path"
 	WrongTTLError         = "wrong TTL"
 	WrongIDError          = "wrong session ID"
+	WrongBodyError        = "wrong request body"
+	NotFoundError         = "NotFound"
+	SessionTTLHeader      = "X-Session-TTL"
+	EventsKeepAlive       = 15 * time.Second
+	NDJSONContentType     = "application/x-ndjson"
+	NotAcceptableError    = "not acceptable"
+	TotalCountHeader      = "X-Total-Count"
+	NextCursorHeader      = "X-Next-Cursor"
+	ListBufferSize        = 32 << 10
 )
 
+// createRequest is JSON body of create request.
+type createRequest struct {
+	TTL         int64             `json:"ttl"`
+	Slide       int64             `json:"slide"`        // sliding expiration, 0 - fixed expiration
+	MaxLifetime int64             `json:"max_lifetime"` // absolute max lifetime, 0 - default of the storage
+	Owner       string            `json:"owner"`        // user or tenant of the session, see /owners/{owner}/sessions
+	Tags        map[string]string `json:"tags"`         // see /tags/sessions
+	Data        json.RawMessage   `json:"data"`
+}
+
 // createSession is interface method. It creates new session.
-func createSessionHandler(keeper *storage.Storage, w http.ResponseWriter, req *http.Request) {
+func createSessionHandler(keeper storage.SessionStore, cfg Config, w http.ResponseWriter, req *http.Request) {
 	/*
 		create - Should take a TTL as an optional param, default should be 30 seconds.
 		This API, when called, should return a unique session-id which should be UUID based.
@@ -31,27 +58,113 @@ func createSessionHandler(keeper *storage.Storage, w http.ResponseWriter, req *h
 		Only the sessions that have not expired are expected to be kept in memory.
 		Any expired sessions should be removed automatically.
 	*/
-	// get POST parameter
-	if err := req.ParseForm(); err != nil {
-		logrus.Error(err.Error())
-		jsonPrint(w, http.StatusBadRequest, response.Response{Error: err.Error()})
+	request := createRequest{}
+	if isJSONRequest(req) {
+		// get JSON body: {"ttl": 10, "slide": 30, "max_lifetime": 3600, "owner": "user-1", "tags": {"app": "mobile"}, "data": {...}}
+		body, err := readBody(w, req)
+		if err == nil {
+			err = json.Unmarshal(body, &request)
+		}
 
-		return
+		if err != nil {
+			logrus.Error(err.Error())
+			jsonPrint(w, http.StatusBadRequest, response.Response{Error: WrongBodyError})
+
+			return
+		}
+	} else {
+		// get POST parameter
+		if err := req.ParseForm(); err != nil {
+			logrus.Error(err.Error())
+			jsonPrint(w, http.StatusBadRequest, response.Response{Error: err.Error()})
+
+			return
+		}
+
+		request.TTL, _ = strconv.ParseInt(req.FormValue("TTL"), 10, 64)
+		request.Slide, _ = strconv.ParseInt(req.FormValue("SLIDE"), 10, 64)
+		request.MaxLifetime, _ = strconv.ParseInt(req.FormValue("MAX_LIFETIME"), 10, 64)
+		request.Owner = req.FormValue("OWNER")
+		for _, tag := range req.Form["TAG"] {
+			if request.Tags == nil {
+				request.Tags = map[string]string{}
+			}
+			parts := strings.SplitN(tag, "=", 2)
+			if len(parts) != 2 {
+				storageError(w, storage.ErrWrongTags)
+
+				return
+			}
+			request.Tags[parts[0]] = parts[1]
+		}
 	}
 
-	ttl, err := strconv.ParseInt(req.FormValue("TTL"), 10, 64)
-	if err != nil || ttl < 1 || ttl > DefaultTTL {
-		ttl = DefaultTTL
+	// clients limited by owner create their own sessions only
+	if !request.ownedBy(ownerOf(req)) {
+		jsonPrint(w, http.StatusForbidden, response.Response{Error: ForbiddenError})
+
+		return
 	}
 
+	ttl, opts := request.options(cfg)
+
 	// get new session uuid
-	// always success
-	id := keeper.Create(uint32(ttl))
+	id, err := keeper.Create(ttl, opts...)
+	if err != nil {
+		storageError(w, err)
+
+		return
+	}
+
 	jsonPrint(w, http.StatusOK, response.Response{ID: id})
 }
 
+// ownedBy sets the owner of the client (if the client is limited by owner) to the r.
+// It returns false if the request has another owner.
+func (r *createRequest) ownedBy(owner string) bool {
+	if owner == "" {
+		return true
+	}
+
+	if r.Owner != "" && r.Owner != owner {
+		return false
+	}
+	r.Owner = owner
+
+	return true
+}
+
+// options returns TTL and options of the new session limited by the settings.
+func (r *createRequest) options(cfg Config) (uint32, []storage.SessionOption) {
+	ttl := r.TTL
+	if ttl < 1 || ttl > cfg.DefaultTTL {
+		ttl = cfg.DefaultTTL
+	}
+
+	slide := r.Slide
+	switch {
+	case slide < 0:
+		slide = 0
+	case slide > cfg.MaxExtendedTTL:
+		slide = cfg.MaxExtendedTTL
+	}
+
+	maxLifetime := r.MaxLifetime
+	if maxLifetime < 0 || maxLifetime > math.MaxUint32 {
+		maxLifetime = 0
+	}
+
+	return uint32(ttl), []storage.SessionOption{
+		storage.SessionData(r.Data),
+		storage.SessionSliding(uint32(slide)),
+		storage.SessionMaxLifetime(uint32(maxLifetime)),
+		storage.SessionOwner(r.Owner),
+		storage.SessionTags(r.Tags),
+	}
+}
+
 // extendHandler is interface method. It extends session ttl but no more then 300 sec.
-func extendHandler(keeper *storage.Storage, w http.ResponseWriter, req *http.Request) {
+func extendHandler(keeper storage.SessionStore, cfg Config, w http.ResponseWriter, req *http.Request) {
 	/*
 		extend - Should take a mandatory session-id and an optional TTL param.
 		When this API is called, if the session exists then it should be extended with the provided TTL
@@ -60,9 +173,10 @@ func extendHandler(keeper *storage.Storage, w http.ResponseWriter, req *http.Req
 		If the session doesn't exist, then 404 should be returned.
 		The max TTL allowed for this API is 300 seconds.
 		Any greater value of TTL provided should be reduced to 300 seconds.
+		JSON body (if it's sent) replaces the session data.
 	*/
 
-	id, ttl, err := parseURL(req)
+	id, ttl, err := parseURL(req, cfg)
 	if err != nil {
 		logrus.Error(err.Error())
 		jsonPrint(w, http.StatusBadRequest, response.Response{Error: err.Error()})
@@ -70,9 +184,31 @@ func extendHandler(keeper *storage.Storage, w http.ResponseWriter, req *http.Req
 		return
 	}
 
+	if !ownedBy(keeper, req, id) {
+		jsonPrint(w, http.StatusNotFound, response.Response{Error: NotFoundError})
+
+		return
+	}
+
+	if isJSONRequest(req) {
+		body, err := readBody(w, req)
+		if err != nil {
+			logrus.Error(err.Error())
+			jsonPrint(w, http.StatusBadRequest, response.Response{Error: WrongBodyError})
+
+			return
+		}
+
+		if err := keeper.SetData(id, body); err != nil {
+			storageError(w, err)
+
+			return
+		}
+	}
+
 	if findID := keeper.Extend(id, uint32(ttl)); !findID {
 		logrus.Errorf("%s is not found", id)
-		jsonPrint(w, http.StatusNotFound, response.Response{Error: "NotFound"})
+		jsonPrint(w, http.StatusNotFound, response.Response{Error: NotFoundError})
 
 		return
 	}
@@ -81,7 +217,7 @@ func extendHandler(keeper *storage.Storage, w http.ResponseWriter, req *http.Req
 }
 
 // destroyHandler is interface method. It deletes existing session and returns 404 is session id is not found.
-func destroyHandler(keeper *storage.Storage, w http.ResponseWriter, req *http.Request) {
+func destroyHandler(keeper storage.SessionStore, cfg Config, w http.ResponseWriter, req *http.Request) {
 	/*
 		Destroy - Should take a session-id as a mandatory param.
 		When this API is called, if the session exists, then it should remove the session from its cache
@@ -89,7 +225,7 @@ func destroyHandler(keeper *storage.Storage, w http.ResponseWriter, req *http.Re
 		If the session doesn't exist, then a 404 response should be returned.
 	*/
 
-	id, _, err := parseURL(req)
+	id, _, err := parseURL(req, cfg)
 	if err != nil {
 		logrus.Error(err.Error())
 		jsonPrint(w, http.StatusBadRequest, response.Response{Error: err.Error()})
@@ -97,42 +233,481 @@ func destroyHandler(keeper *storage.Storage, w http.ResponseWriter, req *http.Re
 		return
 	}
 
+	if !ownedBy(keeper, req, id) {
+		jsonPrint(w, http.StatusNotFound, response.Response{Error: NotFoundError})
+
+		return
+	}
+
 	status := http.StatusOK
 	res := response.Response{ID: id}
 	if find := keeper.Destroy(id); !find {
 		logrus.Errorf("%s is not found", id)
 		status = http.StatusNotFound
-		res.Error = "NotFound"
+		res.Error = NotFoundError
 	}
 
 	jsonPrint(w, status, res)
 }
 
+// updateDataHandler is interface method. It merges JSON body into the session data.
+func updateDataHandler(keeper storage.SessionStore, cfg Config, w http.ResponseWriter, req *http.Request) {
+	/*
+		PATCH /sessions/{id} with JSON object: top level keys are replaced, keys with null value are deleted.
+		TTL of the session is not changed.
+	*/
+
+	id, _, err := parseURL(req, cfg)
+	if err == nil && id == "" {
+		err = errors.New(WrongIDError)
+	}
+
+	if err != nil {
+		logrus.Error(err.Error())
+		jsonPrint(w, http.StatusBadRequest, response.Response{Error: err.Error()})
+
+		return
+	}
+
+	if !ownedBy(keeper, req, id) {
+		jsonPrint(w, http.StatusNotFound, response.Response{Error: NotFoundError})
+
+		return
+	}
+
+	body, err := readBody(w, req)
+	if err != nil {
+		logrus.Error(err.Error())
+		jsonPrint(w, http.StatusBadRequest, response.Response{Error: WrongBodyError})
+
+		return
+	}
+
+	if err := keeper.MergeData(id, body); err != nil {
+		storageError(w, err)
+
+		return
+	}
+
+	jsonPrint(w, http.StatusOK, response.Response{ID: id})
+}
+
+// getSessionHandler is interface method. It returns the session TTL and data or 404.
+func getSessionHandler(keeper storage.SessionStore, cfg Config, w http.ResponseWriter, req *http.Request) {
+	id, _, err := parseURL(req, cfg)
+	if err == nil && id == "" {
+		err = errors.New(WrongIDError)
+	}
+
+	if err != nil {
+		jsonPrint(w, http.StatusBadRequest, response.Response{Error: err.Error()})
+
+		return
+	}
+
+	if !ownedBy(keeper, req, id) {
+		jsonPrint(w, http.StatusNotFound, response.Response{ID: id, Error: NotFoundError})
+
+		return
+	}
+
+	session, find := keeper.Get(id)
+	if !find {
+		jsonPrint(w, http.StatusNotFound, response.Response{ID: id, Error: NotFoundError})
+
+		return
+	}
+
+	jsonPrint(w, http.StatusOK, session)
+}
+
+// headSessionHandler is interface method. It's a cheap check that the session exists: 200 or 404 without body.
+// Remaining TTL is returned in SessionTTLHeader, expiry of sliding sessions is not moved.
+func headSessionHandler(keeper storage.SessionStore, cfg Config, w http.ResponseWriter, req *http.Request) {
+	id, _, err := parseURL(req, cfg)
+	if err != nil || id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	if !ownedBy(keeper, req, id) {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	session, find := keeper.Peek(id)
+	if !find {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	w.Header().Set(SessionTTLHeader, strconv.Itoa(session.TTL))
+	w.WriteHeader(http.StatusOK)
+}
+
 // listSessionsHandler is interface method. It returns list of all active sessions and remaining TTL.
 // Need to remember that some sessions may become expired during getting of data.
-func listSessionsHandler(keeper *storage.Storage, w http.ResponseWriter, _ *http.Request) {
+// With any of list parameters (limit, cursor, sort, prefix, min_ttl, max_ttl) it returns one page.
+// The format is chosen by Accept header (see encoders.go).
+func listSessionsHandler(keeper storage.SessionStore, w http.ResponseWriter, req *http.Request) {
 	/*
 		list - Should just return a list of all the sessions that the service is currently tracking,
 		each identified using its UUID and the corresponding TTL that is remaining.
 	*/
+	format, ok := listFormatOf(req)
+	if !ok {
+		jsonPrint(w, http.StatusNotAcceptable, response.Response{Error: NotAcceptableError})
+
+		return
+	}
+
+	opts, paged, err := parseListQuery(req)
+	if err != nil {
+		jsonPrint(w, http.StatusBadRequest, response.Response{Error: err.Error()})
+
+		return
+	}
+	opts.Owner = ownerOf(req)
+
+	if paged && !isStreamRequest(req) {
+		listPageHandler(keeper, format, opts, w)
+
+		return
+	}
+
+	listAllHandler(keeper, format, opts, w, req)
+}
+
+// listPageHandler writes one page of sessions. JSON page is an object with total and next cursor,
+// other formats have them in X-Total-Count and X-Next-Cursor headers.
+func listPageHandler(keeper storage.SessionStore, format *listFormat, opts storage.ListOptions, w http.ResponseWriter) {
+	page, err := keeper.List(opts)
+	if err != nil {
+		storageError(w, err)
 
-	sessionJSONList := keeper.ListAllSessions()
+		return
+	}
+
+	if format == jsonFormat {
+		jsonPrint(w, http.StatusOK, page)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set(TotalCountHeader, strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		w.Header().Set(NextCursorHeader, page.NextCursor)
+	}
 	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	if _, err := w.Write(sessionJSONList); err != nil {
+
+	if err := writeList(w, format, page.Sessions); err != nil {
 		logrus.Error(err.Error())
 	}
 }
 
+// writeList is just helper. It writes sessions in the format.
+func writeList(w io.Writer, format *listFormat, sessions []response.List) error {
+	lw := format.newWriter(w)
+	for _, l := range sessions {
+		if err := lw.Write(l); err != nil {
+			return err
+		}
+	}
+
+	return lw.Close()
+}
+
+// listAllHandler writes all active sessions which match opts one by one without collecting them.
+// The response is flushed by chunks and it stops when the client disconnects.
+// Wrong options are found by the first page, so the status is written with the first session.
+func listAllHandler(keeper storage.SessionStore, format *listFormat, opts storage.ListOptions, w http.ResponseWriter, req *http.Request) {
+	started := false
+	start := func() {
+		if !started {
+			started = true
+			w.Header().Set("Content-Type", format.contentType)
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+
+	bw := bufio.NewWriterSize(&flushWriter{w: w}, ListBufferSize)
+	lw := format.newWriter(bw)
+
+	write := func(l response.List) error {
+		if opts.Owner != "" && l.Owner != opts.Owner {
+			return nil
+		}
+		start()
+
+		return lw.Write(l)
+	}
+
+	err := eachSession(req.Context(), keeper, opts, write)
+	if err != nil && !started {
+		storageError(w, err)
+
+		return
+	}
+
+	if err == nil {
+		start()
+		err = lw.Close()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+
+	if err != nil {
+		logrus.Infof("list of sessions is aborted: %s", err.Error())
+	}
+}
+
+// eachSession is just helper. It passes all sessions which match opts to fn by storage.Iterator or page by page.
+// opts.Limit is the size of pages, the cursor is the start of the walk.
+func eachSession(ctx context.Context, keeper storage.SessionStore, opts storage.ListOptions, fn func(l response.List) error) error {
+	// the iterator doesn't filter and sort sessions, the owner is filtered by fn
+	if iterator, ok := keeper.(storage.Iterator); ok && opts == (storage.ListOptions{Owner: opts.Owner}) {
+		return iterator.EachSession(ctx, fn)
+	}
+
+	if opts.Limit == 0 {
+		opts.Limit = storage.MaxListLimit
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		page, err := keeper.List(opts)
+		if err != nil {
+			return err
+		}
+
+		for _, l := range page.Sessions {
+			if err := fn(l); err != nil {
+				return err
+			}
+		}
+
+		if page.NextCursor == "" {
+			return nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// flushWriter flushes each write, it's used under bufio.Writer to flush the response by chunks.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok && err == nil {
+		flusher.Flush()
+	}
+
+	return n, err
+}
+
+// ownerSessionsHandler returns all active sessions of the owner in the format chosen by Accept header.
+func ownerSessionsHandler(index storage.OwnerIndex) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		owner := ownerFromPath(req)
+		if !ownerAllowed(w, req, owner) {
+			return
+		}
+
+		format, ok := listFormatOf(req)
+		if !ok {
+			jsonPrint(w, http.StatusNotAcceptable, response.Response{Error: NotAcceptableError})
+
+			return
+		}
+
+		sessions := index.OwnerSessions(owner)
+		if format == jsonFormat {
+			jsonPrint(w, http.StatusOK, sessions)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", format.contentType)
+		w.WriteHeader(http.StatusOK)
+		if err := writeList(w, format, sessions); err != nil {
+			logrus.Error(err.Error())
+		}
+	}
+}
+
+// destroyOwnerHandler destroys all sessions of the owner ("log out everywhere") and returns their number.
+func destroyOwnerHandler(index storage.OwnerIndex) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		owner := ownerFromPath(req)
+		if !ownerAllowed(w, req, owner) {
+			return
+		}
+
+		jsonPrint(w, http.StatusOK, response.Destroyed{Destroyed: index.DestroyOwner(owner)})
+	}
+}
+
+// taggedSessionsHandler returns active sessions which match the tag query (parameter "q")
+// in the format chosen by Accept header. Clients limited by owner get their own sessions only.
+func taggedSessionsHandler(index storage.TagIndex) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		format, ok := listFormatOf(req)
+		if !ok {
+			jsonPrint(w, http.StatusNotAcceptable, response.Response{Error: NotAcceptableError})
+
+			return
+		}
+
+		q, ok := tagQueryOf(w, req)
+		if !ok {
+			return
+		}
+
+		sessions := index.TaggedSessions(q)
+		if format == jsonFormat {
+			jsonPrint(w, http.StatusOK, sessions)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", format.contentType)
+		w.WriteHeader(http.StatusOK)
+		if err := writeList(w, format, sessions); err != nil {
+			logrus.Error(err.Error())
+		}
+	}
+}
+
+// destroyTaggedHandler destroys all sessions which match the tag query (parameter "q") and returns their number.
+func destroyTaggedHandler(index storage.TagIndex) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		q, ok := tagQueryOf(w, req)
+		if !ok {
+			return
+		}
+
+		jsonPrint(w, http.StatusOK, response.Destroyed{Destroyed: index.DestroyTagged(q)})
+	}
+}
+
+// eventsHandler streams session events as Server-Sent Events until the client disconnects.
+// Owner scoped clients get events of their sessions only.
+func eventsHandler(source storage.EventSource) func(w http.ResponseWriter, req *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			errorMethodRequest(w, req)
+
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			jsonPrint(w, http.StatusInternalServerError, response.Response{Error: "streaming is not supported"})
+
+			return
+		}
+
+		// subject scoped clients see events of their own sessions only
+		owner := ownerOf(req)
+		sub := source.Subscribe(storage.DefaultEventsBuffer)
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(EventsKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-keepAlive.C:
+				// comment line keeps the connection alive
+				if _, err := w.Write([]byte(":\n\n")); err != nil {
+					return
+				}
+			case e, ok := <-sub.C:
+				if !ok {
+					return
+				}
+
+				if owner != "" && e.Owner != owner {
+					continue
+				}
+
+				data, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(e)
+				if err != nil {
+					logrus.Error(err.Error())
+
+					continue
+				}
+
+				if _, err := w.Write([]byte("event: " + string(e.Type) + "\ndata: " + string(data) + "\n\n")); err != nil {
+					return
+				}
+			}
+
+			flusher.Flush()
+		}
+	}
+}
+
 func healthCheck(w http.ResponseWriter, _ *http.Request) {
 	jsonPrint(w, http.StatusOK, map[string]bool{"ok": true})
 }
 
+// storageError is just helper. It converts storage errors to HTTP responses.
+func storageError(w http.ResponseWriter, err error) {
+	logrus.Error(err.Error())
+
+	status, message := storageStatus(err)
+	jsonPrint(w, status, response.Response{Error: message})
+}
+
+// storageStatus is just helper. It returns HTTP status and error message of the storage error.
+func storageStatus(err error) (int, string) {
+	switch err {
+	case storage.ErrNotFound:
+		return http.StatusNotFound, NotFoundError
+	case storage.ErrDataTooLarge:
+		return http.StatusRequestEntityTooLarge, err.Error()
+	case storage.ErrFull:
+		return http.StatusServiceUnavailable, err.Error()
+	case storage.ErrWrongData, storage.ErrWrongOwner, storage.ErrWrongTags, storage.ErrListCursor, storage.ErrListSort, storage.ErrListLimit:
+		return http.StatusBadRequest, err.Error()
+	}
+
+	return http.StatusInternalServerError, err.Error()
+}
+
+// isJSONRequest is just helper. It checks that request body is JSON.
+func isJSONRequest(req *http.Request) bool {
+	return strings.HasPrefix(req.Header.Get("Content-Type"), "application/json")
+}
+
+// readBody is just helper. It reads request body but no more then MaxRequestBodySize.
+func readBody(w http.ResponseWriter, req *http.Request) ([]byte, error) {
+	return io.ReadAll(http.MaxBytesReader(w, req.Body, MaxRequestBodySize))
+}
+
 // jsonPrint is just helper.
 func jsonPrint(w http.ResponseWriter, status int, data interface{}) {
 	if b, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(data); err == nil {
+		w.Header().Set("Content-Type", JSONContentType)
 		w.WriteHeader(status)
-		w.Header().Set("Content-Type", "application/json")
 		if _, err := w.Write(b); err != nil {
 			logrus.Error(err.Error())
 		}
@@ -142,22 +717,145 @@ func jsonPrint(w http.ResponseWriter, status int, data interface{}) {
 	}
 }
 
+// ownerOf is just helper. It returns the owner which limits sessions of the client or empty string.
+func ownerOf(req *http.Request) string {
+	if principal, ok := PrincipalFrom(req.Context()); ok {
+		return principal.Owner
+	}
+
+	return ""
+}
+
+// ownedBy is just helper. It checks that the client may see the session: the session exists
+// and belongs to the owner of the client (if the client is limited by owner).
+func ownedBy(keeper storage.SessionStore, req *http.Request, id string) bool {
+	owner := ownerOf(req)
+	if owner == "" {
+		return true
+	}
+
+	sessionOwner, find := keeper.Owner(id)
+
+	return find && sessionOwner == owner
+}
+
+// ownerFromPath is just helper. It returns the owner of /owners/{owner}/sessions path.
+func ownerFromPath(req *http.Request) string {
+	parts := splitPath(req.URL.Path)
+
+	return parts[len(parts)-2]
+}
+
+// ownerAllowed is just helper. It checks that the client may manage all sessions of the owner:
+// clients limited by owner manage their own sessions only, other clients need admin scope.
+// It writes 403 if it's not allowed.
+func ownerAllowed(w http.ResponseWriter, req *http.Request, owner string) bool {
+	principal, ok := PrincipalFrom(req.Context())
+	if !ok || (principal.Owner == "" && principal.Has(ScopeAdmin)) || (principal.Owner != "" && principal.Owner == owner) {
+		return true
+	}
+
+	jsonPrint(w, http.StatusForbidden, response.Response{Error: ForbiddenError})
+
+	return false
+}
+
+// tagQueryOf is just helper. It parses the tag query of the request limited by the owner of the client.
+// It writes 400 if the query is wrong.
+func tagQueryOf(w http.ResponseWriter, req *http.Request) (storage.TagQuery, bool) {
+	q, err := storage.ParseTagQuery(req.URL.Query().Get("q"))
+	if err != nil {
+		jsonPrint(w, http.StatusBadRequest, response.Response{Error: err.Error()})
+
+		return q, false
+	}
+	q.Owner = ownerOf(req)
+
+	return q, true
+}
+
+// isStreamRequest is just helper. It checks that the client asks for NDJSON stream by ?stream=1.
+func isStreamRequest(req *http.Request) bool {
+	switch req.URL.Query().Get("stream") {
+	case "1", "true":
+		return true
+	}
+
+	return false
+}
+
+// listFormatOf is just helper. It returns the format of sessions list: NDJSON for ?stream=1 or by Accept header.
+func listFormatOf(req *http.Request) (*listFormat, bool) {
+	if isStreamRequest(req) {
+		return ndjsonFormat, true
+	}
+
+	return negotiateList(req.Header.Get("Accept"))
+}
+
+// listParams are query parameters of the paged list.
+var listParams = []string{"limit", "cursor", "sort", "prefix", "min_ttl", "max_ttl"}
+
+// parseListQuery is just helper. It returns options of the paged list and false if there are no list parameters.
+func parseListQuery(req *http.Request) (storage.ListOptions, bool, error) {
+	query := req.URL.Query()
+
+	paged := false
+	for _, name := range listParams {
+		if _, ok := query[name]; ok {
+			paged = true
+		}
+	}
+
+	opts := storage.ListOptions{
+		Cursor: query.Get("cursor"),
+		Sort:   query.Get("sort"),
+		Prefix: query.Get("prefix"),
+	}
+
+	for name, value := range map[string]*int64{"min_ttl": &opts.MinTTL, "max_ttl": &opts.MaxTTL} {
+		if s := query.Get(name); s != "" {
+			if !OnlyNumbers.MatchString(s) {
+				return opts, paged, errors.New("wrong " + name)
+			}
+			*value, _ = strconv.ParseInt(s, 10, 64)
+		}
+	}
+
+	if s := query.Get("limit"); s != "" {
+		if !OnlyNumbers.MatchString(s) || len(s) > 9 {
+			return opts, paged, errors.New("wrong limit")
+		}
+		opts.Limit, _ = strconv.Atoi(s)
+		if opts.Limit == 0 {
+			return opts, paged, errors.New("wrong limit")
+		}
+	}
+
+	return opts, paged, nil
+}
+
 // OnlyNumbers checks on string has only digital.
 var OnlyNumbers = regexp.MustCompile(`^\d+$`)
 
 // parseURL is just helper. It's a wrapper over _parseURL.
-func parseURL(req *http.Request) (string, int, error) {
-	return _parseURL(req.URL.Path)
+func parseURL(req *http.Request, cfg Config) (string, int, error) {
+	return _parseURL(req.URL.Path, cfg)
 }
 
 // parseURL is just helper.
 // It returns id and ttl from url path if they are defined.
-func _parseURL(url string) (string, int, error) {
+func _parseURL(url string, cfg Config) (string, int, error) {
 	// POST, GET => /sessions
 	// DELETE => /sessions/{id}
 	// PUT => /sessions/{id}/{ttl}*
 	in := strings.Split(strings.TrimRight(strings.TrimLeft(url, "/"), "/"), "/")
 
+	// /namespaces/{name}/sessions/...
+	if len(in) > 2 && in[0] == namespacesPrefix {
+		in = in[2:]
+	}
+
 	if len(in) == 0 || in[0] != "sessions" {
 		return "", 0, errors.New(WrongPathError)
 	}
@@ -170,24 +868,32 @@ func _parseURL(url string) (string, int, error) {
 		id = in[1]
 	}
 
-	ttl := DefaultTTL
+	ttl := cfg.DefaultTTL
 	if len(in) > 2 {
 		// PUT => /sessions/{id}/{ttl}*  PUT
 		if !OnlyNumbers.MatchString(in[2]) {
 			return "", 0, errors.New(WrongTTLError)
 		}
 
-		var err error
-		ttl, err = strconv.ParseInt(in[2], 10, 64)
-		switch {
-		case err != nil:
+		value, err := strconv.ParseInt(in[2], 10, 64)
+		if err != nil {
 			return "", 0, errors.New(WrongTTLError)
-		case ttl < 0:
-			ttl = DefaultTTL
-		case ttl > MaxAllowedExtendedTTL:
-			ttl = MaxAllowedExtendedTTL
 		}
+		ttl = extendTTL(value, cfg)
 	}
 
 	return id, int(ttl), nil
 }
+
+// extendTTL is just helper. It limits TTL of extending by PUT /sessions/{id}/{ttl} and by batches:
+// 0 extends by nothing, larger TTL is reduced to cfg.MaxExtendedTTL.
+func extendTTL(ttl int64, cfg Config) int64 {
+	switch {
+	case ttl < 0:
+		return cfg.DefaultTTL
+	case ttl > cfg.MaxExtendedTTL:
+		return cfg.MaxExtendedTTL
+	}
+
+	return ttl
+}
@@ -5,46 +5,62 @@ import (
 )
 
 func (s *testSuite) TestParseURL(c *C) {
-	_, _, e := _parseURL("")
+	_, _, e := _parseURL("", DefaultConfig())
 	c.Assert(e, NotNil)
 
-	_, _, e = _parseURL("session")
+	_, _, e = _parseURL("session", DefaultConfig())
 	c.Assert(e, NotNil)
 
-	_, _, e = _parseURL("/sessions/bla-bla-bla")
+	_, _, e = _parseURL("/sessions/bla-bla-bla", DefaultConfig())
 	c.Assert(e, NotNil)
 
-	id, ttl, err := _parseURL("sessions")
+	id, ttl, err := _parseURL("sessions", DefaultConfig())
 	c.Assert(err, IsNil)
 	c.Assert(id, Equals, "")
 	c.Assert(ttl, Equals, 30)
 
-	id, ttl, err = _parseURL("sessions/")
+	id, ttl, err = _parseURL("sessions/", DefaultConfig())
 	c.Assert(err, IsNil)
 	c.Assert(id, Equals, "")
 	c.Assert(ttl, Equals, 30)
 
-	id, ttl, err = _parseURL("/sessions")
+	id, ttl, err = _parseURL("/sessions", DefaultConfig())
 	c.Assert(err, IsNil)
 	c.Assert(id, Equals, "")
 	c.Assert(ttl, Equals, 30)
 
 	testID := "c4d987da-8f47-49a0-8775-b28f39544e6c"
 
-	id, ttl, err = _parseURL("/sessions/" + testID)
+	id, ttl, err = _parseURL("/sessions/"+testID, DefaultConfig())
 	c.Assert(err, IsNil)
 	c.Assert(id, Equals, testID)
 	c.Assert(ttl, Equals, 30)
 
-	_, _, e = _parseURL("/sessions/" + testID + "/sadasdas")
+	_, _, e = _parseURL("/sessions/"+testID+"/sadasdas", DefaultConfig())
 	c.Assert(e, NotNil)
 
-	_, _, e = _parseURL("/sessions/" + testID + "/999999999999999999999999999999")
+	_, _, e = _parseURL("/sessions/"+testID+"/999999999999999999999999999999", DefaultConfig())
 	c.Assert(e, NotNil)
 
-	id, ttl, err = _parseURL("/sessions/" + testID + "/5000")
+	id, ttl, err = _parseURL("/sessions/"+testID+"/5000", DefaultConfig())
 	c.Assert(err, IsNil)
 	c.Assert(id, Equals, testID)
 	c.Assert(ttl, Equals, 300)
 
+	cfg := Config{DefaultTTL: 60, MaxExtendedTTL: 600}
+	_, ttl, err = _parseURL("/sessions/"+testID, cfg)
+	c.Assert(err, IsNil)
+	c.Assert(ttl, Equals, 60)
+
+	_, ttl, err = _parseURL("/sessions/"+testID+"/5000", cfg)
+	c.Assert(err, IsNil)
+	c.Assert(ttl, Equals, 600)
+
+	id, ttl, err = _parseURL("/namespaces/team-a/sessions/"+testID+"/50", cfg)
+	c.Assert(err, IsNil)
+	c.Assert(id, Equals, testID)
+	c.Assert(ttl, Equals, 50)
+
+	_, _, e = _parseURL("/namespaces/team-a", cfg)
+	c.Assert(e, NotNil)
 }
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/iostrovok/aura-test/storage"
+)
+
+/*
+	Metrics are exposed on /metrics in Prometheus text format.
+	Routes are templates of paths, so the number of series doesn't depend on session ids.
+	Metrics of storages have the label of their namespace.
+*/
+
+const metricsNamespace = "aura"
+
+// metrics keeps collectors of one server.
+type metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	limits   *prometheus.CounterVec
+}
+
+// newMetrics returns metrics of the server with storages of namespaces.
+func newMetrics(namespaces []Namespace) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		limits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "rate_limit_requests_total",
+			Help:      "Number of rate limited requests by route of limits and result (allowed or limited).",
+		}, []string{"route", "result"}),
+	}
+
+	m.registry.MustRegister(m.requests, m.latency, m.limits)
+	for _, ns := range namespaces {
+		if source, ok := ns.Store.(storage.StatsSource); ok {
+			m.registry.MustRegister(newStorageCollector(source, ns.Name))
+		}
+	}
+
+	return m
+}
+
+// handler returns the handler of /metrics.
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// instrument counts requests and measures their latency. route returns the template of the path.
+func (m *metrics) instrument(next http.Handler, route func(path string) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, req)
+
+		labels := prometheus.Labels{
+			"route":  route(req.URL.Path),
+			"method": req.Method,
+			"status": strconv.Itoa(sw.status),
+		}
+		m.requests.With(labels).Inc()
+		m.latency.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusWriter keeps the status of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Flush supports streaming of events.
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// storageCollector exports the state of the storage.
+type storageCollector struct {
+	source storage.StatsSource
+
+	sessions   *prometheus.Desc
+	bunchSize  *prometheus.Desc
+	memory     *prometheus.Desc
+	events     *prometheus.Desc
+	rejected   *prometheus.Desc
+	scans      *prometheus.Desc
+	scanTime   *prometheus.Desc
+	scanTimes  *prometheus.Desc
+	maxLag     *prometheus.Desc
+	averageLag *prometheus.Desc
+}
+
+func newStorageCollector(source storage.StatsSource, namespace string) *storageCollector {
+	labels := prometheus.Labels{"namespace": namespace}
+	desc := func(name, help string, variableLabels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", name), help, variableLabels, labels)
+	}
+
+	return &storageCollector{
+		source:     source,
+		sessions:   desc("sessions", "Number of stored sessions."),
+		bunchSize:  desc("bunch_sessions", "Number of stored sessions by bunches.", "bunch"),
+		memory:     desc("sessions_memory_bytes", "Estimated memory of stored sessions."),
+		events:     desc("sessions_total", "Number of session changes by type.", "event"),
+		rejected:   desc("sessions_rejected_total", "Number of sessions rejected by the full storage."),
+		scans:      desc("cleaner_scans_total", "Number of runs of cleaners."),
+		scanTime:   desc("cleaner_scan_seconds_total", "Total time of runs of cleaners."),
+		scanTimes:  desc("cleaner_scan_duration_seconds", "Time of runs of cleaners."),
+		maxLag:     desc("cleaner_lag_max_seconds", "Max delay between expiry and deleting of sessions."),
+		averageLag: desc("cleaner_lag_average_seconds", "Average delay between expiry and deleting of sessions."),
+	}
+}
+
+func (c *storageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.sessions
+	ch <- c.bunchSize
+	ch <- c.memory
+	ch <- c.events
+	ch <- c.rejected
+	ch <- c.scans
+	ch <- c.scanTime
+	ch <- c.scanTimes
+	ch <- c.maxLag
+	ch <- c.averageLag
+}
+
+func (c *storageCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.source.Stats()
+
+	ch <- prometheus.MustNewConstMetric(c.sessions, prometheus.GaugeValue, float64(stats.Sessions))
+	for i, size := range stats.BunchSizes {
+		ch <- prometheus.MustNewConstMetric(c.bunchSize, prometheus.GaugeValue, float64(size), strconv.Itoa(i))
+	}
+
+	for event, total := range map[storage.EventType]uint64{
+		storage.EventCreated:   stats.Created,
+		storage.EventExtended:  stats.Extended,
+		storage.EventDestroyed: stats.Destroyed,
+		storage.EventExpired:   stats.Expired,
+		storage.EventEvicted:   stats.Evicted,
+	} {
+		ch <- prometheus.MustNewConstMetric(c.events, prometheus.CounterValue, float64(total), string(event))
+	}
+	ch <- prometheus.MustNewConstMetric(c.memory, prometheus.GaugeValue, float64(stats.Memory))
+	ch <- prometheus.MustNewConstMetric(c.rejected, prometheus.CounterValue, float64(stats.Rejected))
+
+	ch <- prometheus.MustNewConstMetric(c.scans, prometheus.CounterValue, float64(stats.Cleaner.Scans))
+	ch <- prometheus.MustNewConstMetric(c.scanTime, prometheus.CounterValue, stats.Cleaner.ScanTime.Seconds())
+	buckets := make(map[float64]uint64, len(storage.ScanTimeBuckets))
+	for i, bucket := range storage.ScanTimeBuckets {
+		buckets[bucket.Seconds()] = stats.Cleaner.ScanTimes[i]
+	}
+	ch <- prometheus.MustNewConstHistogram(c.scanTimes, stats.Cleaner.Scans, stats.Cleaner.ScanTime.Seconds(), buckets)
+	ch <- prometheus.MustNewConstMetric(c.maxLag, prometheus.GaugeValue, stats.Cleaner.MaxLag.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.averageLag, prometheus.GaugeValue, stats.Cleaner.AverageLag.Seconds())
+}
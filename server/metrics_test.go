@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/iostrovok/check"
+
+	"github.com/iostrovok/aura-test/storage"
+)
+
+func (s *testSuite) TestMetrics(c *C) {
+	keeper := storage.New(context.Background())
+	cfg := DefaultConfig()
+	cfg.Namespaces = []Namespace{{Name: "team-a", Store: storage.New(context.Background())}}
+	ts := httptest.NewServer(newHandler(keeper, cfg))
+	defer ts.Close()
+
+	data := responseParser(c, CreateRequest(c, ts.URL, "10"))
+	c.Assert(ExtendRequest(c, ts.URL, data.ID, "100").StatusCode, Equals, http.StatusOK)
+	res, err := http.Get(ts.URL + "/sessions/" + data.ID)
+	c.Assert(err, IsNil)
+	readResponse(c, res)
+
+	res, err = http.Get(ts.URL + "/metrics")
+	c.Assert(err, IsNil)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	body := string(readResponse(c, res))
+
+	for _, line := range []string{
+		`aura_http_requests_total{method="POST",route="/sessions",status="200"} 1`,
+		`aura_http_requests_total{method="PUT",route="/sessions/{id}/{ttl}",status="200"} 1`,
+		`aura_http_requests_total{method="GET",route="/sessions/{id}",status="200"} 1`,
+		`aura_http_request_duration_seconds_count{method="GET",route="/sessions/{id}",status="200"} 1`,
+		`aura_sessions{namespace="default"} 1`,
+		`aura_sessions_total{event="created",namespace="default"} 1`,
+		`aura_sessions_total{event="extended",namespace="default"} 1`,
+		`aura_sessions_total{event="destroyed",namespace="default"} 0`,
+		`aura_sessions_total{event="evicted",namespace="default"} 0`,
+		`aura_sessions_rejected_total{namespace="default"} 0`,
+		`aura_sessions_memory_bytes{namespace="default"} 228`,
+		`aura_cleaner_scans_total{namespace="default"} `,
+		`aura_cleaner_scan_duration_seconds_bucket{namespace="default",le="0.001"} `,
+		`aura_cleaner_scan_duration_seconds_count{namespace="default"} `,
+		// each namespace has its own storage
+		`aura_sessions{namespace="team-a"} 0`,
+		`aura_sessions_total{event="created",namespace="team-a"} 0`,
+	} {
+		c.Assert(strings.Contains(body, line), Equals, true, Commentf("%s", line))
+	}
+
+	c.Assert(strings.Count(body, "aura_bunch_sessions{"), Equals, 2*storage.CountBunches)
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/iostrovok/aura-test/storage"
+)
+
+/*
+	Namespaces are isolated sets of sessions of several teams in one deployment:
+
+		/namespaces/{name}/sessions/...
+
+	has the same routes as /sessions/... over its own storage, so sessions of a namespace are not listed,
+	found or evicted by other namespaces. Each namespace has its own TTL limits and capacity (see storage.WithMaxSessions).
+	The root /sessions routes are the "default" namespace.
+*/
+
+const (
+	// DefaultNamespace is the name of the root /sessions routes for API keys.
+	DefaultNamespace = "default"
+	namespacesPrefix = "namespaces"
+)
+
+var (
+	ErrNamespace = errors.New("wrong namespace")
+
+	namespaceName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+)
+
+// Namespace is an isolated set of sessions.
+type Namespace struct {
+	Name           string
+	Store          storage.SessionStore
+	DefaultTTL     int64 // TTL of new sessions, Config.DefaultTTL if it's zero
+	MaxExtendedTTL int64 // limit of TTL for extending and sliding, Config.MaxExtendedTTL if it's zero
+}
+
+// ValidateNamespaces checks that names of namespaces are valid and unique. Stores are not checked.
+func ValidateNamespaces(namespaces []Namespace) error {
+	seen := make(map[string]bool, len(namespaces))
+	for _, ns := range namespaces {
+		switch {
+		case !namespaceName.MatchString(ns.Name) || ns.Name == DefaultNamespace:
+			return fmt.Errorf("%w: name %q should be 1-63 lowercase letters, digits, '-' or '_' and not %q",
+				ErrNamespace, ns.Name, DefaultNamespace)
+		case seen[ns.Name]:
+			return fmt.Errorf("%w: %q is duplicated", ErrNamespace, ns.Name)
+		case ns.DefaultTTL < 0 || ns.MaxExtendedTTL < 0:
+			return fmt.Errorf("%w: %q has negative TTL", ErrNamespace, ns.Name)
+		}
+		seen[ns.Name] = true
+	}
+
+	return nil
+}
+
+// config returns settings of HTTP server with TTL limits of the namespace.
+func (ns Namespace) config(cfg Config) Config {
+	if ns.DefaultTTL > 0 {
+		cfg.DefaultTTL = ns.DefaultTTL
+	}
+
+	if ns.MaxExtendedTTL > 0 {
+		cfg.MaxExtendedTTL = ns.MaxExtendedTTL
+	}
+
+	return cfg
+}
+
+// prefix returns the path prefix of the namespace routes.
+func (ns Namespace) prefix() string {
+	return "/" + namespacesPrefix + "/" + ns.Name
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/iostrovok/check"
+
+	"github.com/iostrovok/aura-test/jwt"
+	"github.com/iostrovok/aura-test/storage"
+)
+
+func (s *testSuite) TestNamespaces(c *C) {
+	ctx := context.Background()
+	keeper := storage.New(ctx)
+	teamA := storage.New(ctx, storage.WithMaxSessions(2), storage.WithMaxExtendedTTL(1000))
+	teamB := storage.New(ctx)
+
+	cfg := DefaultConfig()
+	cfg.Namespaces = []Namespace{
+		{Name: "team-a", Store: teamA, DefaultTTL: 100, MaxExtendedTTL: 1000},
+		{Name: "team-b", Store: teamB},
+	}
+
+	ts := httptest.NewServer(newHandler(keeper, cfg))
+	defer ts.Close()
+
+	urlA, urlB := ts.URL+"/namespaces/team-a", ts.URL+"/namespaces/team-b"
+
+	res := CreateRequest(c, urlA, "")
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	id := responseParser(c, res).ID
+
+	// the namespace has its own default TTL and limit of extending
+	session := getSession(c, urlA, id)
+	c.Assert(session.TTL, Equals, 100)
+	res = ExtendRequest(c, urlA, id, "5000")
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	readResponse(c, res)
+	c.Assert(getSession(c, urlA, id).TTL, Equals, 1000)
+
+	// sessions are not seen in other namespaces
+	checkRemoteAllInStorage(c, urlA, id)
+	checkRemoteEmptyAllInStorage(c, urlB)
+	checkRemoteEmptyAllInStorage(c, ts.URL)
+
+	res = GetRequest(c, urlB, id)
+	c.Assert(res.StatusCode, Equals, http.StatusNotFound)
+	readResponse(c, res)
+	res = DestroyRequest(c, ts.URL, id)
+	c.Assert(res.StatusCode, Equals, http.StatusNotFound)
+	readResponse(c, res)
+
+	// quota
+	res = CreateRequest(c, urlA, "")
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	readResponse(c, res)
+	res = CreateRequest(c, urlA, "")
+	c.Assert(res.StatusCode, Equals, http.StatusServiceUnavailable)
+	c.Assert(responseParser(c, res).Error, Equals, storage.ErrFull.Error())
+
+	res = CreateRequest(c, urlB, "")
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	readResponse(c, res)
+
+	res = CreateRequest(c, ts.URL+"/namespaces/team-c", "")
+	c.Assert(res.StatusCode, Equals, http.StatusNotFound)
+	readResponse(c, res)
+
+	res = DestroyRequest(c, urlA, id)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	readResponse(c, res)
+}
+
+func (s *testSuite) TestNamespacesAuth(c *C) {
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.Namespaces = []Namespace{{Name: "team-a", Store: storage.New(ctx)}}
+	cfg.APIKeys = []APIKey{
+		{Name: "a", Key: "a-key", Scopes: []Scope{ScopeAdmin}, Namespaces: []string{"team-a"}},
+		{Name: "root", Key: "root-key", Scopes: []Scope{ScopeAdmin}, Namespaces: []string{DefaultNamespace}},
+		{Name: "all", Key: "all-key", Scopes: []Scope{ScopeRead}},
+	}
+
+	ts := httptest.NewServer(newHandler(storage.New(ctx), cfg))
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		path, key string
+		status    int
+	}{
+		{"/namespaces/team-a/sessions", "a-key", http.StatusOK},
+		{"/sessions", "a-key", http.StatusForbidden},
+		{"/namespaces/team-a/sessions", "root-key", http.StatusForbidden},
+		{"/sessions", "root-key", http.StatusOK},
+		{"/namespaces/team-a/sessions", "all-key", http.StatusForbidden}, // scope
+		{"/metrics", "a-key", http.StatusOK},
+	} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+tc.path, nil)
+		c.Assert(err, IsNil)
+		req.Header.Set(APIKeyHeader, tc.key)
+		res, err := http.DefaultClient.Do(req)
+		c.Assert(err, IsNil)
+		c.Assert(res.StatusCode, Equals, tc.status, Commentf("%s %s", tc.path, tc.key))
+		readResponse(c, res)
+	}
+}
+
+func (s *testSuite) TestNamespacesJWT(c *C) {
+	keys, err := jwt.ParseKeySet([]byte(`{"keys": [{"kty": "oct", "k": "` + base64.RawURLEncoding.EncodeToString(jwtSecret) + `"}]}`))
+	c.Assert(err, IsNil)
+
+	ctx := context.Background()
+	cfg := DefaultConfig()
+	cfg.JWT = &jwt.Verifier{Keys: keys}
+	cfg.Namespaces = []Namespace{{Name: "team-a", Store: storage.New(ctx)}, {Name: "team-b", Store: storage.New(ctx)}}
+
+	ts := httptest.NewServer(newHandler(storage.New(ctx), cfg))
+	defer ts.Close()
+
+	teamA := signClaims(c, map[string]interface{}{"sub": "a", "scope": "read write", "ns": "team-a"})
+	both := signClaims(c, map[string]interface{}{"sub": "ab", "scope": "read write", "namespaces": []string{"team-a", "team-b"}})
+	none := signHS256(c, "root", "read write")
+
+	for _, tc := range []struct {
+		path, token string
+		status      int
+	}{
+		{"/namespaces/team-a/sessions", teamA, http.StatusOK},
+		{"/namespaces/team-b/sessions", teamA, http.StatusForbidden},
+		{"/sessions", teamA, http.StatusForbidden},
+		{"/namespaces/team-b/sessions", both, http.StatusOK},
+		// tokens without namespaces have access to the default namespace only
+		{"/sessions", none, http.StatusOK},
+		{"/namespaces/team-a/sessions", none, http.StatusForbidden},
+	} {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+tc.path, nil)
+		c.Assert(err, IsNil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		res, err := http.DefaultClient.Do(req)
+		c.Assert(err, IsNil)
+		c.Assert(res.StatusCode, Equals, tc.status, Commentf(tc.path))
+		readResponse(c, res)
+	}
+}
+
+func (s *testSuite) TestValidateNamespaces(c *C) {
+	c.Assert(ValidateNamespaces(nil), IsNil)
+	c.Assert(ValidateNamespaces([]Namespace{{Name: "team-a"}, {Name: "b_2"}}), IsNil)
+
+	for _, namespaces := range [][]Namespace{
+		{{Name: ""}},
+		{{Name: DefaultNamespace}},
+		{{Name: "Team"}},
+		{{Name: "team/a"}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", DefaultTTL: -1}},
+	} {
+		c.Assert(errors.Is(ValidateNamespaces(namespaces), ErrNamespace), Equals, true, Commentf("%+v", namespaces))
+	}
+}
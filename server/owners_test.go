@@ -0,0 +1,161 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/iostrovok/check"
+
+	"github.com/iostrovok/aura-test/jwt"
+	"github.com/iostrovok/aura-test/response"
+	"github.com/iostrovok/aura-test/storage"
+)
+
+func (s *testSuite) TestOwners(c *C) {
+	keeper := storage.New(context.Background(), storage.WithMaxOwnerSessions(3))
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
+	defer ts.Close()
+
+	ids := make([]string, 0)
+	for i := 0; i < 4; i++ {
+		res := JSONRequest(c, http.MethodPost, ts.URL+"/sessions", `{"ttl": 30, "owner": "user-1"}`)
+		c.Assert(res.StatusCode, Equals, http.StatusOK)
+		ids = append(ids, responseParser(c, res).ID)
+	}
+	res := JSONRequest(c, http.MethodPost, ts.URL+"/sessions", `{"ttl": 30, "owner": "user-2"}`)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	other := responseParser(c, res).ID
+
+	// the oldest session of the owner is evicted by the limit
+	res, err := http.Get(ts.URL + "/owners/user-1/sessions")
+	c.Assert(err, IsNil)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	c.Assert(res.Header.Get("Content-Type"), Equals, JSONContentType)
+	list := make([]response.List, 0)
+	c.Assert(json.Unmarshal(readResponse(c, res), &list), IsNil)
+	c.Assert(list, HasLen, 3)
+	for _, l := range list {
+		c.Assert(l.Owner, Equals, "user-1")
+		c.Assert(l.ID, Not(Equals), ids[0])
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/owners/user-1/sessions", nil)
+	c.Assert(err, IsNil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	res, err = http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	c.Assert(strings.Count(string(readResponse(c, res)), "\n"), Equals, 3)
+
+	// log out everywhere
+	req, err = http.NewRequest(http.MethodDelete, ts.URL+"/owners/user-1/sessions", nil)
+	c.Assert(err, IsNil)
+	res, err = http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	destroyed := response.Destroyed{}
+	c.Assert(json.Unmarshal(readResponse(c, res), &destroyed), IsNil)
+	c.Assert(destroyed.Destroyed, Equals, 3)
+
+	checkRemoteAllInStorage(c, ts.URL, other)
+	c.Assert(keeper.OwnerSessions("user-1"), HasLen, 0)
+}
+
+func (s *testSuite) TestOwnersAuth(c *C) {
+	keys, err := jwt.ParseKeySet([]byte(`{"keys": [{"kty": "oct", "k": "` + base64.RawURLEncoding.EncodeToString(jwtSecret) + `"}]}`))
+	c.Assert(err, IsNil)
+
+	keeper := storage.New(context.Background())
+	cfg := DefaultConfig()
+	cfg.JWT = &jwt.Verifier{Keys: keys}
+	cfg.JWTSubjectScope = true
+	cfg.APIKeys = []APIKey{
+		{Name: "writer", Key: "write-key", Scopes: []Scope{ScopeRead, ScopeWrite}},
+		{Name: "admin", Key: "admin-key", Scopes: []Scope{ScopeAdmin}},
+	}
+
+	ts := httptest.NewServer(newHandler(keeper, cfg))
+	defer ts.Close()
+
+	alice := signHS256(c, "alice", "read write")
+	_, _ = keeper.Create(30, storage.SessionOwner("alice"))
+	_, _ = keeper.Create(30, storage.SessionOwner("bob"))
+
+	for _, tc := range []struct {
+		method, path, body string
+		header, value      string
+		status             int
+	}{
+		// subjects create and manage their own sessions only
+		{http.MethodPost, "/sessions", `{"owner": "bob"}`, "Authorization", "Bearer " + alice, http.StatusForbidden},
+		{http.MethodPost, "/sessions", `{"owner": "alice"}`, "Authorization", "Bearer " + alice, http.StatusOK},
+		{http.MethodGet, "/owners/bob/sessions", "", "Authorization", "Bearer " + alice, http.StatusForbidden},
+		{http.MethodDelete, "/owners/bob/sessions", "", "Authorization", "Bearer " + alice, http.StatusForbidden},
+		{http.MethodGet, "/owners/alice/sessions", "", "Authorization", "Bearer " + alice, http.StatusOK},
+		// other clients need admin scope
+		{http.MethodGet, "/owners/bob/sessions", "", APIKeyHeader, "write-key", http.StatusForbidden},
+		{http.MethodGet, "/owners/bob/sessions", "", APIKeyHeader, "admin-key", http.StatusOK},
+		{http.MethodDelete, "/owners/alice/sessions", "", "Authorization", "Bearer " + alice, http.StatusOK},
+		{http.MethodDelete, "/owners/bob/sessions", "", APIKeyHeader, "admin-key", http.StatusOK},
+	} {
+		req, err := http.NewRequest(tc.method, ts.URL+tc.path, strings.NewReader(tc.body))
+		c.Assert(err, IsNil)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(tc.header, tc.value)
+		res, err := http.DefaultClient.Do(req)
+		c.Assert(err, IsNil)
+		c.Assert(res.StatusCode, Equals, tc.status, Commentf("%s %s %s", tc.method, tc.path, tc.value))
+		readResponse(c, res)
+	}
+
+	c.Assert(keeper.Len(), Equals, 0)
+}
+
+func (s *testSuite) TestOwnersEvents(c *C) {
+	keys, err := jwt.ParseKeySet([]byte(`{"keys": [{"kty": "oct", "k": "` + base64.RawURLEncoding.EncodeToString(jwtSecret) + `"}]}`))
+	c.Assert(err, IsNil)
+
+	keeper := storage.New(context.Background())
+	cfg := DefaultConfig()
+	cfg.JWT = &jwt.Verifier{Keys: keys}
+	cfg.JWTSubjectScope = true
+
+	ts := httptest.NewServer(newHandler(keeper, cfg))
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/sessions/events", nil)
+	c.Assert(err, IsNil)
+	req.Header.Set("Authorization", "Bearer "+signHS256(c, "alice", "admin"))
+	res, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	defer res.Body.Close()
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+
+	// events of sessions of other owners are not streamed
+	other, _ := keeper.Create(30, storage.SessionOwner("bob"))
+	own, _ := keeper.Create(30, storage.SessionOwner("alice"))
+	c.Assert(keeper.Destroy(other), Equals, true)
+	c.Assert(keeper.Destroy(own), Equals, true)
+
+	reader := bufio.NewReader(res.Body)
+	for _, eventType := range []storage.EventType{storage.EventCreated, storage.EventDestroyed} {
+		line, err := reader.ReadString('\n')
+		c.Assert(err, IsNil)
+		c.Assert(line, Equals, "event: "+string(eventType)+"\n")
+
+		line, err = reader.ReadString('\n')
+		c.Assert(err, IsNil)
+		e := storage.Event{}
+		c.Assert(json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e), IsNil)
+		c.Assert(e.ID, Equals, own)
+		c.Assert(e.Owner, Equals, "alice")
+
+		_, err = reader.ReadString('\n')
+		c.Assert(err, IsNil)
+	}
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/iostrovok/aura-test/response"
+)
+
+/*
+	Rate limits are token buckets of clients by routes. A client is the API key or the token subject
+	of the request or the remote IP if the request is not authenticated. Each request takes one token,
+	tokens are added with Rate per second up to Burst. Requests without tokens get 429 and Retry-After header.
+
+	Limits are taken from RateLimitSource on each request, so they may be changed without restarting
+	(see config.FileRateLimits). Buckets of idle clients are dropped.
+*/
+
+// Routes of rate limits.
+const (
+	RouteCreate  = "create"  // POST /sessions
+	RouteList    = "list"    // GET /sessions
+	RouteRead    = "read"    // GET and HEAD /sessions/{id}
+	RouteUpdate  = "update"  // PUT and PATCH /sessions/{id}
+	RouteDestroy = "destroy" // DELETE /sessions/{id}
+	RouteEvents  = "events"  // GET /sessions/events
+	RouteBatch   = "batch"   // POST /sessions:batch, its operations take tokens of create, update and destroy too
+
+	RateLimitedError       = "too many requests"
+	rateLimitSweepInterval = time.Minute
+)
+
+var (
+	ErrRateLimit = errors.New("wrong rate limit")
+
+	rateLimitRoutes = []string{RouteCreate, RouteList, RouteRead, RouteUpdate, RouteDestroy, RouteEvents, RouteBatch}
+)
+
+// RateLimit is a token bucket of a client: Rate tokens per second up to Burst tokens.
+// Zero burst means the rate rounded up (at least one token).
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// burst returns the size of the bucket.
+func (l RateLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+
+	return math.Max(1, math.Ceil(l.Rate))
+}
+
+// RateLimits are limits by routes. Routes without limits are not limited.
+type RateLimits map[string]RateLimit
+
+// RateLimits returns the limits themselves, so RateLimits is RateLimitSource of static limits.
+func (l RateLimits) RateLimits() RateLimits {
+	return l
+}
+
+// RateLimitSource returns the current limits.
+type RateLimitSource interface {
+	RateLimits() RateLimits
+}
+
+// ValidateRateLimits checks that routes are known and limits are positive.
+func ValidateRateLimits(limits RateLimits) error {
+	for route, limit := range limits {
+		known := false
+		for _, r := range rateLimitRoutes {
+			known = known || r == route
+		}
+
+		switch {
+		case !known:
+			return fmt.Errorf("%w: unknown route %q", ErrRateLimit, route)
+		case limit.Rate <= 0 || math.IsInf(limit.Rate, 0) || math.IsNaN(limit.Rate):
+			return fmt.Errorf("%w: rate of %q should be positive", ErrRateLimit, route)
+		case limit.Burst < 0:
+			return fmt.Errorf("%w: burst of %q is negative", ErrRateLimit, route)
+		}
+	}
+
+	return nil
+}
+
+// rateLimiter keeps buckets of clients.
+type rateLimiter struct {
+	source   RateLimitSource
+	requests *prometheus.CounterVec // by route and result
+	now      func() time.Time
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*bucket
+	swept   time.Time
+}
+
+type bucketKey struct {
+	route, client string
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newRateLimiter(source RateLimitSource, requests *prometheus.CounterVec) *rateLimiter {
+	return &rateLimiter{
+		source:   source,
+		requests: requests,
+		now:      time.Now,
+		buckets:  make(map[bucketKey]*bucket),
+	}
+}
+
+// limit returns the handler which takes a token of the client for the route.
+func (l *rateLimiter) limit(route string, h http.HandlerFunc) http.HandlerFunc {
+	if l.source == nil {
+		return h
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		if ok, wait := l.take(route, clientOf(req)); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			jsonPrint(w, http.StatusTooManyRequests, response.Response{Error: RateLimitedError})
+
+			return
+		}
+
+		h(w, req)
+	}
+}
+
+// allow takes a token of the client for the route if limits are set.
+func (l *rateLimiter) allow(route, client string) bool {
+	if l.source == nil {
+		return true
+	}
+
+	ok, _ := l.take(route, client)
+
+	return ok
+}
+
+// take takes a token of the client. It returns false and the time till the next token if the bucket is empty.
+func (l *rateLimiter) take(route, client string) (bool, time.Duration) {
+	limits := l.source.RateLimits()
+	limit, ok := limits[route]
+	if !ok {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(limits, now)
+
+	key := bucketKey{route: route, client: client}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit.burst(), updated: now}
+		l.buckets[key] = b
+	}
+	b.refill(limit, now)
+
+	if b.tokens < 1 {
+		l.requests.WithLabelValues(route, "limited").Inc()
+
+		return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	}
+
+	b.tokens--
+	l.requests.WithLabelValues(route, "allowed").Inc()
+
+	return true, 0
+}
+
+// sweep drops full buckets (clients which are idle long enough) once per rateLimitSweepInterval.
+func (l *rateLimiter) sweep(limits RateLimits, now time.Time) {
+	if now.Sub(l.swept) < rateLimitSweepInterval {
+		return
+	}
+	l.swept = now
+
+	for key, b := range l.buckets {
+		limit, ok := limits[key.route]
+		if ok {
+			b.refill(limit, now)
+		}
+
+		if !ok || b.tokens >= limit.burst() {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// refill adds tokens for the time since the last update. The limit may be changed since then.
+func (b *bucket) refill(limit RateLimit, now time.Time) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * limit.Rate
+		b.updated = now
+	}
+
+	b.tokens = math.Min(b.tokens, limit.burst())
+}
+
+// clientOf is just helper. It returns the key of the client: its name if it's authenticated or its IP.
+func clientOf(req *http.Request) string {
+	if principal, ok := PrincipalFrom(req.Context()); ok {
+		return "principal:" + principal.Name
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	return "ip:" + host
+}
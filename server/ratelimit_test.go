@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	. "github.com/iostrovok/check"
+
+	"github.com/iostrovok/aura-test/storage"
+)
+
+// helper.
+func newTestRateLimiter(limits RateLimits) (*rateLimiter, *time.Time) {
+	now := time.Unix(1600000000, 0)
+	l := newRateLimiter(limits, prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test"}, []string{"route", "result"}))
+	l.now = func() time.Time { return now }
+
+	return l, &now
+}
+
+func (s *testSuite) TestRateLimiter(c *C) {
+	limits := RateLimits{RouteCreate: {Rate: 2, Burst: 3}}
+	l, now := newTestRateLimiter(limits)
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.take(RouteCreate, "a")
+		c.Assert(ok, Equals, true)
+	}
+
+	ok, wait := l.take(RouteCreate, "a")
+	c.Assert(ok, Equals, false)
+	c.Assert(wait, Equals, 500*time.Millisecond)
+
+	// other clients and routes have their own buckets
+	ok, _ = l.take(RouteCreate, "b")
+	c.Assert(ok, Equals, true)
+	ok, _ = l.take(RouteList, "a")
+	c.Assert(ok, Equals, true)
+
+	*now = now.Add(time.Second)
+	for i := 0; i < 2; i++ {
+		ok, _ = l.take(RouteCreate, "a")
+		c.Assert(ok, Equals, true)
+	}
+	ok, _ = l.take(RouteCreate, "a")
+	c.Assert(ok, Equals, false)
+
+	// limits are changed on the fly
+	limits[RouteCreate] = RateLimit{Rate: 10}
+	*now = now.Add(100 * time.Millisecond)
+	ok, _ = l.take(RouteCreate, "a")
+	c.Assert(ok, Equals, true)
+
+	// idle clients are dropped
+	*now = now.Add(rateLimitSweepInterval)
+	ok, _ = l.take(RouteCreate, "c")
+	c.Assert(ok, Equals, true)
+	c.Assert(l.buckets, HasLen, 1)
+}
+
+func (s *testSuite) TestRateLimit(c *C) {
+	cfg := DefaultConfig()
+	cfg.RateLimits = RateLimits{RouteCreate: {Rate: 0.01, Burst: 2}}
+
+	ts := httptest.NewServer(newHandler(storage.New(context.Background()), cfg))
+	defer ts.Close()
+
+	for i := 0; i < 2; i++ {
+		res := CreateRequest(c, ts.URL, "")
+		c.Assert(res.StatusCode, Equals, http.StatusOK)
+		readResponse(c, res)
+	}
+
+	res := CreateRequest(c, ts.URL, "")
+	c.Assert(res.StatusCode, Equals, http.StatusTooManyRequests)
+	c.Assert(res.Header.Get("Retry-After"), Equals, "100")
+	c.Assert(responseParser(c, res).Error, Equals, RateLimitedError)
+
+	// other routes are not limited
+	res = ListRequest(c, ts.URL)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	readResponse(c, res)
+
+	res, err := http.Get(ts.URL + "/metrics")
+	c.Assert(err, IsNil)
+	metrics := string(readResponse(c, res))
+	c.Assert(strings.Contains(metrics, `aura_rate_limit_requests_total{result="allowed",route="create"} 2`), Equals, true)
+	c.Assert(strings.Contains(metrics, `aura_rate_limit_requests_total{result="limited",route="create"} 1`), Equals, true)
+}
+
+func (s *testSuite) TestValidateRateLimits(c *C) {
+	c.Assert(ValidateRateLimits(nil), IsNil)
+	c.Assert(ValidateRateLimits(RateLimits{RouteCreate: {Rate: 0.5}, RouteList: {Rate: 1, Burst: 10}}), IsNil)
+
+	for _, limits := range []RateLimits{
+		{"sessions": {Rate: 1}},
+		{RouteCreate: {Rate: 0}},
+		{RouteCreate: {Rate: -1}},
+		{RouteCreate: {Rate: 1, Burst: -1}},
+	} {
+		c.Assert(errors.Is(ValidateRateLimits(limits), ErrRateLimit), Equals, true, Commentf("%+v", limits))
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/iostrovok/aura-test/response"
+)
+
+/*
+	router is a table of routes: path pattern => method => handler.
+	Segments of the pattern in braces ("/sessions/{id}") match any non-empty segment of the path.
+	If several patterns match the path, the pattern with more literal segments wins ("/sessions/events"
+	is preferred to "/sessions/{id}"). Unknown paths get 404, known paths with wrong method get 405
+	and the Allow header.
+*/
+
+// otherRoute is a template of the unknown paths.
+const otherRoute = "other"
+
+type router struct {
+	routes []*routeEntry
+}
+
+type routeEntry struct {
+	pattern  string
+	parts    []string
+	literals int
+	handlers map[string]http.Handler
+}
+
+func newRouter() *router {
+	return &router{routes: make([]*routeEntry, 0)}
+}
+
+// handle registers the handler of the method and the path pattern.
+func (r *router) handle(method, pattern string, h http.Handler) {
+	entry := r.find(pattern)
+	if entry == nil {
+		entry = &routeEntry{pattern: pattern, parts: splitPath(pattern), handlers: make(map[string]http.Handler)}
+		for _, part := range entry.parts {
+			if !isParam(part) {
+				entry.literals++
+			}
+		}
+		r.routes = append(r.routes, entry)
+	}
+
+	entry.handlers[method] = h
+}
+
+// handleFunc registers the handler function of the method and the path pattern.
+func (r *router) handleFunc(method, pattern string, h func(w http.ResponseWriter, req *http.Request)) {
+	r.handle(method, pattern, http.HandlerFunc(h))
+}
+
+// find returns the route with the pattern.
+func (r *router) find(pattern string) *routeEntry {
+	for _, entry := range r.routes {
+		if entry.pattern == pattern {
+			return entry
+		}
+	}
+
+	return nil
+}
+
+// match returns the route of the path or nil.
+func (r *router) match(path string) *routeEntry {
+	parts := splitPath(path)
+
+	var best *routeEntry
+	for _, entry := range r.routes {
+		if entry.matches(parts) && (best == nil || entry.literals > best.literals) {
+			best = entry
+		}
+	}
+
+	return best
+}
+
+// template returns the pattern of the path or "other" for unknown paths.
+func (r *router) template(path string) string {
+	if entry := r.match(path); entry != nil {
+		return entry.pattern
+	}
+
+	return otherRoute
+}
+
+func (r *router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// catch exceptions
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.Errorf("%+v\n", r)
+		}
+	}()
+
+	entry := r.match(req.URL.Path)
+	if entry == nil {
+		jsonPrint(w, http.StatusNotFound, response.Response{Error: WrongPathError})
+
+		return
+	}
+
+	h, ok := entry.handlers[req.Method]
+	if !ok {
+		w.Header().Set("Allow", entry.allow())
+		errorMethodRequest(w, req)
+
+		return
+	}
+
+	h.ServeHTTP(w, req)
+}
+
+func (e *routeEntry) matches(parts []string) bool {
+	if len(parts) != len(e.parts) {
+		return false
+	}
+
+	for i, part := range e.parts {
+		if isParam(part) {
+			if parts[i] == "" {
+				return false
+			}
+		} else if part != parts[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// allow returns the value of the Allow header.
+func (e *routeEntry) allow() string {
+	methods := make([]string, 0, len(e.handlers))
+	for method := range e.handlers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	return strings.Join(methods, ", ")
+}
+
+// splitPath returns segments of the path without leading and trailing slashes.
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+func isParam(part string) bool {
+	return strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}")
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/iostrovok/check"
+)
+
+// helper.
+func newTestRouter() *router {
+	r := newRouter()
+	for _, route := range []struct{ method, pattern string }{
+		{http.MethodGet, "/sessions"},
+		{http.MethodPost, "/sessions"},
+		{http.MethodGet, "/sessions/{id}"},
+		{http.MethodDelete, "/sessions/{id}"},
+		{http.MethodPut, "/sessions/{id}/{ttl}"},
+		{http.MethodGet, "/sessions/events"},
+	} {
+		pattern := route.pattern
+		r.handleFunc(route.method, pattern, func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(pattern))
+		})
+	}
+
+	return r
+}
+
+func (s *testSuite) TestRouterTemplate(c *C) {
+	r := newTestRouter()
+	id := "c4d987da-8f47-49a0-8775-b28f39544e6c"
+
+	c.Assert(r.template("/sessions"), Equals, "/sessions")
+	c.Assert(r.template("/sessions/"), Equals, "/sessions")
+	c.Assert(r.template("/sessions/"+id), Equals, "/sessions/{id}")
+	c.Assert(r.template("/sessions/"+id+"/100"), Equals, "/sessions/{id}/{ttl}")
+	c.Assert(r.template("/sessions/events"), Equals, "/sessions/events")
+	c.Assert(r.template("/sessions//100"), Equals, otherRoute)
+	c.Assert(r.template("/"), Equals, otherRoute)
+	c.Assert(r.template("/bla/bla/bla/bla"), Equals, otherRoute)
+}
+
+func (s *testSuite) TestRouterServe(c *C) {
+	r := newTestRouter()
+
+	for _, test := range []struct {
+		method, path string
+		status       int
+		allow, body  string
+	}{
+		{http.MethodGet, "/sessions", http.StatusOK, "", "/sessions"},
+		{http.MethodPost, "/sessions", http.StatusOK, "", "/sessions"},
+		{http.MethodGet, "/sessions/events", http.StatusOK, "", "/sessions/events"},
+		{http.MethodDelete, "/sessions/some-id", http.StatusOK, "", "/sessions/{id}"},
+		{http.MethodPost, "/sessions/some-id", http.StatusMethodNotAllowed, "DELETE, GET", ""},
+		{http.MethodGet, "/sessions/some-id/10", http.StatusMethodNotAllowed, "PUT", ""},
+		{http.MethodPut, "/sessions", http.StatusMethodNotAllowed, "GET, POST", ""},
+		{http.MethodGet, "/anything/else", http.StatusNotFound, "", ""},
+		{http.MethodPost, "/", http.StatusNotFound, "", ""},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+
+		comment := Commentf("%s %s", test.method, test.path)
+		c.Assert(w.Code, Equals, test.status, comment)
+		c.Assert(w.Header().Get("Allow"), Equals, test.allow, comment)
+		if test.body != "" {
+			c.Assert(w.Body.String(), Equals, test.body, comment)
+		}
+	}
+}
@@ -2,51 +2,213 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/iostrovok/aura-test/jwt"
 	"github.com/iostrovok/aura-test/storage"
 )
 
-// Start is an entry point for HTTP server.
-func Start(ctx context.Context) {
-	keeper := storage.New(ctx)
-	mux := http.NewServeMux()
-	mux.HandleFunc("/healthcheck", healthCheck)
-	mux.HandleFunc("/", initSessionsHandlers(keeper))
+const (
+	// DefaultListen is a default address of HTTP server.
+	DefaultListen = ":8080"
+	// DefaultShutdownTimeout is a default time of draining connections on shutdown.
+	DefaultShutdownTimeout = 10 * time.Second
+)
+
+// Config is settings of HTTP server.
+type Config struct {
+	Listen         string // address to listen, see net/http.Server.Addr
+	DefaultTTL     int64  // TTL of new sessions and extending (seconds), the max TTL of new sessions
+	MaxExtendedTTL int64  // limit of TTL (seconds) for extending and sliding
+
+	ShutdownTimeout time.Duration // time of draining connections on shutdown
+
+	APIKeys []APIKey // keys of clients, authentication is disabled if it's empty and JWT is nil
+
+	JWT             *jwt.Verifier // verifier of bearer tokens, disabled if it's nil
+	JWTSubjectScope bool          // clients with tokens see only sessions of their subject
+
+	Namespaces []Namespace // isolated sets of sessions on /namespaces/{name}/sessions
+
+	RateLimits RateLimitSource // limits of clients by routes, disabled if it's nil
+
+	MaxBatchSize int // limit of operations of POST /sessions:batch, 0 - no limit
+}
+
+// DefaultConfig returns settings of HTTP server by default.
+func DefaultConfig() Config {
+	return Config{
+		Listen:         DefaultListen,
+		DefaultTTL:     DefaultTTL,
+		MaxExtendedTTL: MaxAllowedExtendedTTL,
+
+		ShutdownTimeout: DefaultShutdownTimeout,
+
+		MaxBatchSize: DefaultMaxBatchSize,
+	}
+}
+
+// Start is an entry point for HTTP server over the storage created by opts. The storage limits TTL of extending
+// by cfg.MaxExtendedTTL unless opts set other limit. It returns after shutdown (see StartWithStore)
+// when the storage is closed too.
+func Start(ctx context.Context, cfg Config, opts ...storage.Option) error {
+	opts = append([]storage.Option{storage.WithMaxExtendedTTL(uint32(cfg.MaxExtendedTTL))}, opts...)
+	keeper := storage.New(ctx, opts...)
+	err := StartWithStore(ctx, keeper, cfg)
+
+	if closeErr := keeper.Close(); closeErr != nil {
+		logrus.Errorf("close storage: %s", closeErr.Error())
+		if err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// StartWithStore starts HTTP server over any session storage backend.
+// It returns when the context is done or SIGINT/SIGTERM is received: new connections are not accepted
+// and active requests are drained during cfg.ShutdownTimeout. Event streams are closed at once.
+// The storage is not closed.
+func StartWithStore(ctx context.Context, keeper storage.SessionStore, cfg Config) error {
+	if err := ValidateNamespaces(cfg.Namespaces); err != nil {
+		return err
+	}
+
+	for _, ns := range cfg.Namespaces {
+		if ns.Store == nil {
+			return fmt.Errorf("%w: %q has no store", ErrNamespace, ns.Name)
+		}
+	}
+
+	// base context of all requests is canceled on shutdown, it stops long requests like event streams
+	base, stopRequests := context.WithCancel(context.Background())
+	defer stopRequests()
+
+	srv := &http.Server{
+		Addr:        cfg.Listen,
+		Handler:     newHandler(keeper, cfg),
+		BaseContext: func(net.Listener) context.Context { return base },
+	}
+	srv.RegisterOnShutdown(stopRequests)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
 
-	logrus.Infof("HTTP SERVER is starting...")
-	if err := http.ListenAndServe(":8080", mux); err != nil {
+	listenErr := make(chan error, 1)
+	go func() {
+		logrus.Infof("HTTP SERVER is starting...")
+		listenErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-listenErr:
 		logrus.Error(err.Error())
+
+		return err
+	case <-ctx.Done():
+		logrus.Infof("HTTP SERVER is stopping: %s", ctx.Err().Error())
+	case sig := <-signals:
+		logrus.Infof("HTTP SERVER is stopping: %s", sig.String())
+	}
+
+	return shutdown(srv, cfg.ShutdownTimeout)
+}
+
+// newHandler returns the handler of all paths.
+func newHandler(keeper storage.SessionStore, cfg Config) http.Handler {
+	namespaces := append([]Namespace{{Name: DefaultNamespace, Store: keeper}}, cfg.Namespaces...)
+	m := newMetrics(namespaces)
+	a := newAuth(cfg)
+	l := newRateLimiter(cfg.RateLimits, m.limits)
+
+	r := newRouter()
+	r.handleFunc(http.MethodGet, "/healthcheck", healthCheck)
+	r.handleFunc(http.MethodGet, "/metrics", a.require(ScopeRead, m.handler().ServeHTTP))
+	initSessionsHandlers(r, a, l, namespaces[0], "", cfg)
+	for _, ns := range cfg.Namespaces {
+		initSessionsHandlers(r, a, l, ns, ns.prefix(), ns.config(cfg))
 	}
+
+	return m.instrument(r, r.template)
 }
 
-// initSessionsHandlers provides function for "/sessions" path.
-func initSessionsHandlers(keeper *storage.Storage) func(w http.ResponseWriter, req *http.Request) {
-	logrus.Infof("HTTP SERVER is making handlers...")
-
-	return func(w http.ResponseWriter, req *http.Request) {
-		// catch exceptions
-		defer func() {
-			if r := recover(); r != nil {
-				logrus.Errorf("%+v\n", r)
-			}
-		}()
-
-		switch req.Method {
-		case http.MethodPost: // create new session
-			createSessionHandler(keeper, w, req)
-		case http.MethodGet: // list of all session
-			listSessionsHandler(keeper, w, req)
-		case http.MethodPut: // extend the session
-			extendHandler(keeper, w, req)
-		case http.MethodDelete: // Destroy the session
-			destroyHandler(keeper, w, req)
-		default:
-			errorMethodRequest(w, req)
+// shutdown stops the server gracefully. Connections which are still active after timeout are closed.
+func shutdown(srv *http.Server, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		logrus.Errorf("HTTP SERVER shutdown: %s", err.Error())
+		if errors.Is(err, context.DeadlineExceeded) {
+			_ = srv.Close()
 		}
+
+		return err
+	}
+
+	logrus.Infof("HTTP SERVER is stopped, all connections are drained")
+
+	return nil
+}
+
+// sessionHandler is a handler of sessions.
+type sessionHandler func(keeper storage.SessionStore, cfg Config, w http.ResponseWriter, req *http.Request)
+
+// initSessionsHandlers registers routes of sessions of the namespace under the prefix, their scopes and rate limits.
+func initSessionsHandlers(r *router, a *auth, l *rateLimiter, ns Namespace, prefix string, cfg Config) {
+	logrus.Infof("HTTP SERVER is making handlers of %s namespace...", ns.Name)
+
+	keeper := ns.Store
+	guard := func(scope Scope, route string, h http.HandlerFunc) func(w http.ResponseWriter, req *http.Request) {
+		return a.requireIn(ns.Name, scope, l.limit(route, h))
+	}
+	bind := func(scope Scope, route string, h sessionHandler) func(w http.ResponseWriter, req *http.Request) {
+		return guard(scope, route, func(w http.ResponseWriter, req *http.Request) {
+			h(keeper, cfg, w, req)
+		})
+	}
+
+	if source, ok := keeper.(storage.EventSource); ok {
+		r.handleFunc(http.MethodGet, prefix+"/sessions/events", guard(ScopeAdmin, RouteEvents, eventsHandler(source)))
+	}
+
+	r.handleFunc(http.MethodPost, prefix+"/sessions", bind(ScopeWrite, RouteCreate, createSessionHandler)) // create new session
+	r.handleFunc(http.MethodPost, prefix+"/sessions:batch", bind(ScopeWrite, RouteBatch, batchHandler(l))) // create, extend and destroy sessions
+	r.handleFunc(http.MethodGet, prefix+"/sessions", guard(ScopeAdmin, RouteList, func(w http.ResponseWriter, req *http.Request) {
+		listSessionsHandler(keeper, w, req) // list of all session
+	}))
+
+	if index, ok := keeper.(storage.OwnerIndex); ok {
+		r.handleFunc(http.MethodGet, prefix+"/owners/{owner}/sessions", guard(ScopeRead, RouteList, ownerSessionsHandler(index)))       // sessions of the owner
+		r.handleFunc(http.MethodDelete, prefix+"/owners/{owner}/sessions", guard(ScopeWrite, RouteDestroy, destroyOwnerHandler(index))) // log out everywhere
 	}
+
+	if index, ok := keeper.(storage.TagIndex); ok {
+		r.handleFunc(http.MethodGet, prefix+"/tags/sessions", guard(ScopeAdmin, RouteList, taggedSessionsHandler(index)))      // sessions by tag query
+		r.handleFunc(http.MethodDelete, prefix+"/tags/sessions", guard(ScopeAdmin, RouteDestroy, destroyTaggedHandler(index))) // destroy sessions by tag query
+	}
+
+	r.handleFunc(http.MethodGet, prefix+"/sessions/{id}", bind(ScopeRead, RouteRead, getSessionHandler))      // one session
+	r.handleFunc(http.MethodHead, prefix+"/sessions/{id}", bind(ScopeRead, RouteRead, headSessionHandler))    // check the session exists
+	r.handleFunc(http.MethodPut, prefix+"/sessions/{id}", bind(ScopeWrite, RouteUpdate, extendHandler))       // extend the session and replace its data
+	r.handleFunc(http.MethodPatch, prefix+"/sessions/{id}", bind(ScopeWrite, RouteUpdate, updateDataHandler)) // update the session data
+	r.handleFunc(http.MethodDelete, prefix+"/sessions/{id}", bind(ScopeWrite, RouteDestroy, destroyHandler))  // destroy the session
+	r.handleFunc(http.MethodPut, prefix+"/sessions/{id}/{ttl}", bind(ScopeWrite, RouteUpdate, extendHandler)) // extend the session by TTL
 }
 
 // errorMethodRequest is helper. It returns error about wrong HTTP method.
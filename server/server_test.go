@@ -1,13 +1,18 @@
 package server
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -117,19 +122,32 @@ func (s *testSuite) TestBuild(c *C) {
 	ctx := context.Background()
 	keeper := storage.New(ctx)
 
-	ts := httptest.NewServer(http.HandlerFunc(initSessionsHandlers(keeper)))
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
 	defer ts.Close()
 
-	res, err := http.Get(ts.URL)
+	res, err := http.Get(ts.URL + "/sessions")
 	c.Assert(err, IsNil)
 	c.Assert(string(readResponse(c, res)), Equals, "[]")
+
+	// unknown path
+	res, err = http.Get(ts.URL)
+	c.Assert(err, IsNil)
+	readResponse(c, res)
+	c.Assert(res.StatusCode, Equals, http.StatusNotFound)
+
+	// creating is not allowed for the session path
+	res, err = http.Post(ts.URL+"/sessions/c4d987da-8f47-49a0-8775-b28f39544e6c", "", nil)
+	c.Assert(err, IsNil)
+	readResponse(c, res)
+	c.Assert(res.StatusCode, Equals, http.StatusMethodNotAllowed)
+	c.Assert(res.Header.Get("Allow"), Equals, "DELETE, GET, HEAD, PATCH, PUT")
 }
 
 func (s *testSuite) TestCreate(c *C) {
 	ctx := context.Background()
 	keeper := storage.New(ctx)
 
-	ts := httptest.NewServer(http.HandlerFunc(initSessionsHandlers(keeper)))
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
 	defer ts.Close()
 
 	data := responseParser(c, CreateRequest(c, ts.URL, ""))
@@ -141,7 +159,7 @@ func (s *testSuite) TestCreateDelete(c *C) {
 	ctx := context.Background()
 	keeper := storage.New(ctx)
 
-	ts := httptest.NewServer(http.HandlerFunc(initSessionsHandlers(keeper)))
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
 	defer ts.Close()
 
 	data := responseParser(c, CreateRequest(c, ts.URL, ""))
@@ -161,7 +179,7 @@ func (s *testSuite) TestDelete404(c *C) {
 	ctx := context.Background()
 	keeper := storage.New(ctx)
 
-	ts := httptest.NewServer(http.HandlerFunc(initSessionsHandlers(keeper)))
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
 	defer ts.Close()
 
 	data := responseParser(c, CreateRequest(c, ts.URL, "1"))
@@ -174,23 +192,25 @@ func (s *testSuite) TestDelete404(c *C) {
 
 func (s *testSuite) TestExpired(c *C) {
 	ctx := context.Background()
-	keeper := storage.New(ctx)
+	clock := storage.NewManualClock(time.Now())
+	keeper := storage.New(ctx, storage.WithClock(clock))
 
-	ts := httptest.NewServer(http.HandlerFunc(initSessionsHandlers(keeper)))
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
 	defer ts.Close()
 
 	data := responseParser(c, CreateRequest(c, ts.URL, "1"))
 	checkRemoteAllInStorage(c, ts.URL, data.ID)
 
-	time.Sleep(2 * time.Second)
+	clock.Add(2 * time.Second)
 	checkRemoteEmptyAllInStorage(c, ts.URL)
 }
 
 func (s *testSuite) TestExtend(c *C) {
 	ctx := context.Background()
-	keeper := storage.New(ctx)
+	clock := storage.NewManualClock(time.Now())
+	keeper := storage.New(ctx, storage.WithClock(clock))
 
-	ts := httptest.NewServer(http.HandlerFunc(initSessionsHandlers(keeper)))
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
 	defer ts.Close()
 
 	data := responseParser(c, CreateRequest(c, ts.URL, "1"))
@@ -199,7 +219,7 @@ func (s *testSuite) TestExtend(c *C) {
 	rep := ExtendRequest(c, ts.URL, data.ID, "10")
 	c.Assert(rep.StatusCode, Equals, http.StatusOK)
 
-	time.Sleep(2 * time.Second)
+	clock.Add(2 * time.Second)
 	checkRemoteAllInStorage(c, ts.URL, data.ID)
 }
 
@@ -207,7 +227,7 @@ func (s *testSuite) TestWrongMethod(c *C) {
 	ctx := context.Background()
 	keeper := storage.New(ctx)
 
-	ts := httptest.NewServer(http.HandlerFunc(initSessionsHandlers(keeper)))
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
 	defer ts.Close()
 
 	client := http.Client{}
@@ -225,7 +245,7 @@ func (s *testSuite) TestList(c *C) {
 	ctx := context.Background()
 	keeper := storage.New(ctx)
 
-	ts := httptest.NewServer(http.HandlerFunc(initSessionsHandlers(keeper)))
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
 	defer ts.Close()
 
 	for i := 0; i < 1000; i++ {
@@ -243,3 +263,475 @@ func (s *testSuite) TestList(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(len(data), Equals, 1000)
 }
+
+func (s *testSuite) TestListPages(c *C) {
+	ctx := context.Background()
+	keeper := storage.New(ctx)
+
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
+	defer ts.Close()
+
+	for i := 0; i < 25; i++ {
+		_, _ = keeper.Create(uint32(10 + i))
+	}
+
+	ids := map[string]bool{}
+	cursor := ""
+	for {
+		res, err := http.Get(ts.URL + "/sessions?limit=10&sort=-ttl&cursor=" + cursor)
+		c.Assert(err, IsNil)
+		c.Assert(res.StatusCode, Equals, http.StatusOK)
+
+		page := &response.ListPage{}
+		c.Assert(json.Unmarshal(readResponse(c, res), page), IsNil)
+		c.Assert(page.Total, Equals, 25)
+		for _, l := range page.Sessions {
+			ids[l.ID] = true
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	c.Assert(ids, HasLen, 25)
+
+	res, err := http.Get(ts.URL + "/sessions?min_ttl=30")
+	c.Assert(err, IsNil)
+	page := &response.ListPage{}
+	c.Assert(json.Unmarshal(readResponse(c, res), page), IsNil)
+	c.Assert(page.Total >= 4 && page.Total <= 5, Equals, true)
+
+	for _, query := range []string{"limit=0", "limit=5000", "limit=x", "sort=data", "cursor=bad", "max_ttl=-1"} {
+		res, err := http.Get(ts.URL + "/sessions?" + query)
+		c.Assert(err, IsNil)
+		c.Assert(res.StatusCode, Equals, http.StatusBadRequest, Commentf(query))
+		readResponse(c, res)
+	}
+}
+
+func (s *testSuite) TestListStream(c *C) {
+	ctx := context.Background()
+	keeper := storage.New(ctx)
+
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
+	defer ts.Close()
+
+	for i := 0; i < 300; i++ {
+		_, _ = keeper.Create(30)
+	}
+
+	long := make(map[string]bool)
+	for i := 0; i < 5; i++ {
+		id, _ := keeper.Create(100)
+		long[id] = true
+	}
+
+	stream := func(req *http.Request) []response.List {
+		res, err := http.DefaultClient.Do(req)
+		c.Assert(err, IsNil)
+		c.Assert(res.StatusCode, Equals, http.StatusOK)
+		c.Assert(res.Header.Get("Content-Type"), Equals, NDJSONContentType)
+
+		out := make([]response.List, 0)
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			l := response.List{}
+			c.Assert(json.Unmarshal(scanner.Bytes(), &l), IsNil)
+			c.Assert(len(l.ID), Equals, 36)
+			out = append(out, l)
+		}
+		res.Body.Close()
+
+		return out
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/sessions", nil)
+	c.Assert(err, IsNil)
+	req.Header.Set("Accept", NDJSONContentType)
+	c.Assert(stream(req), HasLen, 305)
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/sessions?stream=1", nil)
+	c.Assert(err, IsNil)
+	c.Assert(stream(req), HasLen, 305)
+
+	// list parameters filter and sort the stream
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/sessions?stream=1&min_ttl=50", nil)
+	c.Assert(err, IsNil)
+	list := stream(req)
+	c.Assert(list, HasLen, 5)
+	for _, l := range list {
+		c.Assert(long[l.ID], Equals, true)
+	}
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/sessions?stream=1&sort=-ttl&limit=2", nil)
+	c.Assert(err, IsNil)
+	list = stream(req)
+	c.Assert(list, HasLen, 305)
+	for i, l := range list {
+		c.Assert(long[l.ID], Equals, i < 5)
+	}
+
+	prefix := list[0].ID[:2]
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/sessions?stream=1&prefix="+prefix, nil)
+	c.Assert(err, IsNil)
+	list = stream(req)
+	c.Assert(len(list) > 0, Equals, true)
+	for _, l := range list {
+		c.Assert(strings.HasPrefix(l.ID, prefix), Equals, true)
+	}
+
+	res, err := http.Get(ts.URL + "/sessions?stream=1&sort=data")
+	c.Assert(err, IsNil)
+	c.Assert(res.StatusCode, Equals, http.StatusBadRequest)
+	readResponse(c, res)
+}
+
+func (s *testSuite) TestListFormats(c *C) {
+	ctx := context.Background()
+	keeper := storage.New(ctx)
+
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
+	defer ts.Close()
+
+	for i := 0; i < 3; i++ {
+		_, _ = keeper.Create(30)
+	}
+
+	get := func(path, accept string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		c.Assert(err, IsNil)
+		req.Header.Set("Accept", accept)
+		res, err := http.DefaultClient.Do(req)
+		c.Assert(err, IsNil)
+
+		return res
+	}
+
+	// negotiated JSON has its content type as other formats
+	for _, path := range []string{"/sessions", "/sessions?limit=2"} {
+		res := get(path, JSONContentType)
+		c.Assert(res.StatusCode, Equals, http.StatusOK)
+		c.Assert(res.Header.Get("Content-Type"), Equals, JSONContentType, Commentf(path))
+		readResponse(c, res)
+	}
+
+	res := get("/sessions", "text/csv")
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	c.Assert(res.Header.Get("Content-Type"), Equals, CSVContentType)
+	c.Assert(strings.Count(string(readResponse(c, res)), "\n"), Equals, 4)
+
+	// page of CSV has total and cursor in headers
+	res = get("/sessions?limit=2", "text/csv")
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	c.Assert(res.Header.Get(TotalCountHeader), Equals, "3")
+	c.Assert(res.Header.Get(NextCursorHeader), Not(Equals), "")
+	c.Assert(strings.Count(string(readResponse(c, res)), "\n"), Equals, 3)
+
+	res = get("/sessions", "image/png")
+	c.Assert(res.StatusCode, Equals, http.StatusNotAcceptable)
+	c.Assert(responseParser(c, res).Error, Equals, NotAcceptableError)
+}
+
+func JSONRequest(c *C, method, url, body string) *http.Response {
+	client := &http.Client{}
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	c.Assert(err, IsNil)
+	req.Header.Add("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	c.Assert(err, IsNil)
+
+	return resp
+}
+
+func GetRequest(c *C, url, id string) *http.Response {
+	res, err := http.Get(url + "/sessions/" + id)
+	c.Assert(err, IsNil)
+
+	return res
+}
+
+// helper.
+func getSession(c *C, url, id string) *response.Session {
+	res := GetRequest(c, url, id)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+
+	out := &response.Session{}
+	c.Assert(json.Unmarshal(readResponse(c, res), out), IsNil)
+
+	return out
+}
+
+func (s *testSuite) TestSessionData(c *C) {
+	ctx := context.Background()
+	keeper := storage.New(ctx)
+
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
+	defer ts.Close()
+
+	data := responseParser(c, JSONRequest(c, http.MethodPost, ts.URL+"/sessions", `{"ttl":10,"data":{"user":"bla"}}`))
+	c.Assert(data.Error, Equals, "")
+
+	session := getSession(c, ts.URL, data.ID)
+	c.Assert(session.ID, Equals, data.ID)
+	c.Assert(session.TTL > 0 && session.TTL <= 10, Equals, true)
+	c.Assert(string(session.Data), Equals, `{"user":"bla"}`)
+
+	res := JSONRequest(c, http.MethodPatch, ts.URL+"/sessions/"+data.ID, `{"roles":["admin"]}`)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	c.Assert(string(getSession(c, ts.URL, data.ID).Data), Equals, `{"roles":["admin"],"user":"bla"}`)
+
+	res = JSONRequest(c, http.MethodPut, ts.URL+"/sessions/"+data.ID+"/100", `{"user":"other"}`)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	session = getSession(c, ts.URL, data.ID)
+	c.Assert(string(session.Data), Equals, `{"user":"other"}`)
+	c.Assert(session.TTL > 10, Equals, true)
+
+	list := make([]*response.List, 0)
+	c.Assert(json.Unmarshal(readResponse(c, ListRequest(c, ts.URL)), &list), IsNil)
+	c.Assert(list, HasLen, 1)
+	c.Assert(list[0].DataSize, Equals, len(`{"user":"other"}`))
+}
+
+func (s *testSuite) TestSessionDataErrors(c *C) {
+	ctx := context.Background()
+	keeper := storage.New(ctx)
+
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
+	defer ts.Close()
+
+	res := JSONRequest(c, http.MethodPost, ts.URL+"/sessions", `{"ttl":10,"data":[1,2]}`)
+	c.Assert(res.StatusCode, Equals, http.StatusBadRequest)
+
+	res = JSONRequest(c, http.MethodPost, ts.URL+"/sessions", `{"ttl":10`)
+	c.Assert(res.StatusCode, Equals, http.StatusBadRequest)
+
+	big := `{"data":"` + strings.Repeat("a", storage.DefaultMaxDataSize) + `"}`
+	res = JSONRequest(c, http.MethodPost, ts.URL+"/sessions", `{"data":`+big+`}`)
+	c.Assert(res.StatusCode, Equals, http.StatusRequestEntityTooLarge)
+
+	res = GetRequest(c, ts.URL, "790c72b9-0000-0000-0000-000000000000")
+	c.Assert(res.StatusCode, Equals, http.StatusNotFound)
+
+	res = JSONRequest(c, http.MethodPatch, ts.URL+"/sessions/790c72b9-0000-0000-0000-000000000000", `{}`)
+	c.Assert(res.StatusCode, Equals, http.StatusNotFound)
+}
+
+func HeadRequest(c *C, url, id string) *http.Response {
+	res, err := http.Head(url + "/sessions/" + id)
+	c.Assert(err, IsNil)
+	res.Body.Close()
+
+	return res
+}
+
+func (s *testSuite) TestGetSession(c *C) {
+	ctx := context.Background()
+	keeper := storage.New(ctx)
+
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
+	defer ts.Close()
+
+	data := responseParser(c, CreateRequest(c, ts.URL, "10"))
+
+	session := getSession(c, ts.URL, data.ID)
+	c.Assert(session.ID, Equals, data.ID)
+	c.Assert(session.TTL > 0 && session.TTL <= 10, Equals, true)
+
+	res := HeadRequest(c, ts.URL, data.ID)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	c.Assert(res.Header.Get(SessionTTLHeader), Equals, strconv.Itoa(session.TTL))
+
+	c.Assert(DestroyRequest(c, ts.URL, data.ID).StatusCode, Equals, http.StatusOK)
+
+	res = GetRequest(c, ts.URL, data.ID)
+	c.Assert(res.StatusCode, Equals, http.StatusNotFound)
+	c.Assert(responseParser(c, res).Error, Equals, NotFoundError)
+
+	res = HeadRequest(c, ts.URL, data.ID)
+	c.Assert(res.StatusCode, Equals, http.StatusNotFound)
+}
+
+func (s *testSuite) TestSlidingSession(c *C) {
+	ctx := context.Background()
+	keeper := storage.New(ctx)
+
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
+	defer ts.Close()
+
+	data := responseParser(c, JSONRequest(c, http.MethodPost, ts.URL+"/sessions", `{"ttl":5,"slide":100}`))
+	c.Assert(data.Error, Equals, "")
+
+	// HEAD doesn't slide the session
+	res := HeadRequest(c, ts.URL, data.ID)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	ttl, err := strconv.Atoi(res.Header.Get(SessionTTLHeader))
+	c.Assert(err, IsNil)
+	c.Assert(ttl > 0 && ttl <= 5, Equals, true)
+	peeked, find := keeper.Peek(data.ID)
+	c.Assert(find, Equals, true)
+	c.Assert(peeked.TTL <= 5, Equals, true)
+
+	session := getSession(c, ts.URL, data.ID)
+	c.Assert(session.TTL > 5 && session.TTL <= 100, Equals, true)
+}
+
+func (s *testSuite) TestMaxLifetime(c *C) {
+	ctx := context.Background()
+	keeper := storage.New(ctx, storage.WithMaxLifetime(20))
+
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
+	defer ts.Close()
+
+	// default max lifetime
+	data := responseParser(c, CreateRequest(c, ts.URL, "10"))
+	c.Assert(ExtendRequest(c, ts.URL, data.ID, "300").StatusCode, Equals, http.StatusOK)
+	session := getSession(c, ts.URL, data.ID)
+	c.Assert(session.TTL > 10 && session.TTL <= 20, Equals, true)
+	c.Assert(session.AbsoluteTTL > 10 && session.AbsoluteTTL <= 20, Equals, true)
+
+	// max lifetime of the request
+	data = responseParser(c, JSONRequest(c, http.MethodPost, ts.URL+"/sessions", `{"ttl":10,"max_lifetime":15}`))
+	c.Assert(ExtendRequest(c, ts.URL, data.ID, "300").StatusCode, Equals, http.StatusOK)
+	session = getSession(c, ts.URL, data.ID)
+	c.Assert(session.TTL > 10 && session.TTL <= 15, Equals, true)
+
+	list := make([]*response.List, 0)
+	c.Assert(json.Unmarshal(readResponse(c, ListRequest(c, ts.URL)), &list), IsNil)
+	c.Assert(list, HasLen, 2)
+	for _, l := range list {
+		c.Assert(l.AbsoluteTTL > 10 && l.AbsoluteTTL <= 20, Equals, true)
+	}
+}
+
+func (s *testSuite) TestEvents(c *C) {
+	ctx := context.Background()
+	keeper := storage.New(ctx)
+
+	ts := httptest.NewServer(http.HandlerFunc(eventsHandler(keeper)))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/sessions/events")
+	c.Assert(err, IsNil)
+	defer res.Body.Close()
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	c.Assert(res.Header.Get("Content-Type"), Equals, "text/event-stream")
+
+	id, err := keeper.Create(10)
+	c.Assert(err, IsNil)
+	c.Assert(keeper.Destroy(id), Equals, true)
+
+	reader := bufio.NewReader(res.Body)
+	for _, eventType := range []storage.EventType{storage.EventCreated, storage.EventDestroyed} {
+		line, err := reader.ReadString('\n')
+		c.Assert(err, IsNil)
+		c.Assert(line, Equals, "event: "+string(eventType)+"\n")
+
+		line, err = reader.ReadString('\n')
+		c.Assert(err, IsNil)
+		c.Assert(strings.HasPrefix(line, "data: "), Equals, true)
+
+		e := storage.Event{}
+		c.Assert(json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e), IsNil)
+		c.Assert(e.Type, Equals, eventType)
+		c.Assert(e.ID, Equals, id)
+
+		line, err = reader.ReadString('\n')
+		c.Assert(err, IsNil)
+		c.Assert(line, Equals, "\n")
+	}
+}
+
+func (s *testSuite) TestShutdown(c *C) {
+	// free port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	address := l.Addr().String()
+	c.Assert(l.Close(), IsNil)
+
+	cfg := DefaultConfig()
+	cfg.Listen = address
+	cfg.ShutdownTimeout = time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+	keeper := storage.New(ctx)
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- StartWithStore(ctx, keeper, cfg)
+	}()
+
+	url := "http://" + address
+	for i := 0; i < 100; i++ {
+		if _, err = http.Get(url + "/sessions"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(err, IsNil)
+
+	// event stream doesn't block the shutdown
+	res, err := http.Get(url + "/sessions/events")
+	c.Assert(err, IsNil)
+	defer res.Body.Close()
+
+	cancel()
+
+	select {
+	case err := <-stopped:
+		c.Assert(err, IsNil)
+	case <-time.After(cfg.ShutdownTimeout):
+		c.Fatal("server is not stopped")
+	}
+
+	_, err = io.ReadAll(res.Body)
+	c.Assert(err, IsNil)
+
+	_, err = http.Get(url + "/sessions")
+	c.Assert(err, NotNil)
+	c.Assert(keeper.Close(), IsNil)
+}
+
+func (s *testSuite) TestStart(c *C) {
+	// free port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	address := l.Addr().String()
+	c.Assert(l.Close(), IsNil)
+
+	cfg := DefaultConfig()
+	cfg.Listen = address
+	cfg.MaxExtendedTTL = 1000
+	snapshot := filepath.Join(c.MkDir(), "sessions.snapshot")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- Start(ctx, cfg, storage.WithSnapshot(snapshot, 0))
+	}()
+
+	url := "http://" + address
+	for i := 0; i < 100; i++ {
+		if _, err = http.Get(url + "/sessions"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(err, IsNil)
+
+	res := CreateRequest(c, url, "10")
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	id := responseParser(c, res).ID
+
+	// the storage is not limited by the default max extended TTL
+	res = ExtendRequest(c, url, id, "900")
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	readResponse(c, res)
+	c.Assert(getSession(c, url, id).TTL > int(storage.MaxAllowedExtendedTTL), Equals, true)
+
+	cancel()
+	c.Assert(<-stopped, IsNil)
+
+	// the storage is closed with the final snapshot
+	_, err = os.Stat(snapshot)
+	c.Assert(err, IsNil)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	. "github.com/iostrovok/check"
+
+	"github.com/iostrovok/aura-test/response"
+	"github.com/iostrovok/aura-test/storage"
+)
+
+func (s *testSuite) TestTags(c *C) {
+	keeper := storage.New(context.Background())
+	ts := httptest.NewServer(newHandler(keeper, DefaultConfig()))
+	defer ts.Close()
+
+	res := JSONRequest(c, http.MethodPost, ts.URL+"/sessions", `{"ttl": 30, "tags": {"app": "mobile", "region": "eu"}}`)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	mobileEU := responseParser(c, res).ID
+
+	res, err := http.PostForm(ts.URL+"/sessions", url.Values{"TAG": {"app=mobile", "region=us"}})
+	c.Assert(err, IsNil)
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	mobileUS := responseParser(c, res).ID
+
+	c.Assert(getSession(c, ts.URL, mobileUS).Tags, DeepEquals, []string{"app=mobile", "region=us"})
+
+	for _, body := range []string{`{"tags": {"app": "mobile app"}}`, `{"tags": {"": "mobile"}}`} {
+		res = JSONRequest(c, http.MethodPost, ts.URL+"/sessions", body)
+		c.Assert(res.StatusCode, Equals, http.StatusBadRequest, Commentf(body))
+		c.Assert(responseParser(c, res).Error, Equals, storage.ErrWrongTags.Error())
+	}
+
+	query := func(method, expr string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+"/tags/sessions?q="+url.QueryEscape(expr), nil)
+		c.Assert(err, IsNil)
+		res, err := http.DefaultClient.Do(req)
+		c.Assert(err, IsNil)
+
+		return res
+	}
+
+	res = query(http.MethodGet, "app=mobile AND region=eu")
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	c.Assert(res.Header.Get("Content-Type"), Equals, JSONContentType)
+	list := make([]response.List, 0)
+	c.Assert(json.Unmarshal(readResponse(c, res), &list), IsNil)
+	c.Assert(list, HasLen, 1)
+	c.Assert(list[0].ID, Equals, mobileEU)
+	c.Assert(list[0].Tags, DeepEquals, []string{"app=mobile", "region=eu"})
+
+	res = query(http.MethodGet, "app=web")
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	c.Assert(string(readResponse(c, res)), Equals, "[]")
+
+	for _, expr := range []string{"", "app=mobile OR region=eu"} {
+		res = query(http.MethodGet, expr)
+		c.Assert(res.StatusCode, Equals, http.StatusBadRequest, Commentf(expr))
+		c.Assert(responseParser(c, res).Error, Equals, storage.ErrTagQuery.Error())
+	}
+
+	res = query(http.MethodDelete, "app=mobile")
+	c.Assert(res.StatusCode, Equals, http.StatusOK)
+	destroyed := response.Destroyed{}
+	c.Assert(json.Unmarshal(readResponse(c, res), &destroyed), IsNil)
+	c.Assert(destroyed.Destroyed, Equals, 2)
+	checkRemoteEmptyAllInStorage(c, ts.URL)
+}
+
+func (s *testSuite) TestTagsAuth(c *C) {
+	keeper := storage.New(context.Background())
+	_, _ = keeper.Create(30, storage.SessionTags(map[string]string{"app": "mobile"}))
+
+	cfg := DefaultConfig()
+	cfg.APIKeys = []APIKey{
+		{Name: "writer", Key: "write-key", Scopes: []Scope{ScopeRead, ScopeWrite}},
+		{Name: "admin", Key: "admin-key", Scopes: []Scope{ScopeAdmin}},
+	}
+
+	ts := httptest.NewServer(newHandler(keeper, cfg))
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		method, key string
+		status      int
+	}{
+		{http.MethodGet, "write-key", http.StatusForbidden},
+		{http.MethodDelete, "write-key", http.StatusForbidden},
+		{http.MethodGet, "admin-key", http.StatusOK},
+		{http.MethodDelete, "admin-key", http.StatusOK},
+	} {
+		req, err := http.NewRequest(tc.method, ts.URL+"/tags/sessions?q=app%3Dmobile", strings.NewReader(""))
+		c.Assert(err, IsNil)
+		req.Header.Set(APIKeyHeader, tc.key)
+		res, err := http.DefaultClient.Do(req)
+		c.Assert(err, IsNil)
+		c.Assert(res.StatusCode, Equals, tc.status, Commentf("%s %s", tc.method, tc.key))
+		readResponse(c, res)
+	}
+
+	c.Assert(keeper.Len(), Equals, 0)
+}
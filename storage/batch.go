@@ -0,0 +1,135 @@
+package storage
+
+import "github.com/google/uuid"
+
+/*
+	Batch applies many operations (create, extend, destroy) at once. Storage groups extending and
+	destroying by bunches, so each bunch is locked once per batch. Results are in the order of operations,
+	operations of the same session are applied in their order.
+*/
+
+// BatchOpType is a type of batch operation.
+type BatchOpType int
+
+const (
+	// BatchCreate creates new session with TTL and Opts.
+	BatchCreate BatchOpType = iota
+	// BatchExtend extends the session ID by TTL.
+	BatchExtend
+	// BatchDestroy deletes the session ID.
+	BatchDestroy
+)
+
+// BatchOp is an operation of the batch.
+type BatchOp struct {
+	Type BatchOpType
+	ID   string          // session of extending and destroying
+	TTL  uint32          // TTL of creating and extending
+	Opts []SessionOption // options of creating
+}
+
+// BatchResult is a result of the batch operation: id of the session and error of the operation
+// (ErrNotFound if the session of extending or destroying is not found).
+type BatchResult struct {
+	ID  string
+	Err error
+}
+
+// Batcher is implemented by storage backends which apply batches faster then operations one by one.
+type Batcher interface {
+	Batch(ops []BatchOp) []BatchResult
+}
+
+// check that Storage implements Batcher.
+var _ Batcher = (*Storage)(nil)
+
+// ApplyBatch applies the operations to the store by its Batcher or one by one.
+func ApplyBatch(store SessionStore, ops []BatchOp) []BatchResult {
+	if batcher, ok := store.(Batcher); ok {
+		return batcher.Batch(ops)
+	}
+
+	results := make([]BatchResult, len(ops))
+	for i, op := range ops {
+		results[i] = applyOp(store, op)
+	}
+
+	return results
+}
+
+// applyOp applies one operation to the store.
+func applyOp(store SessionStore, op BatchOp) BatchResult {
+	res := BatchResult{ID: op.ID}
+
+	switch op.Type {
+	case BatchCreate:
+		res.ID, res.Err = store.Create(op.TTL, op.Opts...)
+	case BatchExtend:
+		if !store.Extend(op.ID, op.TTL) {
+			res.Err = ErrNotFound
+		}
+	case BatchDestroy:
+		if !store.Destroy(op.ID) {
+			res.Err = ErrNotFound
+		}
+	}
+
+	return res
+}
+
+// Batch applies the operations. Sessions are created one by one, extending and destroying
+// are grouped by bunches.
+func (s *Storage) Batch(ops []BatchOp) []BatchResult {
+	results := make([]BatchResult, len(ops))
+
+	groups := make(map[*Bunch][]int)
+	order := make([]*Bunch, 0)
+	for i, op := range ops {
+		if op.Type == BatchCreate {
+			results[i] = applyOp(s, op)
+
+			continue
+		}
+
+		results[i].ID = op.ID
+		u, err := uuid.Parse(op.ID)
+		if err != nil {
+			results[i].Err = ErrNotFound
+
+			continue
+		}
+
+		b := s.getBunches(u)
+		if _, ok := groups[b]; !ok {
+			order = append(order, b)
+		}
+		groups[b] = append(groups[b], i)
+	}
+
+	for _, b := range order {
+		b.batch(ops, groups[b], results)
+	}
+
+	return results
+}
+
+// batch applies extending and destroying operations with indexes under one lock.
+func (b *Bunch) batch(ops []BatchOp, indexes []int, results []BatchResult) {
+	// blocking operation
+	b.Lock()
+	defer b.Unlock()
+
+	for _, i := range indexes {
+		found := false
+		switch ops[i].Type {
+		case BatchExtend:
+			found = b.extendSession(ops[i].ID, ops[i].TTL)
+		case BatchDestroy:
+			found = b.destroySession(ops[i].ID)
+		}
+
+		if !found {
+			results[i].Err = ErrNotFound
+		}
+	}
+}
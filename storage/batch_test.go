@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+
+	. "github.com/iostrovok/check"
+)
+
+func (s *testSuite) TestBatch(c *C) {
+	storage, _ := newTestStorage(context.Background())
+	sub := storage.Subscribe(100)
+	defer sub.Close()
+
+	first, _ := storage.Create(10)
+	second, _ := storage.Create(10)
+
+	results := storage.Batch([]BatchOp{
+		{Type: BatchCreate, TTL: 20, Opts: []SessionOption{SessionOwner("user-1")}},
+		{Type: BatchExtend, ID: first, TTL: 100},
+		{Type: BatchDestroy, ID: second},
+		{Type: BatchExtend, ID: second, TTL: 100},
+		{Type: BatchDestroy, ID: "wrong"},
+		{Type: BatchCreate, TTL: 20, Opts: []SessionOption{SessionData([]byte(`[1]`))}},
+	})
+	c.Assert(results, HasLen, 6)
+
+	c.Assert(results[0].Err, IsNil)
+	owner, find := storage.Owner(results[0].ID)
+	c.Assert(find, Equals, true)
+	c.Assert(owner, Equals, "user-1")
+
+	c.Assert(results[1], DeepEquals, BatchResult{ID: first})
+	session, _ := storage.Get(first)
+	c.Assert(session.TTL, Equals, 110)
+
+	c.Assert(results[2], DeepEquals, BatchResult{ID: second})
+	c.Assert(results[3], DeepEquals, BatchResult{ID: second, Err: ErrNotFound})
+	c.Assert(results[4], DeepEquals, BatchResult{ID: "wrong", Err: ErrNotFound})
+	c.Assert(results[5].Err, Equals, ErrWrongData)
+	c.Assert(storage.Len(), Equals, 2)
+
+	// events are published as by single operations
+	types := make([]EventType, 0)
+	for len(sub.C) > 0 {
+		types = append(types, (<-sub.C).Type)
+	}
+	c.Assert(types, DeepEquals, []EventType{EventCreated, EventCreated, EventCreated, EventExtended, EventDestroyed})
+}
+
+func (s *testSuite) TestApplyBatch(c *C) {
+	storage, _ := newTestStorage(context.Background())
+	id, _ := storage.Create(10)
+
+	// the store without Batcher gets operations one by one
+	store := struct{ SessionStore }{storage}
+	_, ok := SessionStore(store).(Batcher)
+	c.Assert(ok, Equals, false)
+
+	results := ApplyBatch(store, []BatchOp{
+		{Type: BatchCreate, TTL: 10},
+		{Type: BatchDestroy, ID: id},
+		{Type: BatchExtend, ID: id, TTL: 10},
+	})
+	c.Assert(results, HasLen, 3)
+	c.Assert(results[0].Err, IsNil)
+	c.Assert(results[1], DeepEquals, BatchResult{ID: id})
+	c.Assert(results[2], DeepEquals, BatchResult{ID: id, Err: ErrNotFound})
+	c.Assert(storage.Len(), Equals, 1)
+}
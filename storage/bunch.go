@@ -1,31 +1,83 @@
 package storage
 
 import (
-	"bytes"
 	"context"
-	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cornelk/hashmap"
+
+	"github.com/iostrovok/aura-test/response"
 )
 
 const (
 	numberCyclesForReloadTime = 200
-	MaxAllowedExtendedTTL     = int64(300)
-	cleanerDelay              = 2 * time.Second
+	// MaxAllowedExtendedTTL is a default limit of TTL set by extending and sliding.
+	MaxAllowedExtendedTTL = int64(300)
 )
 
 type Bunch struct {
 	sync.RWMutex
 	ctx      context.Context
 	sessions *hashmap.HashMap
+	wal      *wal
+	events   *events
+	expiries *expiryQueue
+	stats    cleanerStats
+	clock    Clock
+	lru      *lruList // nil if the storage doesn't evict by LRU
+	owners   *ownerIndex
+	tags     *tagIndex
+	memory   int64 // estimated memory of sessions, see capacity.go
+
+	maxExtendedTTL int64
+	idleDelay      time.Duration
+
+	// done is closed when the cleaner is stopped
+	done chan struct{}
 }
 
-func newBunch(ctx context.Context) *Bunch {
+// bunchConfig are parameters of the bunch. Zero values mean defaults.
+type bunchConfig struct {
+	events         *events
+	clock          Clock
+	maxExtendedTTL int64
+	idleDelay      time.Duration
+	lru            *lruList
+	owners         *ownerIndex
+	tags           *tagIndex
+}
+
+func newBunch(ctx context.Context, cfg bunchConfig) *Bunch {
 	bunch := &Bunch{
-		ctx:      ctx,
-		sessions: &hashmap.HashMap{},
+		ctx:            ctx,
+		sessions:       &hashmap.HashMap{},
+		events:         cfg.events,
+		expiries:       newExpiryQueue(),
+		clock:          cfg.clock,
+		maxExtendedTTL: cfg.maxExtendedTTL,
+		idleDelay:      cfg.idleDelay,
+		lru:            cfg.lru,
+		owners:         cfg.owners,
+		tags:           cfg.tags,
+		done:           make(chan struct{}),
+	}
+
+	if bunch.clock == nil {
+		bunch.clock = realClock{}
+	}
+	if bunch.maxExtendedTTL <= 0 {
+		bunch.maxExtendedTTL = MaxAllowedExtendedTTL
+	}
+	if bunch.idleDelay <= 0 {
+		bunch.idleDelay = cleanerIdleDelay
+	}
+	if bunch.owners == nil {
+		bunch.owners = newOwnerIndex()
+	}
+	if bunch.tags == nil {
+		bunch.tags = newTagIndex()
 	}
 
 	// run cleaner
@@ -35,10 +87,24 @@ func newBunch(ctx context.Context) *Bunch {
 }
 
 // create creates new session. Always success.
-func (b *Bunch) create(uuid string, ttl uint32) {
+func (b *Bunch) create(uuid string, ttl uint32, params *sessionParams) {
 	// non-blocking operation
-	s := time.Now().Unix() + int64(ttl)
-	b.sessions.Set(uuid, s)
+	now := b.clock.Now().Unix()
+	s := &session{expiry: now + int64(ttl), created: now}
+	if params != nil {
+		s.data = params.data
+		s.slide = int64(params.slide)
+		s.owner = params.owner
+		s.tags = params.tags
+		if params.maxLifetime > 0 {
+			s.deadline = now + int64(params.maxLifetime)
+			s.expiry = s.limit(s.expiry)
+		}
+	}
+
+	b.set(uuid, s)
+	b.wal.append(walOpCreate, uuid, s)
+	b.events.publish(EventCreated, uuid, s.owner, s.expiry)
 }
 
 func (b *Bunch) extend(uuid string, ttl uint32) bool {
@@ -46,11 +112,20 @@ func (b *Bunch) extend(uuid string, ttl uint32) bool {
 	b.RLock()
 	defer b.RUnlock()
 
+	return b.extendSession(uuid, ttl)
+}
+
+// extendSession extends the session. It's called under the lock.
+func (b *Bunch) extendSession(uuid string, ttl uint32) bool {
 	value, ok := b.sessions.Get(uuid)
 	if ok && value != nil {
-		if newSession, find := extendTimeSession(value.(int64), time.Now().Unix(), int64(ttl)); find {
+		old := value.(*session)
+		if expiry, find := extendTimeSession(old.expiry, b.clock.Now().Unix(), int64(ttl), b.maxExtendedTTL); find {
 			// session is not expired now
-			b.sessions.Set(uuid, newSession)
+			s := old.withExpiry(expiry)
+			b.set(uuid, s)
+			b.wal.append(walOpExtend, uuid, s)
+			b.events.publish(EventExtended, uuid, s.owner, s.expiry)
 
 			return true
 		}
@@ -59,13 +134,49 @@ func (b *Bunch) extend(uuid string, ttl uint32) bool {
 	return false
 }
 
+// updateData replaces data of the live session by result of the update function.
+// fits checks that there is room for the session of the new size growing by delta, nil means no limit.
+// It returns ErrFull if there is no room.
+func (b *Bunch) updateData(uuid string, update func(data []byte) ([]byte, error), fits func(size, delta int64) bool) error {
+	// blocking operation: read-modify-write of data
+	b.Lock()
+	defer b.Unlock()
+
+	value, ok := b.sessions.Get(uuid)
+	if !ok || value == nil || value.(*session).expiry <= b.clock.Now().Unix() {
+		return ErrNotFound
+	}
+
+	old := value.(*session)
+	data, err := update(old.data)
+	if err != nil {
+		return err
+	}
+
+	s := old.withData(data)
+	if size := s.size(uuid); fits != nil && !fits(size, size-old.size(uuid)) {
+		return ErrFull
+	}
+
+	b.store(uuid, s)
+	b.wal.append(walOpData, uuid, s)
+
+	return nil
+}
+
 func (b *Bunch) destroy(id string) bool {
 	// blocking operation
 	b.Lock()
 	defer b.Unlock()
 
-	if _, ok := b.sessions.Get(id); ok {
-		b.sessions.Del(id)
+	return b.destroySession(id)
+}
+
+// destroySession deletes the session. It's called under the lock.
+func (b *Bunch) destroySession(id string) bool {
+	if s := b.remove(id); s != nil {
+		b.wal.append(walOpDelete, id, nil)
+		b.events.publish(EventDestroyed, id, s.owner, 0)
 
 		return true
 	}
@@ -73,66 +184,345 @@ func (b *Bunch) destroy(id string) bool {
 	return false
 }
 
-func (b *Bunch) list(resCh chan []byte) {
+// get returns the session if it is not expired. Sliding session is extended by each successful lookup.
+func (b *Bunch) get(uuid string) (*response.Session, bool) {
+	value, ok := b.sessions.Get(uuid)
+	if !ok || value == nil {
+		return nil, false
+	}
+
+	now := b.clock.Now().Unix()
+	s := value.(*session)
+	if s.expiry <= now {
+		return nil, false
+	}
+
+	if s.slide > 0 {
+		s = b.slide(uuid, now)
+		if s == nil {
+			return nil, false
+		}
+	}
+	b.lru.touch(uuid)
+
+	return s.response(uuid, now), true
+}
+
+// peek returns the active session. Unlike get it doesn't move expiry of sliding sessions.
+func (b *Bunch) peek(uuid string) (*response.Session, bool) {
+	value, ok := b.sessions.Get(uuid)
+	if !ok || value == nil {
+		return nil, false
+	}
+
+	now := b.clock.Now().Unix()
+	s := value.(*session)
+	if s.expiry <= now {
+		return nil, false
+	}
+
+	return s.response(uuid, now), true
+}
+
+// item returns the list item of the active session. Unlike get it doesn't move expiry of sliding sessions.
+func (b *Bunch) item(uuid string, now int64) (response.List, bool) {
+	value, ok := b.sessions.Get(uuid)
+	if !ok || value == nil || value.(*session).expiry <= now {
+		return response.List{}, false
+	}
+
+	return value.(*session).listItem(uuid, now), true
+}
+
+// owner returns the owner of the active session.
+func (b *Bunch) owner(uuid string) (string, bool) {
+	value, ok := b.sessions.Get(uuid)
+	if !ok || value == nil {
+		return "", false
+	}
+
+	s := value.(*session)
+	if s.expiry <= b.clock.Now().Unix() {
+		return "", false
+	}
+
+	return s.owner, true
+}
+
+// size returns the estimated memory of the stored session.
+func (b *Bunch) size(uuid string) (int64, bool) {
+	value, ok := b.sessions.Get(uuid)
+	if !ok || value == nil {
+		return 0, false
+	}
+
+	return value.(*session).size(uuid), true
+}
+
+// slide moves expiry of the sliding session. It returns nil if the session is not found.
+func (b *Bunch) slide(uuid string, now int64) *session {
+	// blocking operation like extend
+	b.RLock()
+	defer b.RUnlock()
+
+	value, ok := b.sessions.Get(uuid)
+	if !ok || value == nil {
+		return nil
+	}
+
+	old := value.(*session)
+	expiry, find := slideTimeSession(old.expiry, now, old.slide, b.maxExtendedTTL)
+	if !find {
+		return nil
+	}
+
+	if old.limit(expiry) == old.expiry {
+		return old
+	}
+
+	s := old.withExpiry(expiry)
+	b.set(uuid, s)
+	b.wal.append(walOpExtend, uuid, s)
+	b.events.publish(EventExtended, uuid, s.owner, s.expiry)
+
+	return s
+}
+
+func (b *Bunch) list(resCh chan []response.List) {
 	select {
 	case <-b.ctx.Done():
 	case resCh <- b.allSession():
 	}
 }
 
-func (b *Bunch) allSession() []byte {
-	buffer := bytes.NewBuffer([]byte{})
+func (b *Bunch) allSession() []response.List {
+	out := make([]response.List, 0)
+	b.eachList(func(l response.List) bool {
+		out = append(out, l)
 
-	now := time.Now().Unix()
+		return true
+	})
+
+	return out
+}
+
+// eachList calls fn for all active sessions of the bunch till fn returns false.
+func (b *Bunch) eachList(fn func(l response.List) bool) {
+	now := b.clock.Now().Unix()
 	counter := 0
+	b.each(func(id string, s *session) bool {
+		// it does >> 1000 cycles per second so it doesn't make sense get time each times.
+		counter++
+		if counter > numberCyclesForReloadTime {
+			counter = 0
+			now = b.clock.Now().Unix()
+		}
+
+		if s.expiry <= now { // session is expired now
+			return true
+		}
+
+		return fn(s.listItem(id, now))
+	})
+}
+
+// each calls fn for all sessions of the bunch till fn returns false.
+// The rest of the iterator is drained, so its goroutine is not leaked.
+func (b *Bunch) each(fn func(id string, s *session) bool) {
+	ch := b.sessions.Iter()
+	for i := range ch {
+		if i.Value != nil && !fn(i.Key.(string), i.Value.(*session)) {
+			break
+		}
+	}
+
+	for range ch {
+	}
+}
+
+// snapshot appends all live sessions to records.
+func (b *Bunch) snapshot(records []snapshotRecord) []snapshotRecord {
+	now := b.clock.Now().Unix()
 	for i := range b.sessions.Iter() {
 		if i.Value != nil {
-			if ttl := i.Value.(int64) - now; ttl > 0 { // session is not expired now
-				buffer.WriteString(`{"id":"` + i.Key.(string) + `","ttl":` + strconv.FormatInt(ttl, 10) + `},`)
+			if s := i.Value.(*session); s.expiry > now {
+				records = append(records, snapshotRecord{ID: i.Key.(string), Session: s})
 			}
 		}
+	}
 
-		// it does >> 1000 cycles per second so it doesn't make sense get time each times.
-		counter++
-		if counter > numberCyclesForReloadTime {
-			counter = 0
-			now = time.Now().Unix()
+	return records
+}
+
+// set stores the session and schedules its deleting.
+func (b *Bunch) set(uuid string, s *session) {
+	b.store(uuid, s)
+	b.expiries.push(uuid, s.expiry)
+}
+
+// store stores the session, counts its memory, indexes its owner and tags and marks it as recently used.
+func (b *Bunch) store(uuid string, s *session) {
+	delta := s.size(uuid)
+	if old, ok := b.sessions.Get(uuid); ok && old != nil {
+		delta -= old.(*session).size(uuid)
+	} else {
+		if s.owner != "" {
+			b.owners.add(s.owner, uuid, s.created)
+		}
+		if len(s.tags) > 0 {
+			b.tags.add(s.tags, uuid)
 		}
 	}
 
-	// send final data
-	return buffer.Bytes()
+	b.sessions.Set(uuid, s)
+	atomic.AddInt64(&b.memory, delta)
+	b.lru.touch(uuid)
+}
+
+// remove deletes the session. It returns the deleted session or nil if it's not found.
+func (b *Bunch) remove(uuid string) *session {
+	value, ok := b.sessions.Get(uuid)
+	if !ok || value == nil {
+		return nil
+	}
+
+	s := value.(*session)
+	b.sessions.Del(uuid)
+	atomic.AddInt64(&b.memory, -s.size(uuid))
+	b.lru.remove(uuid)
+	b.expiries.remove(uuid)
+	if s.owner != "" {
+		b.owners.remove(s.owner, uuid)
+	}
+	if len(s.tags) > 0 {
+		b.tags.remove(s.tags, uuid)
+	}
+
+	return s
+}
+
+// soonest returns the entry of the session with the nearest expiry. Entries of deleted sessions are dropped.
+func (b *Bunch) soonest() (expiryItem, bool) {
+	return b.expiries.first(func(item expiryItem) bool {
+		value, ok := b.sessions.Get(item.id)
+
+		return ok && value != nil && value.(*session).expiry == item.expiry
+	})
+}
+
+// evict deletes the session to make room for new ones.
+func (b *Bunch) evict(uuid string) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	s := b.remove(uuid)
+	if s == nil {
+		return false
+	}
+
+	b.wal.append(walOpDelete, uuid, nil)
+	b.events.publish(EventEvicted, uuid, s.owner, s.expiry)
+
+	return true
 }
 
+// deleteExpired is the cleaner. It sleeps till the nearest expiry and deletes due sessions only.
 func (b *Bunch) deleteExpired(ctx context.Context) {
-	// it's deleting sessions which are already expired.
-	// it's not real method.
+	defer close(b.done)
+
 	for {
+		now := b.clock.Now()
+		at := now.Add(b.idleDelay)
+		if next, ok := b.expiries.next(); ok {
+			at = time.Unix(next, 0)
+		}
+
+		if at.After(now) {
+			wait, stop := b.clock.At(at)
+			select {
+			case <-ctx.Done():
+				// game over
+				stop()
+
+				return
+			case <-b.expiries.wake:
+				// new nearest expiry
+				stop()
+
+				continue
+			case <-wait:
+			}
+		}
+
 		select {
 		case <-ctx.Done():
-			// game over
 			return
-		case <-time.After(cleanerDelay):
-			for i := range b.sessions.Iter() {
-				if i.Value != nil {
-					if i.Value.(int64) <= time.Now().Unix() {
-						b.sessions.Del(i.Key)
-					}
-				}
-			}
+		default:
+			// scan time is measured by the system clock: it's a cost of the cleaner, not a session time
+			start := time.Now()
+			b.expire(b.clock.Now())
+			b.stats.addScan(time.Since(start))
+		}
+	}
+}
+
+// expire deletes sessions which are due at now. It returns number of deleted sessions.
+func (b *Bunch) expire(now time.Time) int {
+	b.Lock()
+	defer b.Unlock()
+
+	count := 0
+	for _, item := range b.expiries.popDue(now.Unix()) {
+		value, ok := b.sessions.Get(item.id)
+		if !ok || value == nil {
+			// destroyed
+			continue
 		}
+
+		s := value.(*session)
+		if s.expiry > now.Unix() {
+			// extended meanwhile, concurrent extends may set the entry out of order
+			b.expiries.push(item.id, s.expiry)
+
+			continue
+		}
+
+		b.remove(item.id)
+		b.events.publish(EventExpired, item.id, s.owner, s.expiry)
+		b.stats.add(now.Sub(time.Unix(s.expiry, 0)))
+		count++
 	}
+
+	return count
 }
 
-func extendTimeSession(session, now, ttl int64) (int64, bool) {
+func extendTimeSession(session, now, ttl, max int64) (int64, bool) {
 	if session < now { // session is expired
 		return 0, false
 	}
 
 	session += ttl
-	if session-now < MaxAllowedExtendedTTL {
+	if session-now < max {
 		return session, true
 	}
 
-	return now + MaxAllowedExtendedTTL, true
+	return now + max, true
+}
+
+// slideTimeSession moves expiry to now + slide but no more then max.
+// Expiry is never moved back.
+func slideTimeSession(session, now, slide, max int64) (int64, bool) {
+	if session <= now { // session is expired
+		return 0, false
+	}
+
+	if slide > max {
+		slide = max
+	}
+
+	if now+slide > session {
+		return now + slide, true
+	}
+
+	return session, true
 }
@@ -2,13 +2,14 @@ package storage
 
 import (
 	"context"
-	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 
 	. "github.com/iostrovok/check"
+
+	"github.com/iostrovok/aura-test/response"
 )
 
 type testSuite struct{}
@@ -17,65 +18,73 @@ var _ = Suite(&testSuite{})
 
 func TestStorage(t *testing.T) { TestingT(t) }
 
+// testNow is the start time of manual clocks in tests.
+var testNow = time.Unix(1600000000, 0)
+
+// helper.
+func newTestBunch(ctx context.Context) (*Bunch, *ManualClock) {
+	clock := NewManualClock(testNow)
+
+	return newBunch(ctx, bunchConfig{clock: clock}), clock
+}
+
 // helper.
-func checkAllInBunch(c *C, id, all string) {
-	c.Assert(strings.Index(all, "{"), Equals, 0)
-	c.Assert(strings.LastIndex(all, ","), Equals, len(all)-1)
-	c.Assert(strings.LastIndex(all, "}"), Equals, len(all)-2)
-	c.Assert(strings.LastIndex(all, id) > 0, Equals, true)
+func checkAllInBunch(c *C, id string, all []response.List) {
+	c.Assert(all, Not(HasLen), 0)
+	checkAllInStorage(c, id, all)
 }
 
 func (s *testSuite) TestCreate(c *C) {
-	bunch := newBunch(context.Background())
-	c.Assert(string(bunch.allSession()), Equals, "")
+	bunch, _ := newTestBunch(context.Background())
+	c.Assert(bunch.allSession(), HasLen, 0)
 
 	id := uuid.New()
-	bunch.create(id.String(), 30)
+	bunch.create(id.String(), 30, nil)
 
-	all := string(bunch.allSession())
-	c.Logf("all: %s\n", all)
+	all := bunch.allSession()
+	c.Logf("all: %+v\n", all)
 	checkAllInBunch(c, id.String(), all)
 }
 
 func (s *testSuite) TestExpired(c *C) {
-	bunch := newBunch(context.Background())
-	c.Assert(string(bunch.allSession()), Equals, "")
+	bunch, clock := newTestBunch(context.Background())
+	c.Assert(bunch.allSession(), HasLen, 0)
 
 	id := uuid.New()
-	bunch.create(id.String(), 1)
-	checkAllInBunch(c, id.String(), string(bunch.allSession()))
+	bunch.create(id.String(), 1, nil)
+	checkAllInBunch(c, id.String(), bunch.allSession())
 
-	time.Sleep(2 * time.Second)
-	c.Assert(string(bunch.allSession()), Equals, "")
+	clock.Add(2 * time.Second)
+	c.Assert(bunch.allSession(), HasLen, 0)
 }
 
 func (s *testSuite) TestDestroy(c *C) {
-	bunch := newBunch(context.Background())
-	c.Assert(string(bunch.allSession()), Equals, "")
+	bunch, _ := newTestBunch(context.Background())
+	c.Assert(bunch.allSession(), HasLen, 0)
 
 	id := uuid.New()
-	bunch.create(id.String(), 30)
-	checkAllInBunch(c, id.String(), string(bunch.allSession()))
+	bunch.create(id.String(), 30, nil)
+	checkAllInBunch(c, id.String(), bunch.allSession())
 
 	c.Assert(bunch.destroy(id.String()), Equals, true)
-	c.Assert(string(bunch.allSession()), Equals, "")
+	c.Assert(bunch.allSession(), HasLen, 0)
 
 	c.Assert(bunch.destroy(id.String()), Equals, false)
-	c.Assert(string(bunch.allSession()), Equals, "")
+	c.Assert(bunch.allSession(), HasLen, 0)
 }
 
 func (s *testSuite) TestDestroyMassive(c *C) {
-	bunch := newBunch(context.Background())
-	c.Assert(string(bunch.allSession()), Equals, "")
+	bunch, _ := newTestBunch(context.Background())
+	c.Assert(bunch.allSession(), HasLen, 0)
 
 	ids := make([]string, 1000, 1000)
 	for i := 0; i < 1000; i++ {
 		id := uuid.New()
-		bunch.create(id.String(), 30)
+		bunch.create(id.String(), 30, nil)
 		ids[i] = id.String()
 	}
 
-	all := string(bunch.allSession())
+	all := bunch.allSession()
 	for i := 0; i < 1000; i++ {
 		checkAllInBunch(c, ids[i], all)
 	}
@@ -83,67 +92,173 @@ func (s *testSuite) TestDestroyMassive(c *C) {
 	for i := 0; i < 1000; i++ {
 		c.Assert(bunch.destroy(ids[i]), Equals, true)
 	}
-	c.Assert(string(bunch.allSession()), Equals, "")
+	c.Assert(bunch.allSession(), HasLen, 0)
 }
 
 func (s *testSuite) TestExtend(c *C) {
-	bunch := newBunch(context.Background())
-	c.Assert(string(bunch.allSession()), Equals, "")
+	bunch, clock := newTestBunch(context.Background())
+	c.Assert(bunch.allSession(), HasLen, 0)
 
 	id := uuid.New()
-	bunch.create(id.String(), 1)
+	bunch.create(id.String(), 1, nil)
 	c.Assert(bunch.extend(id.String(), 10), Equals, true)
-	checkAllInBunch(c, id.String(), string(bunch.allSession()))
+	checkAllInBunch(c, id.String(), bunch.allSession())
 
-	time.Sleep(2 * time.Second)
-	checkAllInBunch(c, id.String(), string(bunch.allSession()))
+	clock.Add(2 * time.Second)
+	checkAllInBunch(c, id.String(), bunch.allSession())
 }
 
 func (s *testSuite) TestExtendExpired(c *C) {
-	bunch := newBunch(context.Background())
-	c.Assert(string(bunch.allSession()), Equals, "")
+	bunch, clock := newTestBunch(context.Background())
+	c.Assert(bunch.allSession(), HasLen, 0)
 
 	id := uuid.New()
-	bunch.create(id.String(), 1)
-	checkAllInBunch(c, id.String(), string(bunch.allSession()))
+	bunch.create(id.String(), 1, nil)
+	checkAllInBunch(c, id.String(), bunch.allSession())
 
-	time.Sleep(2 * time.Second)
+	clock.Add(2 * time.Second)
 	c.Assert(bunch.extend(id.String(), 10), Equals, false)
-	c.Assert(string(bunch.allSession()), Equals, "")
+	c.Assert(bunch.allSession(), HasLen, 0)
 }
 
 func (s *testSuite) TestCreateManyRecords(c *C) {
-	bunch := newBunch(context.Background())
-	c.Assert(string(bunch.allSession()), Equals, "")
+	bunch, _ := newTestBunch(context.Background())
+	c.Assert(bunch.allSession(), HasLen, 0)
 
 	for i := 0; i < 1000; i++ {
-		bunch.create(uuid.New().String(), 10)
+		bunch.create(uuid.New().String(), 10, nil)
 	}
 
 	id := uuid.New()
-	bunch.create(id.String(), 10)
+	bunch.create(id.String(), 10, nil)
 
-	checkAllInBunch(c, id.String(), string(bunch.allSession()))
+	checkAllInBunch(c, id.String(), bunch.allSession())
 }
 
 func (s *testSuite) TestStopExpired(c *C) {
 	ctx, cxtFunc := context.WithCancel(context.Background())
-	bunch := newBunch(ctx)
-	c.Assert(string(bunch.allSession()), Equals, "")
+	bunch, _ := newTestBunch(ctx)
+	c.Assert(bunch.allSession(), HasLen, 0)
 	cxtFunc()
-	c.Assert(string(bunch.allSession()), Equals, "")
+	c.Assert(bunch.allSession(), HasLen, 0)
 }
 
 func (s *testSuite) TestExtendTimeSession(c *C) {
-	a, find := extendTimeSession(100, 200, 30)
+	a, find := extendTimeSession(100, 200, 30, MaxAllowedExtendedTTL)
 	c.Assert(find, Equals, false)
 	c.Assert(a, Equals, int64(0))
 
-	a, find = extendTimeSession(200, 100, 30)
+	a, find = extendTimeSession(200, 100, 30, MaxAllowedExtendedTTL)
 	c.Assert(find, Equals, true)
 	c.Assert(a, Equals, int64(230))
 
-	a, find = extendTimeSession(200, 100, 4000)
+	a, find = extendTimeSession(200, 100, 4000, MaxAllowedExtendedTTL)
+	c.Assert(find, Equals, true)
+	c.Assert(a, Equals, int64(100+300))
+}
+
+func (s *testSuite) TestSliding(c *C) {
+	bunch, clock := newTestBunch(context.Background())
+
+	id := uuid.New().String()
+	bunch.create(id, 3, &sessionParams{slide: 3})
+
+	// each lookup moves expiry
+	for i := 0; i < 3; i++ {
+		clock.Add(time.Second)
+		session, find := bunch.get(id)
+		c.Assert(find, Equals, true)
+		c.Assert(session.TTL, Equals, 3)
+	}
+
+	clock.Add(4 * time.Second)
+	_, find := bunch.get(id)
+	c.Assert(find, Equals, false)
+}
+
+func (s *testSuite) TestSlideTimeSession(c *C) {
+	a, find := slideTimeSession(100, 200, 30, MaxAllowedExtendedTTL)
+	c.Assert(find, Equals, false)
+	c.Assert(a, Equals, int64(0))
+
+	a, find = slideTimeSession(110, 100, 30, MaxAllowedExtendedTTL)
+	c.Assert(find, Equals, true)
+	c.Assert(a, Equals, int64(130))
+
+	// expiry is not moved back
+	a, find = slideTimeSession(200, 100, 30, MaxAllowedExtendedTTL)
+	c.Assert(find, Equals, true)
+	c.Assert(a, Equals, int64(200))
+
+	a, find = slideTimeSession(110, 100, 4000, MaxAllowedExtendedTTL)
 	c.Assert(find, Equals, true)
 	c.Assert(a, Equals, int64(100+300))
 }
+
+const (
+	benchSessions    = 100000
+	benchDueSessions = 10000
+)
+
+// scanExpired is the previous cleaner: full scan of the bunch. It's a baseline for benchmarks.
+func scanExpired(b *Bunch) int {
+	count := 0
+	for i := range b.sessions.Iter() {
+		if i.Value != nil {
+			if i.Value.(*session).expiry <= b.clock.Now().Unix() {
+				b.sessions.Del(i.Key)
+				count++
+			}
+		}
+	}
+
+	return count
+}
+
+// fillBench creates count sessions with TTL in the storage.
+func fillBench(storage *Storage, count int, ttl uint32) {
+	for i := 0; i < count; i++ {
+		if _, err := storage.Create(ttl); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// benchmarkCleaner fills all bunches of the storage by benchSessions live sessions and
+// measures deleting of benchDueSessions expired sessions by clean (one pass over all bunches).
+func benchmarkCleaner(bench *testing.B, clean func(b *Bunch) int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // no background cleaners
+	clock := NewManualClock(time.Now())
+	storage := New(ctx, WithClock(clock))
+
+	// live sessions outlive all iterations, each iteration moves the clock by 2 seconds
+	fillBench(storage, benchSessions, uint32(2*bench.N+3600))
+
+	bench.ResetTimer()
+	for n := 0; n < bench.N; n++ {
+		bench.StopTimer()
+		fillBench(storage, benchDueSessions, 1)
+		clock.Add(2 * time.Second)
+		bench.StartTimer()
+
+		count := 0
+		for i := uint32(0); i < storage.CountBunches; i++ {
+			count += clean(storage.Bunches[i])
+		}
+
+		if count != benchDueSessions {
+			bench.Fatalf("expired %d sessions, expected %d", count, benchDueSessions)
+		}
+	}
+}
+
+func BenchmarkCleanerFullScan(bench *testing.B) {
+	benchmarkCleaner(bench, scanExpired)
+}
+
+func BenchmarkCleanerExpiryQueue(bench *testing.B) {
+	benchmarkCleaner(bench, func(b *Bunch) int {
+		return b.expire(b.clock.Now())
+	})
+}
@@ -0,0 +1,313 @@
+package storage
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+	Capacity of the storage is limited by the number of sessions (WithMaxSessions) and/or by the memory
+	of sessions (WithMaxMemory). When the storage is full, Create makes room by the eviction policy:
+
+		EvictReject   - new sessions are rejected with ErrFull (default)
+		EvictExpiring - sessions with the nearest expiry are evicted
+		EvictLRU      - least recently used sessions are evicted (create, get, extend and update are uses)
+
+	Memory of a session is estimated as its id, owner, tags and data plus sessionOverhead.
+	Expired sessions are counted till the cleaner deletes them. Evicted sessions are deleted from
+	the write-ahead log and published as EventEvicted.
+*/
+
+// EvictionPolicy is a behaviour of the full storage.
+type EvictionPolicy int
+
+const (
+	// EvictReject rejects new sessions.
+	EvictReject EvictionPolicy = iota
+	// EvictExpiring evicts sessions with the nearest expiry.
+	EvictExpiring
+	// EvictLRU evicts least recently used sessions.
+	EvictLRU
+)
+
+// sessionOverhead is an estimated memory of a session besides id, owner, tags and data:
+// the struct, the hashmap entry and the expiry entry.
+const sessionOverhead = 192
+
+var (
+	ErrFull           = errors.New("session storage is full")
+	ErrEvictionPolicy = errors.New("unknown eviction policy")
+)
+
+// ParseEvictionPolicy converts name of the policy ("reject", "expiring", "lru") to EvictionPolicy.
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch name {
+	case "reject":
+		return EvictReject, nil
+	case "expiring":
+		return EvictExpiring, nil
+	case "lru":
+		return EvictLRU, nil
+	}
+
+	return 0, ErrEvictionPolicy
+}
+
+// WithMaxSessions sets the limit of stored sessions. Zero means no limit.
+func WithMaxSessions(count int) Option {
+	return func(s *Storage) {
+		s.maxSessions = count
+	}
+}
+
+// WithMaxMemory sets the limit of estimated memory of sessions (in bytes). Zero means no limit.
+func WithMaxMemory(size int64) Option {
+	return func(s *Storage) {
+		s.maxMemory = size
+	}
+}
+
+// WithEviction sets the behaviour of the full storage.
+func WithEviction(policy EvictionPolicy) Option {
+	return func(s *Storage) {
+		s.eviction = policy
+	}
+}
+
+// size returns estimated memory of the session.
+func (s *session) size(id string) int64 {
+	return sessionOverhead + int64(len(id)+len(s.owner)+s.tagsSize()+len(s.data))
+}
+
+// Memory returns estimated memory of stored sessions (in bytes).
+func (s *Storage) Memory() int64 {
+	total := int64(0)
+	for i := uint32(0); i < s.CountBunches; i++ {
+		total += atomic.LoadInt64(&s.Bunches[i].memory)
+	}
+
+	return total
+}
+
+// limited checks that the capacity of the storage is limited.
+func (s *Storage) limited() bool {
+	return s.maxSessions > 0 || s.maxMemory > 0
+}
+
+// full checks that there is no room for the new session of the size when sessions of count and memory are evicted.
+func (s *Storage) full(size int64, count int, memory int64) bool {
+	return (s.maxSessions > 0 && s.Len()-count >= s.maxSessions) || (s.maxMemory > 0 && s.Memory()-memory+size > s.maxMemory)
+}
+
+// reserve makes room for the new session of the size by the eviction policy. victims are sessions
+// which are evicted after reserving by the caller, their room is counted as free.
+// It returns ErrFull if the room can't be made. It's called under capacityMu.
+func (s *Storage) reserve(size int64, victims []string) error {
+	if s.maxMemory > 0 && size > s.maxMemory {
+		atomic.AddUint64(&s.rejected, 1)
+
+		return ErrFull
+	}
+
+	for {
+		// victims may be evicted by the policy too
+		count, memory := s.sizeOf(victims)
+		if !s.full(size, count, memory) {
+			return nil
+		}
+
+		if s.eviction == EvictReject || !s.evictOne() {
+			atomic.AddUint64(&s.rejected, 1)
+
+			return ErrFull
+		}
+	}
+}
+
+// updateData updates data of the session by the bunch. The memory limit is kept by the eviction policy:
+// the storage evicts other sessions till the larger data fits or returns ErrFull.
+func (s *Storage) updateData(u uuid.UUID, id string, update func(data []byte) ([]byte, error)) error {
+	b := s.getBunches(u)
+	if s.maxMemory == 0 {
+		return b.updateData(id, update, nil)
+	}
+
+	s.capacityMu.Lock()
+	defer s.capacityMu.Unlock()
+
+	needed := int64(0)
+	fits := func(size, delta int64) bool {
+		needed = size
+
+		return delta <= 0 || s.Memory()+delta <= s.maxMemory
+	}
+
+	for {
+		err := b.updateData(id, update, fits)
+		if err != ErrFull {
+			return err
+		}
+
+		// evicting can't make room for the session which is larger then the storage
+		if needed > s.maxMemory || s.eviction == EvictReject || !s.evictOne() {
+			atomic.AddUint64(&s.rejected, 1)
+
+			return ErrFull
+		}
+	}
+}
+
+// trim evicts sessions by the policy till the storage fits its capacity. It's used after restoring,
+// the reject policy keeps restored sessions and reports the overflow.
+func (s *Storage) trim() {
+	if !s.limited() {
+		return
+	}
+
+	s.capacityMu.Lock()
+	defer s.capacityMu.Unlock()
+
+	for (s.maxSessions > 0 && s.Len() > s.maxSessions) || (s.maxMemory > 0 && s.Memory() > s.maxMemory) {
+		if s.eviction == EvictReject || !s.evictOne() {
+			logrus.Warnf("restored sessions don't fit the capacity: %d sessions, %d bytes", s.Len(), s.Memory())
+
+			return
+		}
+	}
+}
+
+// sizeOf returns the number and the memory of stored sessions of ids.
+func (s *Storage) sizeOf(ids []string) (int, int64) {
+	count, memory := 0, int64(0)
+	for _, id := range ids {
+		b, ok := s.bunchOf(id)
+		if !ok {
+			continue
+		}
+
+		if size, ok := b.size(id); ok {
+			count++
+			memory += size
+		}
+	}
+
+	return count, memory
+}
+
+// evictOne evicts one session by the policy. It returns false if there is nothing to evict.
+func (s *Storage) evictOne() bool {
+	var (
+		victim *Bunch
+		id     string
+		best   uint64
+	)
+
+	for i := uint32(0); i < s.CountBunches; i++ {
+		b := s.Bunches[i]
+
+		var (
+			candidate string
+			order     uint64
+			ok        bool
+		)
+
+		switch s.eviction {
+		case EvictExpiring:
+			var item expiryItem
+			item, ok = b.soonest()
+			candidate, order = item.id, uint64(item.expiry)
+		case EvictLRU:
+			candidate, order, ok = b.lru.oldest()
+		}
+
+		if ok && (victim == nil || order < best) {
+			victim, id, best = b, candidate, order
+		}
+	}
+
+	if victim == nil {
+		return false
+	}
+
+	// the session may be deleted meanwhile, anyway the room is changed
+	victim.evict(id)
+
+	return true
+}
+
+// lruList is an order of uses of sessions of one bunch. Ticks are shared by all bunches,
+// so the least recently used session of the storage is the oldest one of oldest sessions of bunches.
+// Nil list does nothing.
+type lruList struct {
+	sync.Mutex
+
+	ticks *uint64
+	items *list.List // front is the most recently used
+	index map[string]*list.Element
+}
+
+type lruItem struct {
+	id   string
+	tick uint64
+}
+
+func newLRUList(ticks *uint64) *lruList {
+	return &lruList{ticks: ticks, items: list.New(), index: make(map[string]*list.Element)}
+}
+
+// touch marks the session as the most recently used.
+func (l *lruList) touch(id string) {
+	if l == nil {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	tick := atomic.AddUint64(l.ticks, 1)
+	if e, ok := l.index[id]; ok {
+		e.Value.(*lruItem).tick = tick
+		l.items.MoveToFront(e)
+
+		return
+	}
+
+	l.index[id] = l.items.PushFront(&lruItem{id: id, tick: tick})
+}
+
+func (l *lruList) remove(id string) {
+	if l == nil {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if e, ok := l.index[id]; ok {
+		l.items.Remove(e)
+		delete(l.index, id)
+	}
+}
+
+// oldest returns the least recently used session and the tick of its last use.
+func (l *lruList) oldest() (string, uint64, bool) {
+	if l == nil {
+		return "", 0, false
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	e := l.items.Back()
+	if e == nil {
+		return "", 0, false
+	}
+	item := e.Value.(*lruItem)
+
+	return item.id, item.tick, true
+}
@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	. "github.com/iostrovok/check"
+)
+
+func (s *testSuite) TestCapacityMaxSessions(c *C) {
+	storage := New(context.Background(), WithMaxSessions(2))
+
+	first, err := storage.Create(10)
+	c.Assert(err, IsNil)
+	_, err = storage.Create(10)
+	c.Assert(err, IsNil)
+	c.Assert(storage.Len(), Equals, 2)
+
+	_, err = storage.Create(10)
+	c.Assert(err, Equals, ErrFull)
+
+	c.Assert(storage.Destroy(first), Equals, true)
+	_, err = storage.Create(10)
+	c.Assert(err, IsNil)
+
+	stats := storage.Stats()
+	c.Assert(stats.Rejected, Equals, uint64(1))
+	c.Assert(stats.Evicted, Equals, uint64(0))
+}
+
+func (s *testSuite) TestCapacityMemory(c *C) {
+	data := []byte(`{"user":"123456789"}`)
+	size := sessionOverhead + int64(36+len(data))
+	storage := New(context.Background(), WithMaxMemory(3*size))
+
+	ids := make([]string, 0)
+	for i := 0; i < 3; i++ {
+		id, err := storage.Create(10, SessionData(data))
+		c.Assert(err, IsNil)
+		ids = append(ids, id)
+	}
+	c.Assert(storage.Memory(), Equals, 3*size)
+
+	_, err := storage.Create(10, SessionData(data))
+	c.Assert(err, Equals, ErrFull)
+
+	// memory follows data updates and deleting
+	c.Assert(storage.SetData(ids[0], []byte(`{}`)), IsNil)
+	c.Assert(storage.Memory(), Equals, 3*size-int64(len(data)-2))
+	c.Assert(storage.Destroy(ids[1]), Equals, true)
+	c.Assert(storage.Memory(), Equals, 2*size-int64(len(data)-2))
+
+	_, err = storage.Create(10, SessionData(data))
+	c.Assert(err, IsNil)
+
+	// the session which is larger then the limit is never created
+	storage = New(context.Background(), WithMaxMemory(size), WithEviction(EvictLRU))
+	_, err = storage.Create(10, SessionData([]byte(`{"user":"1234567890"}`)))
+	c.Assert(err, Equals, ErrFull)
+}
+
+func (s *testSuite) TestCapacityEvictExpiring(c *C) {
+	clock := NewManualClock(testNow)
+	storage := New(context.Background(), WithClock(clock), WithMaxSessions(3), WithEviction(EvictExpiring))
+	sub := storage.Subscribe(10)
+	defer sub.Close()
+
+	long, _ := storage.Create(100)
+	short, _ := storage.Create(20)
+	middle, _ := storage.Create(50)
+	c.Assert(storage.Extend(short, 100), Equals, true) // 120 now, the entry is moved
+
+	id, err := storage.Create(10)
+	c.Assert(err, IsNil)
+	c.Assert(storage.Len(), Equals, 3)
+
+	_, find := storage.Get(middle)
+	c.Assert(find, Equals, false)
+	for _, id := range []string{long, short, id} {
+		_, find = storage.Get(id)
+		c.Assert(find, Equals, true)
+	}
+
+	// the new session has the nearest expiry now
+	_, err = storage.Create(10)
+	c.Assert(err, IsNil)
+	_, find = storage.Get(id)
+	c.Assert(find, Equals, false)
+
+	c.Assert(storage.Stats().Evicted, Equals, uint64(2))
+
+	evicted := make([]string, 0)
+	for len(sub.C) > 0 {
+		if e := <-sub.C; e.Type == EventEvicted {
+			evicted = append(evicted, e.ID)
+		}
+	}
+	c.Assert(evicted, DeepEquals, []string{middle, id})
+}
+
+func (s *testSuite) TestCapacityEvictLRU(c *C) {
+	storage := New(context.Background(), WithMaxSessions(3), WithEviction(EvictLRU))
+
+	first, _ := storage.Create(100)
+	second, _ := storage.Create(100)
+	third, _ := storage.Create(100)
+
+	// first and third are used after second
+	_, find := storage.Get(first)
+	c.Assert(find, Equals, true)
+	c.Assert(storage.Extend(third, 10), Equals, true)
+
+	_, err := storage.Create(100)
+	c.Assert(err, IsNil)
+	_, find = storage.Get(second)
+	c.Assert(find, Equals, false)
+
+	_, err = storage.Create(100)
+	c.Assert(err, IsNil)
+	_, find = storage.Get(first)
+	c.Assert(find, Equals, false)
+	_, find = storage.Get(third)
+	c.Assert(find, Equals, true)
+}
+
+func (s *testSuite) TestCapacityRestore(c *C) {
+	clock := NewManualClock(testNow)
+	path := filepath.Join(c.MkDir(), "sessions.wal")
+
+	storage := New(context.Background(), WithClock(clock), WithWAL(path, WALSyncAlways, 0),
+		WithMaxSessions(2), WithEviction(EvictExpiring))
+	first, _ := storage.Create(10)
+	_, _ = storage.Create(20)
+	_, _ = storage.Create(30)
+	memory := storage.Memory()
+	c.Assert(storage.Close(), IsNil)
+
+	// evicted sessions are not restored, memory of restored sessions is counted
+	storage = New(context.Background(), WithClock(clock), WithWAL(path, WALSyncAlways, 0), WithMaxSessions(2))
+	defer storage.Close()
+	c.Assert(storage.Len(), Equals, 2)
+	c.Assert(storage.Memory(), Equals, memory)
+	_, find := storage.Get(first)
+	c.Assert(find, Equals, false)
+
+	// expired sessions are deleted with their memory
+	clock.Add(time.Minute)
+	c.Assert(storage.ListAllSessions(), HasLen, 0)
+	for i := uint32(0); i < storage.CountBunches; i++ {
+		storage.Bunches[i].expire(clock.Now())
+	}
+	c.Assert(storage.Memory(), Equals, int64(0))
+}
+
+func (s *testSuite) TestCapacityDataUpdate(c *C) {
+	data := []byte(`{"user":"123456789"}`)
+	size := sessionOverhead + int64(36+len(data))
+	large := []byte(`{"user":"123456789","more":"1234567890"}`)
+
+	storage := New(context.Background(), WithMaxMemory(2*size))
+	first, _ := storage.Create(10, SessionData(data))
+	second, _ := storage.Create(10, SessionData(data))
+
+	// larger data doesn't fit the full storage
+	c.Assert(storage.SetData(first, large), Equals, ErrFull)
+	c.Assert(storage.MergeData(first, []byte(`{"more":"1234567890"}`)), Equals, ErrFull)
+	session, _ := storage.Get(first)
+	c.Assert(string(session.Data), Equals, string(data))
+	c.Assert(storage.Memory(), Equals, 2*size)
+	c.Assert(storage.Stats().Rejected, Equals, uint64(2))
+
+	// smaller data always fits
+	c.Assert(storage.SetData(second, []byte(`{}`)), IsNil)
+	c.Assert(storage.SetData(first, []byte(`{"user":"123456789","more":"1"}`)), IsNil)
+	c.Assert(storage.Memory() <= 2*size, Equals, true)
+
+	// other sessions are evicted by the policy
+	clock := NewManualClock(testNow)
+	storage = New(context.Background(), WithClock(clock), WithMaxMemory(2*size), WithEviction(EvictLRU))
+	first, _ = storage.Create(10, SessionData(data))
+	clock.Add(time.Second)
+	second, _ = storage.Create(10, SessionData(data))
+	c.Assert(storage.SetData(second, large), IsNil)
+	_, find := storage.Get(first)
+	c.Assert(find, Equals, false)
+	c.Assert(storage.Memory() <= 2*size, Equals, true)
+	c.Assert(storage.Stats().Evicted, Equals, uint64(1))
+}
+
+func (s *testSuite) TestCapacityRestoreTrim(c *C) {
+	clock := NewManualClock(testNow)
+	path := filepath.Join(c.MkDir(), "sessions.wal")
+
+	storage := New(context.Background(), WithClock(clock), WithWAL(path, WALSyncAlways, 0))
+	first, _ := storage.Create(10)
+	_, _ = storage.Create(20)
+	_, _ = storage.Create(30)
+	c.Assert(storage.Close(), IsNil)
+
+	// the reject policy keeps restored sessions
+	storage = New(context.Background(), WithClock(clock), WithWAL(path, WALSyncAlways, 0), WithMaxSessions(2))
+	c.Assert(storage.Len(), Equals, 3)
+	c.Assert(storage.Close(), IsNil)
+
+	// other policies evict them
+	storage = New(context.Background(), WithClock(clock), WithWAL(path, WALSyncAlways, 0),
+		WithMaxSessions(2), WithEviction(EvictExpiring))
+	defer storage.Close()
+	c.Assert(storage.Len(), Equals, 2)
+	_, find := storage.Get(first)
+	c.Assert(find, Equals, false)
+}
+
+func (s *testSuite) TestParseEvictionPolicy(c *C) {
+	for name, policy := range map[string]EvictionPolicy{"reject": EvictReject, "expiring": EvictExpiring, "lru": EvictLRU} {
+		out, err := ParseEvictionPolicy(name)
+		c.Assert(err, IsNil)
+		c.Assert(out, Equals, policy)
+	}
+
+	_, err := ParseEvictionPolicy("random")
+	c.Assert(err, Equals, ErrEvictionPolicy)
+}
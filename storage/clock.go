@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a source of time for sessions and cleaners.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// At returns a channel which receives the current time when the clock reaches t
+	// and a function which releases the wait if the channel is not needed anymore.
+	At(t time.Time) (<-chan time.Time, func())
+}
+
+// realClock is the system clock. It's the default clock of Storage.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) At(t time.Time) (<-chan time.Time, func()) {
+	timer := time.NewTimer(time.Until(t))
+
+	return timer.C, func() { timer.Stop() }
+}
+
+// ManualClock is a clock which is moved by hand. It's used for deterministic tests of TTL.
+type ManualClock struct {
+	sync.Mutex
+
+	now     time.Time
+	waiters []*clockWaiter
+}
+
+type clockWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewManualClock returns the clock stopped at now.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (m *ManualClock) Now() time.Time {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.now
+}
+
+// At returns a channel which receives the time when the clock is moved to t or later.
+// The returned function removes the waiter, so abandoned waits don't pile up.
+func (m *ManualClock) At(t time.Time) (<-chan time.Time, func()) {
+	m.Lock()
+	defer m.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if !t.After(m.now) {
+		ch <- m.now
+
+		return ch, func() {}
+	}
+
+	w := &clockWaiter{at: t, ch: ch}
+	m.waiters = append(m.waiters, w)
+
+	return ch, func() { m.stop(w) }
+}
+
+func (m *ManualClock) stop(w *clockWaiter) {
+	m.Lock()
+	defer m.Unlock()
+
+	for i, waiter := range m.waiters {
+		if waiter == w {
+			m.waiters = append(m.waiters[:i], m.waiters[i+1:]...)
+
+			return
+		}
+	}
+}
+
+// Add moves the clock forward by d.
+func (m *ManualClock) Add(d time.Duration) {
+	m.Lock()
+	now := m.now.Add(d)
+	m.Unlock()
+
+	m.Set(now)
+}
+
+// Set moves the clock to now and fires all reached waiters. The clock is never moved back.
+func (m *ManualClock) Set(now time.Time) {
+	m.Lock()
+	defer m.Unlock()
+
+	if now.Before(m.now) {
+		return
+	}
+
+	m.now = now
+	waiters := m.waiters[:0]
+	for _, w := range m.waiters {
+		if w.at.After(now) {
+			waiters = append(waiters, w)
+		} else {
+			w.ch <- now
+		}
+	}
+	m.waiters = waiters
+}
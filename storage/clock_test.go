@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	. "github.com/iostrovok/check"
+)
+
+func (s *testSuite) TestManualClock(c *C) {
+	clock := NewManualClock(testNow)
+	c.Assert(clock.Now(), Equals, testNow)
+
+	reached, _ := clock.At(testNow)
+	later, _ := clock.At(testNow.Add(2 * time.Second))
+	c.Assert(<-reached, Equals, testNow)
+
+	// the stopped waiter is removed and never fired
+	stopped, stop := clock.At(testNow.Add(time.Second))
+	stop()
+	c.Assert(clock.waiters, HasLen, 1)
+
+	clock.Add(time.Second)
+	c.Assert(clock.Now(), Equals, testNow.Add(time.Second))
+	c.Assert(len(later), Equals, 0)
+	c.Assert(len(stopped), Equals, 0)
+
+	clock.Add(time.Second)
+	c.Assert(<-later, Equals, testNow.Add(2*time.Second))
+
+	// the clock is never moved back
+	clock.Set(testNow)
+	c.Assert(clock.Now(), Equals, testNow.Add(2*time.Second))
+}
+
+func (s *testSuite) TestManualClockCleaners(c *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	storage, clock := newTestStorage(ctx)
+
+	// every session is the nearest expiry, so cleaners are woken up and wait again
+	for i := 0; i < 10*CountBunches; i++ {
+		_, err := storage.Create(uint32(100000 - i))
+		c.Assert(err, IsNil)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	clock.Lock()
+	defer clock.Unlock()
+	c.Assert(len(clock.waiters) <= CountBunches, Equals, true, Commentf("%d waiters", len(clock.waiters)))
+}
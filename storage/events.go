@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+/*
+	Events of sessions are sent to subscribers without blocking:
+	if the buffer of a subscriber is full, the event is dropped for this subscriber
+	and counted by Subscription.Dropped.
+*/
+
+// EventType is a type of session event.
+type EventType string
+
+const (
+	EventCreated   EventType = "created"
+	EventExtended  EventType = "extended"
+	EventDestroyed EventType = "destroyed"
+	EventExpired   EventType = "expired"
+	EventEvicted   EventType = "evicted" // deleted to make room for new sessions
+
+	// DefaultEventsBuffer is a default size of subscriber buffer.
+	DefaultEventsBuffer = 1024
+)
+
+// Event is a change of session.
+type Event struct {
+	Type   EventType `json:"type"`
+	ID     string    `json:"id"`
+	Time   int64     `json:"time"`             // unix time of event
+	Expiry int64     `json:"expiry,omitempty"` // unix time of session expiry
+	Owner  string    `json:"owner,omitempty"`  // owner of the session
+}
+
+// EventSource is implemented by storage backends which can stream session events.
+type EventSource interface {
+	// Subscribe returns new subscription with buffer for buffer events.
+	Subscribe(buffer int) *Subscription
+}
+
+// check that Storage implements EventSource.
+var _ EventSource = (*Storage)(nil)
+
+// Subscription receives session events from C until Close is called.
+type Subscription struct {
+	C <-chan Event
+
+	ch      chan Event
+	id      uint64
+	hub     *events
+	dropped uint64
+	once    sync.Once
+}
+
+// Close stops the subscription and closes C.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.unsubscribe(s)
+	})
+}
+
+// Dropped returns number of events which were dropped because the subscriber was slow.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// events keeps all subscribers.
+type events struct {
+	sync.RWMutex
+
+	count  int32
+	nextID uint64
+	subs   map[uint64]*Subscription
+	clock  Clock
+
+	// totals are numbers of all published events by type (the map is not changed after creating)
+	totals map[EventType]*uint64
+}
+
+func newEvents(clock Clock) *events {
+	totals := make(map[EventType]*uint64)
+	for _, t := range []EventType{EventCreated, EventExtended, EventDestroyed, EventExpired, EventEvicted} {
+		totals[t] = new(uint64)
+	}
+
+	return &events{subs: make(map[uint64]*Subscription), clock: clock, totals: totals}
+}
+
+func (e *events) subscribe(buffer int) *Subscription {
+	if buffer < 1 {
+		buffer = DefaultEventsBuffer
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	e.nextID++
+	ch := make(chan Event, buffer)
+	s := &Subscription{C: ch, ch: ch, id: e.nextID, hub: e}
+	e.subs[s.id] = s
+	atomic.AddInt32(&e.count, 1)
+
+	return s
+}
+
+func (e *events) unsubscribe(s *Subscription) {
+	e.Lock()
+	defer e.Unlock()
+
+	delete(e.subs, s.id)
+	atomic.AddInt32(&e.count, -1)
+	close(s.ch)
+}
+
+// publish counts the event and sends it to all subscribers. It never blocks. Nil events does nothing.
+func (e *events) publish(t EventType, id, owner string, expiry int64) {
+	if e == nil {
+		return
+	}
+
+	if total := e.totals[t]; total != nil {
+		atomic.AddUint64(total, 1)
+	}
+
+	if atomic.LoadInt32(&e.count) == 0 {
+		return
+	}
+
+	event := Event{Type: t, ID: id, Time: e.clock.Now().Unix(), Expiry: expiry, Owner: owner}
+
+	e.RLock()
+	defer e.RUnlock()
+
+	for _, s := range e.subs {
+		select {
+		case s.ch <- event:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// total returns number of published events of the type.
+func (e *events) total(t EventType) uint64 {
+	if total := e.totals[t]; total != nil {
+		return atomic.LoadUint64(total)
+	}
+
+	return 0
+}
+
+// Subscribe returns new subscription to events of all sessions.
+func (s *Storage) Subscribe(buffer int) *Subscription {
+	return s.events.subscribe(buffer)
+}
+
+// OnEvent calls fn for each event in a separate goroutine, so slow fn doesn't block the storage.
+// Call Close of the returned subscription to stop it.
+func (s *Storage) OnEvent(buffer int, fn func(Event)) *Subscription {
+	sub := s.Subscribe(buffer)
+	go func() {
+		for e := range sub.C {
+			fn(e)
+		}
+	}()
+
+	return sub
+}
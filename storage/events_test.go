@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	. "github.com/iostrovok/check"
+)
+
+// helper.
+func nextEvent(c *C, sub *Subscription) Event {
+	select {
+	case e := <-sub.C:
+		return e
+	case <-time.After(5 * time.Second):
+		c.Fatal("event is not received")
+	}
+
+	return Event{}
+}
+
+func (s *testSuite) TestEvents(c *C) {
+	storage := New(context.Background())
+	sub := storage.Subscribe(10)
+	defer sub.Close()
+
+	id, _ := storage.Create(30)
+	e := nextEvent(c, sub)
+	c.Assert(e.Type, Equals, EventCreated)
+	c.Assert(e.ID, Equals, id)
+	c.Assert(e.Time > 0, Equals, true)
+	c.Assert(e.Expiry > e.Time, Equals, true)
+
+	c.Assert(storage.Extend(id, 30), Equals, true)
+	e = nextEvent(c, sub)
+	c.Assert(e.Type, Equals, EventExtended)
+	c.Assert(e.ID, Equals, id)
+
+	c.Assert(storage.Destroy(id), Equals, true)
+	e = nextEvent(c, sub)
+	c.Assert(e.Type, Equals, EventDestroyed)
+	c.Assert(e.ID, Equals, id)
+
+	id, _ = storage.Create(1)
+	c.Assert(nextEvent(c, sub).Type, Equals, EventCreated)
+	e = nextEvent(c, sub)
+	c.Assert(e.Type, Equals, EventExpired)
+	c.Assert(e.ID, Equals, id)
+}
+
+func (s *testSuite) TestEventsSlowSubscriber(c *C) {
+	storage := New(context.Background())
+	slow := storage.Subscribe(1)
+
+	received := make(chan Event, 100)
+	callback := storage.OnEvent(100, func(e Event) { received <- e })
+
+	for i := 0; i < 10; i++ {
+		storage.Create(30)
+	}
+
+	// storage is not blocked by the slow subscriber
+	c.Assert(slow.Dropped(), Equals, uint64(9))
+	c.Assert(callback.Dropped(), Equals, uint64(0))
+
+	for i := 0; i < 10; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			c.Fatal("event is not received")
+		}
+	}
+
+	slow.Close()
+	slow.Close()
+	_, ok := <-slow.C
+	c.Assert(ok, Equals, true) // buffered event
+	_, ok = <-slow.C
+	c.Assert(ok, Equals, false)
+
+	callback.Close()
+}
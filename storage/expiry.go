@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	expiryQueue is a min-heap of session expiries of one bunch.
+	The cleaner sleeps till the nearest expiry and touches only sessions which are due.
+
+	Each session has one entry: it's found by id, so extend moves the entry and destroy removes it.
+*/
+
+const (
+	// cleanerIdleDelay is a default sleeping time of the cleaner when the bunch has no sessions.
+	cleanerIdleDelay = time.Minute
+)
+
+type expiryItem struct {
+	expiry int64
+	id     string
+}
+
+// expiryEntry is an item with its position in the heap.
+type expiryEntry struct {
+	expiryItem
+	index int
+}
+
+type expiryHeap []*expiryEntry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiry < h[j].expiry }
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	e := x.(*expiryEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*h = old[:n-1]
+
+	return e
+}
+
+type expiryQueue struct {
+	sync.Mutex
+
+	items expiryHeap
+	index map[string]*expiryEntry // id => entry
+	// wake is signaled when the nearest expiry becomes earlier.
+	wake chan struct{}
+}
+
+func newExpiryQueue() *expiryQueue {
+	return &expiryQueue{index: make(map[string]*expiryEntry), wake: make(chan struct{}, 1)}
+}
+
+// push sets the expiry of the session.
+func (q *expiryQueue) push(id string, expiry int64) {
+	q.Lock()
+	nearest := len(q.items) == 0 || expiry < q.items[0].expiry
+	if e, ok := q.index[id]; ok {
+		e.expiry = expiry
+		heap.Fix(&q.items, e.index)
+	} else {
+		e = &expiryEntry{expiryItem: expiryItem{expiry: expiry, id: id}}
+		q.index[id] = e
+		heap.Push(&q.items, e)
+	}
+	q.Unlock()
+
+	if nearest {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// remove removes the entry of the session.
+func (q *expiryQueue) remove(id string) {
+	q.Lock()
+	defer q.Unlock()
+
+	if e, ok := q.index[id]; ok {
+		heap.Remove(&q.items, e.index)
+		delete(q.index, id)
+	}
+}
+
+// pop removes the nearest entry. It's called under the lock.
+func (q *expiryQueue) pop() expiryItem {
+	e := heap.Pop(&q.items).(*expiryEntry)
+	delete(q.index, e.id)
+
+	return e.expiryItem
+}
+
+// next returns the nearest expiry.
+func (q *expiryQueue) next() (int64, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	if len(q.items) == 0 {
+		return 0, false
+	}
+
+	return q.items[0].expiry, true
+}
+
+// popDue removes and returns all entries with expiry <= now.
+func (q *expiryQueue) popDue(now int64) []expiryItem {
+	q.Lock()
+	defer q.Unlock()
+
+	out := make([]expiryItem, 0)
+	for len(q.items) > 0 && q.items[0].expiry <= now {
+		out = append(out, q.pop())
+	}
+
+	return out
+}
+
+// first returns the nearest entry for which valid is true. Invalid entries before it are removed.
+func (q *expiryQueue) first(valid func(item expiryItem) bool) (expiryItem, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	for len(q.items) > 0 {
+		if valid(q.items[0].expiryItem) {
+			return q.items[0].expiryItem, true
+		}
+		q.pop()
+	}
+
+	return expiryItem{}, false
+}
+
+func (q *expiryQueue) len() int {
+	q.Lock()
+	defer q.Unlock()
+
+	return len(q.items)
+}
+
+// ScanTimeBuckets are upper bounds of the histogram of run times of cleaners (see CleanerStats.ScanTimes).
+var ScanTimeBuckets = [...]time.Duration{
+	10 * time.Microsecond, 100 * time.Microsecond, time.Millisecond, 10 * time.Millisecond, 100 * time.Millisecond, time.Second,
+}
+
+// CleanerStats describes accuracy of deleting of expired sessions.
+type CleanerStats struct {
+	Expired    uint64        // number of deleted expired sessions
+	AverageLag time.Duration // average delay between expiry and deleting
+	MaxLag     time.Duration // max delay between expiry and deleting
+	Scans      uint64        // number of runs of cleaners
+	ScanTime   time.Duration // total time of runs of cleaners
+	// ScanTimes are numbers of runs not longer then ScanTimeBuckets, the counts are cumulative
+	ScanTimes [len(ScanTimeBuckets)]uint64
+}
+
+type cleanerStats struct {
+	expired   uint64
+	totalLag  int64
+	maxLag    int64
+	scans     uint64
+	scanTime  int64
+	scanTimes [len(ScanTimeBuckets)]uint64
+}
+
+func (s *cleanerStats) add(lag time.Duration) {
+	atomic.AddUint64(&s.expired, 1)
+	atomic.AddInt64(&s.totalLag, int64(lag))
+
+	for {
+		max := atomic.LoadInt64(&s.maxLag)
+		if int64(lag) <= max || atomic.CompareAndSwapInt64(&s.maxLag, max, int64(lag)) {
+			return
+		}
+	}
+}
+
+func (s *cleanerStats) addScan(d time.Duration) {
+	atomic.AddUint64(&s.scans, 1)
+	atomic.AddInt64(&s.scanTime, int64(d))
+
+	for i, bucket := range ScanTimeBuckets {
+		if d <= bucket {
+			atomic.AddUint64(&s.scanTimes[i], 1)
+
+			return
+		}
+	}
+}
+
+// CleanerStats returns accuracy of deleting of expired sessions by all bunches.
+func (s *Storage) CleanerStats() CleanerStats {
+	out := CleanerStats{}
+	totalLag := int64(0)
+	for i := uint32(0); i < s.CountBunches; i++ {
+		b := s.Bunches[i]
+		out.Expired += atomic.LoadUint64(&b.stats.expired)
+		totalLag += atomic.LoadInt64(&b.stats.totalLag)
+		out.Scans += atomic.LoadUint64(&b.stats.scans)
+		out.ScanTime += time.Duration(atomic.LoadInt64(&b.stats.scanTime))
+		count := uint64(0)
+		for j := range out.ScanTimes {
+			count += atomic.LoadUint64(&b.stats.scanTimes[j])
+			out.ScanTimes[j] += count
+		}
+		if max := time.Duration(atomic.LoadInt64(&b.stats.maxLag)); max > out.MaxLag {
+			out.MaxLag = max
+		}
+	}
+
+	if out.Expired > 0 {
+		out.AverageLag = time.Duration(totalLag / int64(out.Expired))
+	}
+
+	return out
+}
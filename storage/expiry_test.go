@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	. "github.com/iostrovok/check"
+)
+
+func (s *testSuite) TestExpiryQueue(c *C) {
+	q := newExpiryQueue()
+	_, ok := q.next()
+	c.Assert(ok, Equals, false)
+
+	q.push("c", 30)
+	q.push("a", 10)
+	q.push("b", 20)
+	q.push("d", 40)
+
+	next, ok := q.next()
+	c.Assert(ok, Equals, true)
+	c.Assert(next, Equals, int64(10))
+
+	c.Assert(q.popDue(5), HasLen, 0)
+	c.Assert(q.popDue(20), DeepEquals, []expiryItem{{expiry: 10, id: "a"}, {expiry: 20, id: "b"}})
+	c.Assert(q.len(), Equals, 2)
+
+	next, _ = q.next()
+	c.Assert(next, Equals, int64(30))
+
+	// entries are moved and removed by id
+	q.push("c", 50)
+	c.Assert(q.len(), Equals, 2)
+	next, _ = q.next()
+	c.Assert(next, Equals, int64(40))
+
+	q.remove("d")
+	q.remove("x")
+	c.Assert(q.len(), Equals, 1)
+	c.Assert(q.popDue(100), DeepEquals, []expiryItem{{expiry: 50, id: "c"}})
+	c.Assert(q.len(), Equals, 0)
+	c.Assert(q.index, HasLen, 0)
+}
+
+func (s *testSuite) TestExpireChanged(c *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // no cleaner
+	bunch, clock := newTestBunch(ctx)
+
+	extended := uuid.New().String()
+	destroyed := uuid.New().String()
+	expired := uuid.New().String()
+	bunch.create(extended, 1, nil)
+	bunch.create(destroyed, 1, nil)
+	bunch.create(expired, 1, nil)
+	c.Assert(bunch.extend(extended, 100), Equals, true)
+	c.Assert(bunch.extend(extended, 100), Equals, true)
+	c.Assert(bunch.destroy(destroyed), Equals, true)
+
+	// extending moves the entry and destroying removes it
+	c.Assert(bunch.expiries.len(), Equals, 2)
+
+	c.Assert(bunch.expire(clock.Now().Add(2*time.Second)), Equals, 1)
+	_, find := bunch.sessions.Get(expired)
+	c.Assert(find, Equals, false)
+	_, find = bunch.get(extended)
+	c.Assert(find, Equals, true)
+
+	// entry of the extended session is in the queue
+	c.Assert(bunch.expiries.len(), Equals, 1)
+}
+
+func (s *testSuite) TestCleanerAccuracy(c *C) {
+	storage, clock := newTestStorage(context.Background())
+	for i := 0; i < 100; i++ {
+		storage.Create(1)
+	}
+
+	// cleaners wake up at the expiry, the test waits for goroutines only
+	clock.Add(time.Second)
+	for i := 0; i < 100 && storage.CleanerStats().Expired < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stats := storage.CleanerStats()
+	c.Assert(stats.Expired, Equals, uint64(100))
+	c.Assert(stats.MaxLag, Equals, time.Duration(0))
+	c.Assert(stats.AverageLag, Equals, time.Duration(0))
+	c.Assert(storage.ListAllSessions(), HasLen, 0)
+}
+
+func (s *testSuite) TestCleanerManualClock(c *C) {
+	storage, clock := newTestStorage(context.Background())
+	for i := 0; i < 100; i++ {
+		storage.Create(1)
+	}
+	storage.Create(10)
+
+	clock.Add(2 * time.Second)
+
+	// cleaners are woken by the clock, the test waits for goroutines only
+	for i := 0; i < 100 && storage.CleanerStats().Expired < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stats := storage.CleanerStats()
+	c.Assert(stats.Expired, Equals, uint64(100))
+	c.Assert(stats.MaxLag, Equals, time.Second)
+	c.Assert(stats.AverageLag, Equals, time.Second)
+	c.Assert(storage.ListAllSessions(), HasLen, 1)
+}
+
+func (s *testSuite) TestCleanerScanTimes(c *C) {
+	// cleaners are stopped, the runs are added by hand
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	storage := New(ctx, WithBunches(2))
+	storage.Bunches[0].stats.addScan(time.Microsecond)
+	storage.Bunches[0].stats.addScan(5 * time.Millisecond)
+	storage.Bunches[1].stats.addScan(5 * time.Millisecond)
+	storage.Bunches[1].stats.addScan(time.Minute)
+
+	stats := storage.CleanerStats()
+	c.Assert(stats.Scans, Equals, uint64(4))
+	c.Assert(stats.ScanTimes, DeepEquals, [len(ScanTimeBuckets)]uint64{1, 1, 1, 3, 3, 3})
+}
@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"container/heap"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/iostrovok/aura-test/response"
+)
+
+/*
+	List returns one page of sessions ordered by id, expiry ("ttl") or creation time.
+	Each bunch is scanned in its own goroutine and keeps only the first Limit sessions after the cursor
+	(bounded heap), so the memory doesn't depend on the number of sessions.
+
+	The cursor is the sort key and the id of the last session of the page. It doesn't depend on positions,
+	so sessions created or deleted between requests don't shift the next pages.
+*/
+
+const (
+	// DefaultListLimit is the page size when ListOptions.Limit is not set.
+	DefaultListLimit = 100
+	// MaxListLimit is the max page size.
+	MaxListLimit = 1000
+)
+
+// Sort orders of List.
+const (
+	SortByID      = "id"
+	SortByTTL     = "ttl"
+	SortByCreated = "created"
+
+	// sortDesc is the prefix of the descending order ("-ttl").
+	sortDesc = "-"
+)
+
+var (
+	ErrListCursor = errors.New("wrong list cursor")
+	ErrListSort   = errors.New("unknown list sort order")
+	ErrListLimit  = errors.New("list limit is out of range")
+)
+
+// ListOptions are the filters, the order and the page of List.
+type ListOptions struct {
+	Limit  int    // page size, DefaultListLimit if 0
+	Cursor string // NextCursor of the previous page, empty for the first page
+	Sort   string // "id" (default), "ttl" or "created", "-" prefix is the descending order
+	Prefix string // prefix of session id
+	MinTTL int64  // min remaining TTL in seconds, 0 - no limit
+	MaxTTL int64  // max remaining TTL in seconds, 0 - no limit
+	Owner  string // owner of sessions, empty - any owner
+}
+
+// listQuery is parsed ListOptions.
+type listQuery struct {
+	ListOptions
+	by     string
+	desc   bool
+	cursor *listItem
+	now    int64
+}
+
+type listItem struct {
+	key int64 // expiry or creation time, 0 for the order by id
+	id  string
+	s   *session
+}
+
+// listHeap is a max-heap by the order of the query: the root is the last item of the page.
+type listHeap struct {
+	q     *listQuery
+	items []listItem
+}
+
+func (h *listHeap) Len() int           { return len(h.items) }
+func (h *listHeap) Less(i, j int) bool { return h.q.before(h.items[j], h.items[i]) }
+func (h *listHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *listHeap) Push(x interface{}) { h.items = append(h.items, x.(listItem)) }
+func (h *listHeap) Pop() interface{} {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items = h.items[:n-1]
+
+	return item
+}
+
+// bunchPage is a result of one bunch.
+type bunchPage struct {
+	items []listItem
+	total int // sessions which match the filters
+	after int // sessions which match the filters and go after the cursor
+}
+
+func parseListOptions(opts ListOptions, now int64) (*listQuery, error) {
+	q := &listQuery{ListOptions: opts, now: now}
+
+	if q.Limit == 0 {
+		q.Limit = DefaultListLimit
+	}
+	if q.Limit < 0 || q.Limit > MaxListLimit {
+		return nil, ErrListLimit
+	}
+
+	if q.Sort == "" {
+		q.Sort = SortByID
+	}
+	q.by = strings.TrimPrefix(q.Sort, sortDesc)
+	q.desc = q.by != q.Sort
+	switch q.by {
+	case SortByID, SortByTTL, SortByCreated:
+	default:
+		return nil, ErrListSort
+	}
+
+	if q.Cursor != "" {
+		cursor, err := q.decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		q.cursor = cursor
+	}
+
+	return q, nil
+}
+
+// item returns the item of the session if it matches the filters.
+func (q *listQuery) item(id string, s *session) (listItem, bool) {
+	ttl := s.expiry - q.now
+	if ttl <= 0 || (q.MinTTL > 0 && ttl < q.MinTTL) || (q.MaxTTL > 0 && ttl > q.MaxTTL) {
+		return listItem{}, false
+	}
+
+	if !strings.HasPrefix(id, q.Prefix) || (q.Owner != "" && s.owner != q.Owner) {
+		return listItem{}, false
+	}
+
+	item := listItem{id: id, s: s}
+	switch q.by {
+	case SortByTTL:
+		item.key = s.expiry
+	case SortByCreated:
+		item.key = s.created
+	}
+
+	return item, true
+}
+
+// before returns true if a goes before b in the order of the query.
+func (q *listQuery) before(a, b listItem) bool {
+	if a.key != b.key {
+		return (a.key < b.key) != q.desc
+	}
+
+	if a.id == b.id {
+		return false
+	}
+
+	return (a.id < b.id) != q.desc
+}
+
+// encodeCursor returns the opaque cursor which points to the item.
+func (q *listQuery) encodeCursor(item listItem) string {
+	raw := q.Sort + "|" + strconv.FormatInt(item.key, 10) + "|" + item.id
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses the cursor. The cursor of the other sort order is wrong.
+func (q *listQuery) decodeCursor(cursor string) (*listItem, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrListCursor
+	}
+
+	parts := strings.SplitN(string(raw), "|", 3)
+	if len(parts) != 3 || parts[0] != q.Sort {
+		return nil, ErrListCursor
+	}
+
+	key, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrListCursor
+	}
+
+	return &listItem{key: key, id: parts[2]}, nil
+}
+
+// page scans the bunch and keeps the first items after the cursor.
+func (b *Bunch) page(q *listQuery) *bunchPage {
+	out := &bunchPage{}
+	h := &listHeap{q: q, items: make([]listItem, 0, q.Limit)}
+
+	for i := range b.sessions.Iter() {
+		if i.Value == nil {
+			continue
+		}
+
+		item, ok := q.item(i.Key.(string), i.Value.(*session))
+		if !ok {
+			continue
+		}
+
+		out.total++
+		if q.cursor != nil && !q.before(*q.cursor, item) {
+			continue
+		}
+
+		out.after++
+		switch {
+		case h.Len() < q.Limit:
+			heap.Push(h, item)
+		case q.before(item, h.items[0]):
+			h.items[0] = item
+			heap.Fix(h, 0)
+		}
+	}
+
+	out.items = h.items
+
+	return out
+}
+
+// List returns the page of active sessions which match the filters and the total number of them.
+func (s *Storage) List(opts ListOptions) (*response.ListPage, error) {
+	q, err := parseListOptions(opts, s.clock.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]*bunchPage, s.CountBunches)
+	wg := sync.WaitGroup{}
+	wg.Add(int(s.CountBunches))
+	for i := uint32(0); i < s.CountBunches; i++ {
+		go func(i uint32) {
+			defer wg.Done()
+			pages[i] = s.Bunches[i].page(q)
+		}(i)
+	}
+	wg.Wait()
+
+	out := &response.ListPage{Sessions: make([]response.List, 0)}
+	items := make([]listItem, 0)
+	after := 0
+	for _, p := range pages {
+		out.Total += p.total
+		after += p.after
+		items = append(items, p.items...)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return q.before(items[i], items[j])
+	})
+	if len(items) > q.Limit {
+		items = items[:q.Limit]
+	}
+
+	for _, item := range items {
+		out.Sessions = append(out.Sessions, item.s.listItem(item.id, q.now))
+	}
+
+	if after > len(items) {
+		out.NextCursor = q.encodeCursor(items[len(items)-1])
+	}
+
+	return out, nil
+}
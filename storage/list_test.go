@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	. "github.com/iostrovok/check"
+)
+
+// helper.
+func listAll(c *C, storage *Storage, opts ListOptions) []string {
+	ids := make([]string, 0)
+	for {
+		page, err := storage.List(opts)
+		c.Assert(err, IsNil)
+		for _, l := range page.Sessions {
+			ids = append(ids, l.ID)
+		}
+
+		if page.NextCursor == "" {
+			return ids
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+func (s *testSuite) TestListPages(c *C) {
+	storage, _ := newTestStorage(context.Background())
+
+	ids := make([]string, 250)
+	for i := range ids {
+		ids[i], _ = storage.Create(30)
+	}
+	sort.Strings(ids)
+
+	page, err := storage.List(ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(page.Total, Equals, 250)
+	c.Assert(page.Sessions, HasLen, DefaultListLimit)
+	c.Assert(page.Sessions[0].ID, Equals, ids[0])
+	c.Assert(page.Sessions[0].TTL, Equals, 30)
+	c.Assert(page.NextCursor, Not(Equals), "")
+
+	c.Assert(listAll(c, storage, ListOptions{Limit: 7}), DeepEquals, ids)
+
+	// descending order
+	desc := listAll(c, storage, ListOptions{Limit: 30, Sort: "-id"})
+	c.Assert(desc, HasLen, 250)
+	c.Assert(desc[0], Equals, ids[249])
+	c.Assert(desc[249], Equals, ids[0])
+
+	// the last page has no cursor
+	page, err = storage.List(ListOptions{Limit: 250})
+	c.Assert(err, IsNil)
+	c.Assert(page.Sessions, HasLen, 250)
+	c.Assert(page.NextCursor, Equals, "")
+}
+
+func (s *testSuite) TestListSortFilters(c *C) {
+	storage, clock := newTestStorage(context.Background())
+
+	first, _ := storage.Create(30)
+	clock.Add(time.Second)
+	second, _ := storage.Create(10)
+	clock.Add(time.Second)
+	third, _ := storage.Create(20)
+
+	c.Assert(listAll(c, storage, ListOptions{Limit: 1, Sort: SortByTTL}), DeepEquals, []string{second, third, first})
+	c.Assert(listAll(c, storage, ListOptions{Limit: 2, Sort: "-ttl"}), DeepEquals, []string{first, third, second})
+	c.Assert(listAll(c, storage, ListOptions{Limit: 1, Sort: SortByCreated}), DeepEquals, []string{first, second, third})
+
+	// remaining TTL: 28, 9 and 20
+	page, err := storage.List(ListOptions{MinTTL: 10, MaxTTL: 25})
+	c.Assert(err, IsNil)
+	c.Assert(page.Total, Equals, 1)
+	c.Assert(page.Sessions[0].ID, Equals, third)
+
+	page, err = storage.List(ListOptions{Prefix: second[:8]})
+	c.Assert(err, IsNil)
+	c.Assert(page.Sessions[0].ID, Equals, second)
+
+	// expired sessions are not listed
+	clock.Add(10 * time.Second)
+	page, err = storage.List(ListOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(page.Total, Equals, 2)
+}
+
+func (s *testSuite) TestListWrongOptions(c *C) {
+	storage, _ := newTestStorage(context.Background())
+
+	_, err := storage.List(ListOptions{Limit: MaxListLimit + 1})
+	c.Assert(err, Equals, ErrListLimit)
+
+	_, err = storage.List(ListOptions{Sort: "data"})
+	c.Assert(err, Equals, ErrListSort)
+
+	_, err = storage.List(ListOptions{Cursor: "???"})
+	c.Assert(err, Equals, ErrListCursor)
+
+	// the cursor of the other order
+	for i := 0; i < 3; i++ {
+		_, _ = storage.Create(30)
+	}
+	page, err := storage.List(ListOptions{Limit: 1, Sort: SortByTTL})
+	c.Assert(err, IsNil)
+	_, err = storage.List(ListOptions{Limit: 1, Cursor: page.NextCursor})
+	c.Assert(err, Equals, ErrListCursor)
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/iostrovok/aura-test/response"
+)
+
+/*
+	Sessions with owners are indexed by their owners, so all sessions of a user may be found
+	or destroyed at once ("log out everywhere"). The number of sessions of an owner may be limited
+	by WithMaxOwnerSessions: the oldest sessions of the owner are evicted by new ones.
+*/
+
+// OwnerIndex is implemented by storage backends which index sessions by owners.
+type OwnerIndex interface {
+	// OwnerSessions returns active sessions of the owner.
+	OwnerSessions(owner string) []response.List
+	// DestroyOwner destroys all sessions of the owner and returns their number.
+	DestroyOwner(owner string) int
+}
+
+// check that Storage implements OwnerIndex.
+var _ OwnerIndex = (*Storage)(nil)
+
+// WithMaxOwnerSessions sets the limit of sessions of one owner, the oldest sessions of the owner
+// are evicted by new ones. Zero means no limit.
+func WithMaxOwnerSessions(count int) Option {
+	return func(s *Storage) {
+		s.maxOwnerSessions = count
+	}
+}
+
+// OwnerSessions returns active sessions of the owner sorted by id.
+func (s *Storage) OwnerSessions(owner string) []response.List {
+	now := s.clock.Now().Unix()
+
+	out := make([]response.List, 0)
+	for _, id := range s.owners.ids(owner) {
+		b, ok := s.bunchOf(id)
+		if !ok {
+			continue
+		}
+
+		if l, ok := b.item(id, now); ok {
+			out = append(out, l)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+
+	return out
+}
+
+// DestroyOwner destroys all sessions of the owner and returns their number.
+func (s *Storage) DestroyOwner(owner string) int {
+	count := 0
+	for _, id := range s.owners.ids(owner) {
+		if s.Destroy(id) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// ownerVictims returns the oldest sessions of the owner which should be evicted to make room for a new one.
+// It's called under capacityMu.
+func (s *Storage) ownerVictims(owner string) []string {
+	return s.owners.oldest(owner, s.owners.count(owner)-s.maxOwnerSessions+1)
+}
+
+// evictOwned evicts sessions of the owner. It's called under capacityMu.
+func (s *Storage) evictOwned(owner string, ids []string) {
+	for _, id := range ids {
+		if b, ok := s.bunchOf(id); !ok || !b.evict(id) {
+			// the index is ahead of the bunch
+			s.owners.remove(owner, id)
+		}
+	}
+}
+
+// ownerIndex keeps ids of sessions by owners.
+type ownerIndex struct {
+	sync.RWMutex
+
+	owners map[string]map[string]ownerItem // owner => id => order of creating
+	seq    uint64
+}
+
+// ownerItem orders sessions of an owner by creating time, sessions created in the same second
+// are ordered by adding to the index.
+type ownerItem struct {
+	created int64
+	seq     uint64
+}
+
+func (i ownerItem) before(other ownerItem) bool {
+	return i.created < other.created || (i.created == other.created && i.seq < other.seq)
+}
+
+func newOwnerIndex() *ownerIndex {
+	return &ownerIndex{owners: make(map[string]map[string]ownerItem)}
+}
+
+func (x *ownerIndex) add(owner, id string, created int64) {
+	x.Lock()
+	defer x.Unlock()
+
+	ids, ok := x.owners[owner]
+	if !ok {
+		ids = make(map[string]ownerItem)
+		x.owners[owner] = ids
+	}
+	x.seq++
+	ids[id] = ownerItem{created: created, seq: x.seq}
+}
+
+func (x *ownerIndex) remove(owner, id string) {
+	x.Lock()
+	defer x.Unlock()
+
+	if ids, ok := x.owners[owner]; ok {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(x.owners, owner)
+		}
+	}
+}
+
+// ids returns ids of sessions of the owner.
+func (x *ownerIndex) ids(owner string) []string {
+	x.RLock()
+	defer x.RUnlock()
+
+	out := make([]string, 0, len(x.owners[owner]))
+	for id := range x.owners[owner] {
+		out = append(out, id)
+	}
+
+	return out
+}
+
+func (x *ownerIndex) count(owner string) int {
+	x.RLock()
+	defer x.RUnlock()
+
+	return len(x.owners[owner])
+}
+
+// oldest returns up to n first created sessions of the owner in the order of creating.
+func (x *ownerIndex) oldest(owner string, n int) []string {
+	x.RLock()
+	defer x.RUnlock()
+
+	if n <= 0 {
+		return nil
+	}
+
+	ids := x.owners[owner]
+	out := make([]string, 0, len(ids))
+	for id := range ids {
+		out = append(out, id)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return ids[out[i]].before(ids[out[j]])
+	})
+
+	if len(out) > n {
+		out = out[:n]
+	}
+
+	return out
+}
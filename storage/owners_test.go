@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/iostrovok/check"
+)
+
+// helper.
+func ownerIDs(storage *Storage, owner string) []string {
+	out := make([]string, 0)
+	for _, l := range storage.OwnerSessions(owner) {
+		out = append(out, l.ID)
+	}
+
+	return out
+}
+
+func (s *testSuite) TestOwnerSessions(c *C) {
+	storage, clock := newTestStorage(context.Background())
+
+	ids := make([]string, 0)
+	for i := 0; i < 3; i++ {
+		id, err := storage.Create(10, SessionOwner("user-1"))
+		c.Assert(err, IsNil)
+		ids = append(ids, id)
+	}
+	other, _ := storage.Create(10, SessionOwner("user-2"))
+	_, _ = storage.Create(10)
+	sort.Strings(ids)
+
+	c.Assert(ownerIDs(storage, "user-1"), DeepEquals, ids)
+	c.Assert(ownerIDs(storage, "user-2"), DeepEquals, []string{other})
+	c.Assert(storage.OwnerSessions("nobody"), HasLen, 0)
+	c.Assert(storage.OwnerSessions("user-1")[0].Owner, Equals, "user-1")
+
+	// destroyed and expired sessions leave the index
+	c.Assert(storage.Destroy(ids[0]), Equals, true)
+	c.Assert(ownerIDs(storage, "user-1"), DeepEquals, ids[1:])
+
+	c.Assert(storage.DestroyOwner("user-1"), Equals, 2)
+	c.Assert(storage.OwnerSessions("user-1"), HasLen, 0)
+	c.Assert(storage.DestroyOwner("user-1"), Equals, 0)
+	c.Assert(storage.Len(), Equals, 2)
+
+	clock.Add(11 * time.Second)
+	c.Assert(storage.OwnerSessions("user-2"), HasLen, 0)
+	for i := uint32(0); i < storage.CountBunches; i++ {
+		storage.Bunches[i].expire(clock.Now())
+	}
+	c.Assert(storage.owners.owners, HasLen, 0)
+}
+
+func (s *testSuite) TestMaxOwnerSessions(c *C) {
+	clock := NewManualClock(testNow)
+	storage := New(context.Background(), WithClock(clock), WithMaxOwnerSessions(2))
+
+	first, _ := storage.Create(100, SessionOwner("user-1"))
+	clock.Add(time.Second)
+	second, _ := storage.Create(100, SessionOwner("user-1"))
+	clock.Add(time.Second)
+	_, _ = storage.Create(100, SessionOwner("user-2"))
+	_, _ = storage.Create(100)
+	_, _ = storage.Create(100)
+
+	third, err := storage.Create(100, SessionOwner("user-1"))
+	c.Assert(err, IsNil)
+
+	ids := []string{second, third}
+	sort.Strings(ids)
+	c.Assert(ownerIDs(storage, "user-1"), DeepEquals, ids)
+	_, find := storage.Get(first)
+	c.Assert(find, Equals, false)
+	c.Assert(storage.Len(), Equals, 5)
+	c.Assert(storage.Stats().Evicted, Equals, uint64(1))
+}
+
+func (s *testSuite) TestMaxOwnerSessionsFull(c *C) {
+	clock := NewManualClock(testNow)
+	// room for 3 sessions of owners without data
+	storage := New(context.Background(), WithClock(clock), WithMaxOwnerSessions(2), WithMaxMemory(3*(sessionOverhead+36+6)))
+
+	first, _ := storage.Create(100, SessionOwner("user-1"))
+	clock.Add(time.Second)
+	second, _ := storage.Create(100, SessionOwner("user-1"))
+	_, err := storage.Create(100, SessionOwner("user-2"))
+	c.Assert(err, IsNil)
+
+	// the room of the oldest session of the owner is not enough, nothing is evicted
+	_, err = storage.Create(100, SessionOwner("user-1"), SessionData([]byte(`{"a":"`+strings.Repeat("a", 92)+`"}`)))
+	c.Assert(err, Equals, ErrFull)
+	_, find := storage.Get(first)
+	c.Assert(find, Equals, true)
+	c.Assert(storage.Stats().Evicted, Equals, uint64(0))
+
+	third, err := storage.Create(100, SessionOwner("user-1"))
+	c.Assert(err, IsNil)
+
+	ids := []string{second, third}
+	sort.Strings(ids)
+	c.Assert(ownerIDs(storage, "user-1"), DeepEquals, ids)
+	c.Assert(storage.Len(), Equals, 3)
+	c.Assert(storage.Stats().Evicted, Equals, uint64(1))
+}
+
+func (s *testSuite) TestOwnerSessionsRestore(c *C) {
+	path := filepath.Join(c.MkDir(), "sessions.snapshot")
+
+	storage := New(context.Background(), WithSnapshot(path, 0))
+	id, _ := storage.Create(100, SessionOwner("user-1"))
+	c.Assert(storage.Close(), IsNil)
+
+	storage = New(context.Background(), WithSnapshot(path, 0))
+	defer storage.Close()
+	c.Assert(ownerIDs(storage, "user-1"), DeepEquals, []string{id})
+}
@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/iostrovok/aura-test/response"
+)
+
+const (
+	// DefaultMaxDataSize is a default limit of the session data (in bytes).
+	DefaultMaxDataSize = 16 * 1024
+	// MaxOwnerSize is a limit of the session owner (in bytes).
+	MaxOwnerSize = 256
+)
+
+var (
+	ErrNotFound     = errors.New("session is not found")
+	ErrDataTooLarge = errors.New("session data is too large")
+	ErrWrongData    = errors.New("session data should be JSON object")
+	ErrWrongOwner   = errors.New("session owner is too long")
+)
+
+// sessionFormat is a version of the binary session format used by the snapshot and the write-ahead log.
+const sessionFormat = byte(4)
+
+var ErrSessionFormat = errors.New("wrong binary format of session")
+
+// session is a value of Bunch.sessions.
+// It is never changed after storing: any update replaces the value.
+type session struct {
+	expiry   int64
+	slide    int64 // sliding expiration (seconds), 0 - fixed expiration
+	created  int64
+	deadline int64 // absolute expiry which can't be exceeded, 0 - no limit
+	owner    string
+	tags     []string // sorted "key=value", see tags.go
+	data     []byte
+}
+
+// withExpiry returns copy of the session with new expiry limited by the deadline.
+func (s *session) withExpiry(expiry int64) *session {
+	out := *s
+	out.expiry = s.limit(expiry)
+
+	return &out
+}
+
+// withData returns copy of the session with new data.
+func (s *session) withData(data []byte) *session {
+	out := *s
+	out.data = data
+
+	return &out
+}
+
+// response converts the session to the server response.
+func (s *session) response(id string, now int64) *response.Session {
+	out := &response.Session{ID: id, TTL: int(s.expiry - now), Created: s.created, Owner: s.owner, Tags: s.tags, Data: s.data}
+	if s.deadline > 0 {
+		out.AbsoluteTTL = int(s.deadline - now)
+	}
+
+	return out
+}
+
+// listItem converts the session to the item of sessions list.
+func (s *session) listItem(id string, now int64) response.List {
+	out := response.List{ID: id, TTL: int(s.expiry - now), DataSize: len(s.data), Owner: s.owner, Tags: s.tags}
+	if s.deadline > 0 {
+		out.AbsoluteTTL = int(s.deadline - now)
+	}
+
+	return out
+}
+
+// tagsSize returns the size of tags (in bytes).
+func (s *session) tagsSize() int {
+	size := 0
+	for _, tag := range s.tags {
+		size += len(tag)
+	}
+
+	return size
+}
+
+// limit returns expiry which doesn't exceed the deadline.
+func (s *session) limit(expiry int64) int64 {
+	if s.deadline > 0 && expiry > s.deadline {
+		return s.deadline
+	}
+
+	return expiry
+}
+
+// sessionParams are optional parameters of the new session.
+type sessionParams struct {
+	data        []byte
+	slide       uint32
+	maxLifetime uint32
+	owner       string
+	tagMap      map[string]string // set by SessionTags
+	tags        []string          // prepared tagMap
+}
+
+// SessionOption sets optional parameter of the new session.
+type SessionOption func(p *sessionParams)
+
+// SessionData attaches JSON object (user id, roles, any key/values) to the new session.
+func SessionData(data []byte) SessionOption {
+	return func(p *sessionParams) {
+		p.data = data
+	}
+}
+
+// SessionSliding makes expiration of the new session sliding: each successful lookup
+// moves expiry to slide seconds from now (but no more then the max extended TTL of the storage).
+func SessionSliding(slide uint32) SessionOption {
+	return func(p *sessionParams) {
+		p.slide = slide
+	}
+}
+
+// SessionMaxLifetime sets absolute max lifetime (in seconds) of the new session.
+// Extending and sliding never move expiry after creation time + maxLifetime.
+// Zero value means the default max lifetime of the storage.
+func SessionMaxLifetime(maxLifetime uint32) SessionOption {
+	return func(p *sessionParams) {
+		if maxLifetime > 0 {
+			p.maxLifetime = maxLifetime
+		}
+	}
+}
+
+// SessionOwner sets the owner (user or tenant) of the new session. It's limited by MaxOwnerSize.
+func SessionOwner(owner string) SessionOption {
+	return func(p *sessionParams) {
+		p.owner = owner
+	}
+}
+
+// marshalBinary encodes the session (big endian):
+// format (1 byte), expiry (int64), slide (uint32), created (int64, since format 2),
+// deadline (int64, since format 2), size of owner (uint16, since format 3), owner,
+// number of tags (uint16, since format 4), size of tag (uint16) and tag for each tag,
+// size of data (uint32), data.
+func (s *session) marshalBinary() []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, 37+len(s.owner)+s.tagsSize()+2*len(s.tags)+len(s.data)))
+	buf.WriteByte(sessionFormat)
+	_ = binary.Write(buf, binary.BigEndian, s.expiry)
+	_ = binary.Write(buf, binary.BigEndian, uint32(s.slide))
+	_ = binary.Write(buf, binary.BigEndian, s.created)
+	_ = binary.Write(buf, binary.BigEndian, s.deadline)
+	_ = binary.Write(buf, binary.BigEndian, uint16(len(s.owner)))
+	buf.WriteString(s.owner)
+	_ = binary.Write(buf, binary.BigEndian, uint16(len(s.tags)))
+	for _, tag := range s.tags {
+		_ = binary.Write(buf, binary.BigEndian, uint16(len(tag)))
+		buf.WriteString(tag)
+	}
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(s.data)))
+	buf.Write(s.data)
+
+	return buf.Bytes()
+}
+
+// unmarshalSession decodes the session encoded by marshalBinary of the current or the previous formats.
+func unmarshalSession(buf []byte) (*session, error) {
+	r := bytes.NewReader(buf)
+
+	format, err := r.ReadByte()
+	if err != nil || format < 1 || format > sessionFormat {
+		return nil, ErrSessionFormat
+	}
+
+	s := &session{}
+	slide := uint32(0)
+	size := uint32(0)
+
+	fields := []interface{}{&s.expiry, &slide}
+	if format > 1 {
+		fields = append(fields, &s.created, &s.deadline)
+	}
+
+	for _, f := range fields {
+		if err := binary.Read(r, binary.BigEndian, f); err != nil {
+			return nil, ErrSessionFormat
+		}
+	}
+
+	if format > 2 {
+		ownerSize := uint16(0)
+		if err := binary.Read(r, binary.BigEndian, &ownerSize); err != nil || int(ownerSize) > r.Len() {
+			return nil, ErrSessionFormat
+		}
+
+		owner := make([]byte, ownerSize)
+		_, _ = r.Read(owner)
+		s.owner = string(owner)
+	}
+
+	if format > 3 {
+		count := uint16(0)
+		if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+			return nil, ErrSessionFormat
+		}
+
+		for i := uint16(0); i < count; i++ {
+			tagSize := uint16(0)
+			if err := binary.Read(r, binary.BigEndian, &tagSize); err != nil || int(tagSize) > r.Len() {
+				return nil, ErrSessionFormat
+			}
+
+			tag := make([]byte, tagSize)
+			_, _ = r.Read(tag)
+			s.tags = append(s.tags, string(tag))
+		}
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, ErrSessionFormat
+	}
+
+	if uint32(r.Len()) != size {
+		return nil, ErrSessionFormat
+	}
+
+	s.slide = int64(slide)
+	if size > 0 {
+		s.data = make([]byte, size)
+		_, _ = r.Read(s.data)
+	}
+
+	return s, nil
+}
+
+// prepareData checks the size and the format of data and returns compacted JSON.
+func prepareData(data []byte, maxSize int) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	if len(data) > maxSize {
+		return nil, ErrDataTooLarge
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)))
+	if err := json.Compact(buf, data); err != nil || buf.Len() == 0 || buf.Bytes()[0] != '{' {
+		return nil, ErrWrongData
+	}
+
+	return buf.Bytes(), nil
+}
+
+// mergeData applies patch to data like JSON merge patch on the top level keys: null value deletes the key.
+func mergeData(data, patch []byte) ([]byte, error) {
+	out := map[string]json.RawMessage{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &out); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := map[string]json.RawMessage{}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, ErrWrongData
+	}
+
+	for k, v := range changes {
+		if string(v) == "null" {
+			delete(out, k)
+		} else {
+			out[k] = v
+		}
+	}
+
+	if len(out) == 0 {
+		return nil, nil
+	}
+
+	return json.Marshal(out)
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	. "github.com/iostrovok/check"
+)
+
+func (s *testSuite) TestSessionBinary(c *C) {
+	in := &session{expiry: 100, slide: 10, created: 50, deadline: 200, owner: "user-1",
+		tags: []string{"app=mobile", "region=eu"}, data: []byte(`{"user":"bla"}`)}
+	out, err := unmarshalSession(in.marshalBinary())
+	c.Assert(err, IsNil)
+	c.Assert(out, DeepEquals, in)
+
+	in = &session{expiry: 100}
+	out, err = unmarshalSession(in.marshalBinary())
+	c.Assert(err, IsNil)
+	c.Assert(out, DeepEquals, in)
+
+	_, err = unmarshalSession(in.marshalBinary()[:10])
+	c.Assert(err, Equals, ErrSessionFormat)
+
+	_, err = unmarshalSession([]byte{99})
+	c.Assert(err, Equals, ErrSessionFormat)
+}
+
+func (s *testSuite) TestSessionBinaryFormat1(c *C) {
+	// format (1), expiry, slide, size of data, data
+	buf := bytes.NewBuffer([]byte{1})
+	_ = binary.Write(buf, binary.BigEndian, int64(100))
+	_ = binary.Write(buf, binary.BigEndian, uint32(10))
+	_ = binary.Write(buf, binary.BigEndian, uint32(2))
+	buf.WriteString(`{}`)
+
+	out, err := unmarshalSession(buf.Bytes())
+	c.Assert(err, IsNil)
+	c.Assert(out, DeepEquals, &session{expiry: 100, slide: 10, data: []byte(`{}`)})
+}
+
+func (s *testSuite) TestSessionBinaryFormat2(c *C) {
+	// format (2), expiry, slide, created, deadline, size of data, data
+	buf := bytes.NewBuffer([]byte{2})
+	_ = binary.Write(buf, binary.BigEndian, int64(100))
+	_ = binary.Write(buf, binary.BigEndian, uint32(10))
+	_ = binary.Write(buf, binary.BigEndian, int64(50))
+	_ = binary.Write(buf, binary.BigEndian, int64(200))
+	_ = binary.Write(buf, binary.BigEndian, uint32(2))
+	buf.WriteString(`{}`)
+
+	out, err := unmarshalSession(buf.Bytes())
+	c.Assert(err, IsNil)
+	c.Assert(out, DeepEquals, &session{expiry: 100, slide: 10, created: 50, deadline: 200, data: []byte(`{}`)})
+}
+
+func (s *testSuite) TestSessionBinaryFormat3(c *C) {
+	// format (3), expiry, slide, created, deadline, size of owner, owner, size of data, data
+	buf := bytes.NewBuffer([]byte{3})
+	_ = binary.Write(buf, binary.BigEndian, int64(100))
+	_ = binary.Write(buf, binary.BigEndian, uint32(10))
+	_ = binary.Write(buf, binary.BigEndian, int64(50))
+	_ = binary.Write(buf, binary.BigEndian, int64(200))
+	_ = binary.Write(buf, binary.BigEndian, uint16(6))
+	buf.WriteString("user-1")
+	_ = binary.Write(buf, binary.BigEndian, uint32(2))
+	buf.WriteString(`{}`)
+
+	out, err := unmarshalSession(buf.Bytes())
+	c.Assert(err, IsNil)
+	c.Assert(out, DeepEquals, &session{expiry: 100, slide: 10, created: 50, deadline: 200, owner: "user-1", data: []byte(`{}`)})
+}
+
+func (s *testSuite) TestSessionLimit(c *C) {
+	in := &session{expiry: 100, deadline: 150}
+	c.Assert(in.withExpiry(200).expiry, Equals, int64(150))
+	c.Assert(in.withExpiry(120).expiry, Equals, int64(120))
+	c.Assert(in.expiry, Equals, int64(100))
+
+	in = &session{expiry: 100}
+	c.Assert(in.withExpiry(200).expiry, Equals, int64(200))
+}
+
+func (s *testSuite) TestMergeData(c *C) {
+	out, err := mergeData([]byte(`{"a":1,"b":2}`), []byte(`{"b":null,"c":[3]}`))
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, `{"a":1,"c":[3]}`)
+
+	out, err = mergeData(nil, []byte(`{"a":1}`))
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, `{"a":1}`)
+
+	out, err = mergeData([]byte(`{"a":1}`), []byte(`{"a":null}`))
+	c.Assert(err, IsNil)
+	c.Assert(out, IsNil)
+
+	_, err = mergeData(nil, []byte(`[1]`))
+	c.Assert(err, Equals, ErrWrongData)
+}
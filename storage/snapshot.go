@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+	Snapshot file format (big endian):
+
+		header:  magic "AURASNAP" (8 bytes), version (uint32), count of records (uint64)
+		records: session id (36 bytes), size of session (uint32), session (see session.marshalBinary)
+		trailer: CRC32 (IEEE) of header and records (uint32)
+
+	Old versions of records:
+		version 1: session id (36 bytes), absolute expiry in unix seconds (int64)
+		version 2: session id (36 bytes), absolute expiry in unix seconds (int64), size of data (uint32), data
+*/
+
+const (
+	snapshotMagic       = "AURASNAP"
+	snapshotVersion     = uint32(3)
+	snapshotHeaderSize  = 8 + 4 + 8
+	snapshotRecordSize  = 36 + 4 // fixed part of the record
+	snapshotTrailerSize = 4
+)
+
+var (
+	ErrSnapshotCorrupted = errors.New("snapshot is corrupted")
+	ErrSnapshotVersion   = errors.New("unsupported snapshot version")
+)
+
+// snapshotRecord is one session in the snapshot.
+type snapshotRecord struct {
+	ID      string
+	Session *session
+}
+
+// writeSnapshot writes records to w in the snapshot format.
+func writeSnapshot(w io.Writer, records []snapshotRecord) error {
+	buf := bytes.NewBuffer(make([]byte, 0, snapshotHeaderSize+len(records)*(snapshotRecordSize+4)+snapshotTrailerSize))
+
+	buf.WriteString(snapshotMagic)
+	_ = binary.Write(buf, binary.BigEndian, snapshotVersion)
+	_ = binary.Write(buf, binary.BigEndian, uint64(len(records)))
+
+	for _, r := range records {
+		if len(r.ID) != 36 {
+			return errors.New("wrong session id: " + r.ID)
+		}
+		data := r.Session.marshalBinary()
+		buf.WriteString(r.ID)
+		_ = binary.Write(buf, binary.BigEndian, uint32(len(data)))
+		buf.Write(data)
+	}
+
+	_ = binary.Write(buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes()))
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+// readSnapshot reads and verifies the whole snapshot. Nothing is returned if the snapshot is corrupted.
+func readSnapshot(r io.Reader) ([]snapshotRecord, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < snapshotHeaderSize+snapshotTrailerSize || string(data[:8]) != snapshotMagic {
+		return nil, ErrSnapshotCorrupted
+	}
+
+	body, trailer := data[:len(data)-snapshotTrailerSize], data[len(data)-snapshotTrailerSize:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(trailer) {
+		return nil, ErrSnapshotCorrupted
+	}
+
+	version := binary.BigEndian.Uint32(body[8:12])
+	if version < 1 || version > snapshotVersion {
+		return nil, ErrSnapshotVersion
+	}
+
+	count := binary.BigEndian.Uint64(body[12:20])
+	body = body[snapshotHeaderSize:]
+
+	records := make([]snapshotRecord, 0)
+	for len(body) > 0 {
+		var (
+			r   snapshotRecord
+			err error
+		)
+
+		if version < 3 {
+			r, body, err = readSnapshotRecordV2(body, version)
+		} else {
+			r, body, err = readSnapshotRecord(body)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, r)
+	}
+
+	if uint64(len(records)) != count {
+		return nil, ErrSnapshotCorrupted
+	}
+
+	return records, nil
+}
+
+// readSnapshotRecord reads one record and returns the rest of data.
+func readSnapshotRecord(body []byte) (snapshotRecord, []byte, error) {
+	if len(body) < snapshotRecordSize {
+		return snapshotRecord{}, nil, ErrSnapshotCorrupted
+	}
+
+	size := uint64(binary.BigEndian.Uint32(body[36:40]))
+	if uint64(len(body)-snapshotRecordSize) < size {
+		return snapshotRecord{}, nil, ErrSnapshotCorrupted
+	}
+
+	s, err := unmarshalSession(body[snapshotRecordSize : snapshotRecordSize+size])
+	if err != nil {
+		return snapshotRecord{}, nil, ErrSnapshotCorrupted
+	}
+
+	return snapshotRecord{ID: string(body[:36]), Session: s}, body[snapshotRecordSize+size:], nil
+}
+
+// readSnapshotRecordV2 reads one record of version 1 or 2 and returns the rest of data.
+func readSnapshotRecordV2(body []byte, version uint32) (snapshotRecord, []byte, error) {
+	if len(body) < 36+8 {
+		return snapshotRecord{}, nil, ErrSnapshotCorrupted
+	}
+
+	r := snapshotRecord{
+		ID:      string(body[:36]),
+		Session: &session{expiry: int64(binary.BigEndian.Uint64(body[36:44]))},
+	}
+	body = body[36+8:]
+
+	if version == 2 {
+		if len(body) < 4 || uint64(len(body)-4) < uint64(binary.BigEndian.Uint32(body[:4])) {
+			return snapshotRecord{}, nil, ErrSnapshotCorrupted
+		}
+
+		size := int(binary.BigEndian.Uint32(body[:4]))
+		if size > 0 {
+			r.Session.data = append([]byte{}, body[4:4+size]...)
+		}
+		body = body[4+size:]
+	}
+
+	return r, body, nil
+}
+
+// Snapshot saves all live sessions to the snapshot file.
+// The file is replaced atomically, so a crash during saving keeps the previous snapshot.
+func (s *Storage) Snapshot() error {
+	if s.snapshotPath == "" {
+		return nil
+	}
+
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	// all changes after this point are kept by the new log
+	if s.wal != nil {
+		if err := s.wal.rotate(); err != nil {
+			return err
+		}
+	}
+
+	records := make([]snapshotRecord, 0)
+	for i := uint32(0); i < s.CountBunches; i++ {
+		records = s.Bunches[i].snapshot(records)
+	}
+
+	tmp := s.snapshotPath + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if err := writeSnapshot(f, records); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, s.snapshotPath); err != nil {
+		return err
+	}
+
+	if s.wal != nil {
+		return s.wal.compact()
+	}
+
+	return nil
+}
+
+// loadSnapshot restores sessions from the snapshot file. Already expired sessions are dropped.
+func (s *Storage) loadSnapshot() error {
+	f, err := os.Open(s.snapshotPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// first start
+			return nil
+		}
+
+		return err
+	}
+	defer f.Close()
+
+	records, err := readSnapshot(f)
+	if err != nil {
+		return err
+	}
+
+	now := s.clock.Now().Unix()
+	for _, r := range records {
+		u, err := uuid.Parse(r.ID)
+		if err != nil || r.Session.expiry <= now {
+			continue
+		}
+
+		s.getBunches(u).set(r.ID, r.Session)
+	}
+
+	return nil
+}
+
+// snapshotter saves snapshots periodically and once more when the context is done.
+func (s *Storage) snapshotter() {
+	var tick <-chan time.Time
+	if s.snapshotInterval > 0 {
+		ticker := time.NewTicker(s.snapshotInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			if err := s.Snapshot(); err != nil {
+				logrus.Errorf("snapshot: %s", err.Error())
+				s.closeErr = err
+			}
+
+			return
+		case <-tick:
+			if err := s.Snapshot(); err != nil {
+				logrus.Errorf("snapshot: %s", err.Error())
+			}
+		}
+	}
+}
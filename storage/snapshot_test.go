@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+
+	. "github.com/iostrovok/check"
+)
+
+func (s *testSuite) TestSnapshotReadWrite(c *C) {
+	records := []snapshotRecord{
+		{ID: uuid.New().String(), Session: &session{expiry: 100}},
+		{ID: uuid.New().String(), Session: &session{expiry: 200, slide: 10, data: []byte(`{"user":"bla"}`)}},
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	c.Assert(writeSnapshot(buf, records), IsNil)
+
+	out, err := readSnapshot(bytes.NewReader(buf.Bytes()))
+	c.Assert(err, IsNil)
+	c.Assert(out, DeepEquals, records)
+
+	// empty snapshot
+	buf.Reset()
+	c.Assert(writeSnapshot(buf, nil), IsNil)
+	out, err = readSnapshot(buf)
+	c.Assert(err, IsNil)
+	c.Assert(out, HasLen, 0)
+}
+
+func (s *testSuite) TestSnapshotVersion1(c *C) {
+	id := uuid.New().String()
+
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString(snapshotMagic)
+	_ = binary.Write(buf, binary.BigEndian, uint32(1))
+	_ = binary.Write(buf, binary.BigEndian, uint64(1))
+	buf.WriteString(id)
+	_ = binary.Write(buf, binary.BigEndian, int64(100))
+	_ = binary.Write(buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes()))
+
+	out, err := readSnapshot(buf)
+	c.Assert(err, IsNil)
+	c.Assert(out, DeepEquals, []snapshotRecord{{ID: id, Session: &session{expiry: 100}}})
+}
+
+func (s *testSuite) TestSnapshotCorrupted(c *C) {
+	buf := bytes.NewBuffer([]byte{})
+	c.Assert(writeSnapshot(buf, []snapshotRecord{{ID: uuid.New().String(), Session: &session{expiry: 100}}}), IsNil)
+	data := buf.Bytes()
+
+	_, err := readSnapshot(bytes.NewReader(data[:len(data)-1]))
+	c.Assert(err, Equals, ErrSnapshotCorrupted)
+
+	_, err = readSnapshot(bytes.NewReader([]byte("bla-bla")))
+	c.Assert(err, Equals, ErrSnapshotCorrupted)
+
+	_, err = readSnapshot(bytes.NewReader(data[:snapshotHeaderSize+10]))
+	c.Assert(err, Equals, ErrSnapshotCorrupted)
+
+	broken := append([]byte{}, data...)
+	broken[snapshotHeaderSize+2] ^= 0xFF
+	_, err = readSnapshot(bytes.NewReader(broken))
+	c.Assert(err, Equals, ErrSnapshotCorrupted)
+}
+
+func (s *testSuite) TestSnapshotRestore(c *C) {
+	path := filepath.Join(c.MkDir(), "sessions.snapshot")
+
+	clock := NewManualClock(testNow)
+	ctx, cancel := context.WithCancel(context.Background())
+	storage := New(ctx, WithSnapshot(path, 0), WithClock(clock))
+	id, _ := storage.Create(30, SessionData([]byte(`{"user":"bla"}`)))
+	expired, _ := storage.Create(1)
+	c.Assert(storage.Snapshot(), IsNil)
+	cancel()
+
+	clock.Add(2 * time.Second)
+
+	restored := New(context.Background(), WithSnapshot(path, 0), WithClock(clock))
+	session, find := restored.Get(id)
+	c.Assert(find, Equals, true)
+	c.Assert(session.TTL > 0 && session.TTL <= 30, Equals, true)
+	c.Assert(string(session.Data), Equals, `{"user":"bla"}`)
+
+	_, find = restored.Get(expired)
+	c.Assert(find, Equals, false)
+}
+
+func (s *testSuite) TestSnapshotOnClose(c *C) {
+	path := filepath.Join(c.MkDir(), "sessions.snapshot")
+
+	storage := New(context.Background(), WithSnapshot(path, 0))
+	id, _ := storage.Create(30)
+	c.Assert(storage.Close(), IsNil)
+
+	restored := New(context.Background(), WithSnapshot(path, 0))
+	defer restored.Close()
+	_, find := restored.Get(id)
+	c.Assert(find, Equals, true)
+}
+
+func (s *testSuite) TestSnapshotRestoreCorrupted(c *C) {
+	path := filepath.Join(c.MkDir(), "sessions.snapshot")
+	c.Assert(os.WriteFile(path, []byte(snapshotMagic+"bla-bla-bla-bla-bla"), 0o600), IsNil)
+
+	storage := New(context.Background(), WithSnapshot(path, 0))
+	c.Assert(storage.ListAllSessions(), HasLen, 0)
+}
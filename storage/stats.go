@@ -0,0 +1,50 @@
+package storage
+
+import "sync/atomic"
+
+// Stats is a state of the storage for monitoring.
+type Stats struct {
+	Sessions   int   // number of stored sessions (expired ones are kept till the cleaner deletes them)
+	BunchSizes []int // number of stored sessions by bunches
+	Memory     int64 // estimated memory of stored sessions (bytes)
+
+	// totals since start
+	Created   uint64
+	Extended  uint64 // including sliding
+	Destroyed uint64
+	Expired   uint64
+	Evicted   uint64
+	Rejected  uint64 // creates rejected by the full storage
+
+	Cleaner CleanerStats
+}
+
+// StatsSource is implemented by storage backends which can report their state.
+type StatsSource interface {
+	Stats() Stats
+}
+
+// check that Storage implements StatsSource.
+var _ StatsSource = (*Storage)(nil)
+
+// Stats returns the current state of the storage.
+func (s *Storage) Stats() Stats {
+	out := Stats{
+		BunchSizes: make([]int, s.CountBunches),
+		Created:    s.events.total(EventCreated),
+		Extended:   s.events.total(EventExtended),
+		Destroyed:  s.events.total(EventDestroyed),
+		Expired:    s.events.total(EventExpired),
+		Evicted:    s.events.total(EventEvicted),
+		Rejected:   atomic.LoadUint64(&s.rejected),
+		Memory:     s.Memory(),
+		Cleaner:    s.CleanerStats(),
+	}
+
+	for i := uint32(0); i < s.CountBunches; i++ {
+		out.BunchSizes[i] = s.Bunches[i].sessions.Len()
+		out.Sessions += out.BunchSizes[i]
+	}
+
+	return out
+}
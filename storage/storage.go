@@ -3,66 +3,355 @@ package storage
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/iostrovok/aura-test/response"
 )
 
 const (
-	// CountBunches is a number of bunches.
+	// CountBunches is a default number of bunches.
 	// It dependents on now server/node performance and count of session.
-	CountBunches = 100 // TODO: move to the configuration parameters or make calculable by server configuration
+	CountBunches = 100
 )
 
 type Storage struct {
 	sync.RWMutex
 
-	Bunches       map[uint32]*Bunch
-	CountBunches  uint32
-	ctx           context.Context
-	countSessions *int32
+	Bunches      map[uint32]*Bunch
+	CountBunches uint32
+	ctx          context.Context
+	cancel       context.CancelFunc
+	maxDataSize  int
+	maxLifetime  uint32
+	events       *events
+	clock        Clock
+
+	maxExtendedTTL   uint32
+	cleanerIdleDelay time.Duration
+
+	// capacity, see capacity.go
+	maxSessions int
+	maxMemory   int64
+	eviction    EvictionPolicy
+	capacityMu  sync.Mutex
+	rejected    uint64
+	lruTicks    uint64
+
+	// sessions by owners, see owners.go
+	owners           *ownerIndex
+	maxOwnerSessions int
+
+	// sessions by tags, see tags.go
+	tags *tagIndex
+
+	// background goroutines (snapshotter, WAL syncer) and the error of the final snapshot
+	wg        sync.WaitGroup
+	closeErr  error
+	closeOnce sync.Once
+
+	snapshotMu       sync.Mutex
+	snapshotPath     string
+	snapshotInterval time.Duration
+
+	wal         *wal
+	walPath     string
+	walSync     WALSync
+	walInterval time.Duration
+}
+
+// Option configures Storage.
+type Option func(s *Storage)
+
+// WithSnapshot enables saving of all live sessions to the file each interval and when the context is done.
+// Sessions are restored from the file by New. Zero interval disables periodic snapshots.
+func WithSnapshot(path string, interval time.Duration) Option {
+	return func(s *Storage) {
+		s.snapshotPath = path
+		s.snapshotInterval = interval
+	}
+}
+
+// WithWAL enables the write-ahead log of all creates, extends and destroys.
+// The log is replayed by New on top of the snapshot and compacted by each snapshot,
+// so without WithSnapshot it is never compacted.
+// interval is used by WALSyncBatch policy only.
+func WithWAL(path string, policy WALSync, interval time.Duration) Option {
+	return func(s *Storage) {
+		s.walPath = path
+		s.walSync = policy
+		s.walInterval = interval
+	}
+}
+
+// WithMaxDataSize sets the limit of session data (in bytes).
+func WithMaxDataSize(size int) Option {
+	return func(s *Storage) {
+		s.maxDataSize = size
+	}
+}
+
+// WithMaxLifetime sets the default absolute max lifetime (in seconds) of sessions. Zero means no limit.
+func WithMaxLifetime(maxLifetime uint32) Option {
+	return func(s *Storage) {
+		s.maxLifetime = maxLifetime
+	}
+}
+
+// WithClock sets the source of time for sessions and cleaners. The default is the system clock.
+func WithClock(clock Clock) Option {
+	return func(s *Storage) {
+		s.clock = clock
+	}
+}
+
+// WithBunches sets the number of bunches (shards) of sessions.
+func WithBunches(count uint32) Option {
+	return func(s *Storage) {
+		if count > 0 {
+			s.CountBunches = count
+		}
+	}
+}
+
+// WithMaxExtendedTTL sets the limit of TTL (in seconds) set by extending and sliding.
+func WithMaxExtendedTTL(ttl uint32) Option {
+	return func(s *Storage) {
+		s.maxExtendedTTL = ttl
+	}
 }
 
-// New is a simple constructor.
-func New(ctx context.Context) *Storage {
+// WithCleanerIdleDelay sets the sleeping time of cleaners of empty bunches.
+func WithCleanerIdleDelay(delay time.Duration) Option {
+	return func(s *Storage) {
+		s.cleanerIdleDelay = delay
+	}
+}
+
+// New is a simple constructor. All background goroutines are stopped when the context is done or by Close.
+func New(ctx context.Context, opts ...Option) *Storage {
 	s := &Storage{
-		ctx:           ctx,
-		Bunches:       make(map[uint32]*Bunch, CountBunches),
-		CountBunches:  CountBunches,
-		countSessions: new(int32),
+		CountBunches: CountBunches,
+		maxDataSize:  DefaultMaxDataSize,
+		clock:        realClock{},
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
 
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	s.events = newEvents(s.clock)
+	s.owners = newOwnerIndex()
+	s.tags = newTagIndex()
+	s.Bunches = make(map[uint32]*Bunch, s.CountBunches)
+	cfg := bunchConfig{
+		events:         s.events,
+		clock:          s.clock,
+		maxExtendedTTL: int64(s.maxExtendedTTL),
+		idleDelay:      s.cleanerIdleDelay,
+		owners:         s.owners,
+		tags:           s.tags,
+	}
 	for i := uint32(0); i < s.CountBunches; i++ {
-		s.Bunches[i] = newBunch(s.ctx)
+		if s.limited() && s.eviction == EvictLRU {
+			cfg.lru = newLRUList(&s.lruTicks)
+		}
+		s.Bunches[i] = newBunch(s.ctx, cfg)
+	}
+
+	if s.snapshotPath != "" {
+		if err := s.loadSnapshot(); err != nil {
+			// corrupted snapshot is not loaded at all
+			logrus.Errorf("load snapshot %s: %s", s.snapshotPath, err.Error())
+		}
+	}
+
+	if s.walPath != "" {
+		s.initWAL()
+	}
+
+	// restored sessions may not fit the capacity
+	s.trim()
+
+	if s.snapshotPath != "" {
+		s.goBackground(s.snapshotter)
 	}
 
 	return s
 }
 
+// Close stops cleaners, saves the final snapshot and flushes the write-ahead log.
+// The storage should not be used after Close.
+func (s *Storage) Close() error {
+	s.closeOnce.Do(func() {
+		s.cancel()
+		for i := uint32(0); i < s.CountBunches; i++ {
+			<-s.Bunches[i].done
+		}
+
+		s.wg.Wait()
+
+		if s.wal != nil {
+			if err := s.wal.close(); err != nil && s.closeErr == nil {
+				s.closeErr = err
+			}
+		}
+	})
+
+	return s.closeErr
+}
+
 /*
  * Interface functions
  */
 
-func (s *Storage) Create(ttl uint32) string {
+func (s *Storage) Create(ttl uint32, opts ...SessionOption) (string, error) {
+	params := &sessionParams{maxLifetime: s.maxLifetime}
+	for _, opt := range opts {
+		opt(params)
+	}
+
+	if len(params.owner) > MaxOwnerSize {
+		return "", ErrWrongOwner
+	}
+
+	data, err := prepareData(params.data, s.maxDataSize)
+	if err != nil {
+		return "", err
+	}
+	params.data = data
+
+	if params.tags, err = prepareTags(params.tagMap); err != nil {
+		return "", err
+	}
+
 	id := uuid.New()
-	s.getBunches(id).create(id.String(), ttl)
+	limitOwner := s.maxOwnerSessions > 0 && params.owner != ""
+	if s.limited() || limitOwner {
+		s.capacityMu.Lock()
+		defer s.capacityMu.Unlock()
+	}
+
+	// the oldest sessions of the owner are evicted only if there is room for the new one
+	var victims []string
+	if limitOwner {
+		victims = s.ownerVictims(params.owner)
+	}
+
+	if s.limited() {
+		if err := s.reserve((&session{owner: params.owner, tags: params.tags, data: params.data}).size(id.String()), victims); err != nil {
+			return "", err
+		}
+	}
+	s.evictOwned(params.owner, victims)
+	s.getBunches(id).create(id.String(), ttl, params)
 
-	return id.String()
+	return id.String(), nil
 }
 
 func (s *Storage) Extend(id string, ttl uint32) bool {
-	u := uuid.MustParse(id)
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return false
+	}
 
 	return s.getBunches(u).extend(id, ttl)
 }
 
 func (s *Storage) Destroy(id string) bool {
-	u := uuid.MustParse(id)
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return false
+	}
 
 	return s.getBunches(u).destroy(id)
 }
 
+// Get returns the session with remaining TTL and data. It touches the owning bunch only.
+func (s *Storage) Get(id string) (*response.Session, bool) {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return nil, false
+	}
+
+	return s.getBunches(u).get(id)
+}
+
+// Peek returns the session with remaining TTL. Unlike Get it doesn't move expiry of sliding sessions,
+// so it writes nothing to WAL and publishes no events.
+func (s *Storage) Peek(id string) (*response.Session, bool) {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return nil, false
+	}
+
+	return s.getBunches(u).peek(id)
+}
+
+// Len returns the number of stored sessions. Expired sessions are counted till the cleaner deletes them.
+func (s *Storage) Len() int {
+	total := 0
+	for i := uint32(0); i < s.CountBunches; i++ {
+		total += s.Bunches[i].sessions.Len()
+	}
+
+	return total
+}
+
+// Owner returns the owner of the session. Unlike Get it doesn't move expiry of sliding sessions.
+func (s *Storage) Owner(id string) (string, bool) {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return "", false
+	}
+
+	return s.getBunches(u).owner(id)
+}
+
+// SetData replaces data of the session. It returns ErrFull if the storage has no room for the larger data.
+func (s *Storage) SetData(id string, data []byte) error {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	data, err = prepareData(data, s.maxDataSize)
+	if err != nil {
+		return err
+	}
+
+	return s.updateData(u, id, func([]byte) ([]byte, error) {
+		return data, nil
+	})
+}
+
+// MergeData updates top level keys of the session data by patch. Keys with null value are deleted.
+// It returns ErrFull if the storage has no room for the larger data.
+func (s *Storage) MergeData(id string, patch []byte) error {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	if _, err := prepareData(patch, s.maxDataSize); err != nil {
+		return err
+	}
+
+	return s.updateData(u, id, func(old []byte) ([]byte, error) {
+		data, err := mergeData(old, patch)
+		if err != nil {
+			return nil, err
+		}
+
+		return prepareData(data, s.maxDataSize)
+	})
+}
+
 // ListAllSessions returns list of all active sessions and remaining TTL from all bunches.
-func (s *Storage) ListAllSessions() []byte {
+func (s *Storage) ListAllSessions() []response.List {
 	/*
 		1) create channel for getting result
 		2) Start reading data from each bunch.
@@ -70,7 +359,7 @@ func (s *Storage) ListAllSessions() []byte {
 	*/
 
 	// run collecting data on all bunches
-	resCh := make(chan []byte, len(s.Bunches)+1)
+	resCh := make(chan []response.List, len(s.Bunches)+1)
 	wg := sync.WaitGroup{}
 	wg.Add(int(s.CountBunches))
 	for i := uint32(0); i < s.CountBunches; i++ {
@@ -82,7 +371,7 @@ func (s *Storage) ListAllSessions() []byte {
 
 	// collect data from all bunches
 	done := make(chan struct{})
-	out := []byte("[")
+	out := make([]response.List, 0)
 	go func() {
 		defer func() {
 			done <- struct{}{}
@@ -100,14 +389,6 @@ func (s *Storage) ListAllSessions() []byte {
 	// wait for collect all results is done.
 	<-done
 
-	// replace last "," to "]"
-	if len(out) > 1 {
-		out[len(out)-1] = ']'
-	} else {
-		// empty list
-		out = []byte("[]")
-	}
-
 	// final result
 	return out
 }
@@ -116,9 +397,53 @@ func (s *Storage) ListAllSessions() []byte {
  * Internal functions
  */
 
+// initWAL replays the write-ahead log and starts writing to it.
+func (s *Storage) initWAL() {
+	if err := s.replayWAL(s.walPath); err != nil {
+		logrus.Errorf("replay wal %s: %s", s.walPath, err.Error())
+	}
+
+	w, err := openWAL(s.walPath, s.walSync, s.walInterval)
+	if err != nil {
+		logrus.Errorf("open wal %s: %s", s.walPath, err.Error())
+
+		return
+	}
+
+	s.wal = w
+	for i := uint32(0); i < s.CountBunches; i++ {
+		s.Bunches[i].wal = w
+	}
+
+	if s.walSync == WALSyncBatch {
+		s.goBackground(func() {
+			w.syncer(s.ctx)
+		})
+	}
+}
+
+// goBackground runs the background goroutine which is waited by Close.
+func (s *Storage) goBackground(fn func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		fn()
+	}()
+}
+
 func (s *Storage) getBunches(u uuid.UUID) *Bunch {
 	s.Lock()
 	defer s.Unlock()
 
 	return s.Bunches[u.ID()%s.CountBunches]
 }
+
+// bunchOf returns the bunch of the session found by an index. It returns false if the id is wrong.
+func (s *Storage) bunchOf(id string) (*Bunch, bool) {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return nil, false
+	}
+
+	return s.getBunches(u), true
+}
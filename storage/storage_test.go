@@ -2,64 +2,78 @@ package storage
 
 import (
 	"context"
-	"strings"
 	"time"
 
+	"github.com/google/uuid"
+
 	. "github.com/iostrovok/check"
+
+	"github.com/iostrovok/aura-test/response"
 )
 
 // helper.
-func checkAllInStorage(c *C, id, all string) {
-	c.Assert(strings.Index(all, "["), Equals, 0)
-	c.Assert(strings.Index(all, "{"), Equals, 1)
-	c.Assert(strings.LastIndex(all, "]"), Equals, len(all)-1)
-	c.Assert(strings.LastIndex(all, "}"), Equals, len(all)-2)
-	c.Assert(strings.LastIndex(all, id) > 0, Equals, true)
+func newTestStorage(ctx context.Context) (*Storage, *ManualClock) {
+	clock := NewManualClock(testNow)
+
+	return New(ctx, WithClock(clock)), clock
+}
+
+// helper.
+func checkAllInStorage(c *C, id string, all []response.List) {
+	for _, l := range all {
+		if l.ID == id {
+			c.Assert(l.TTL > 0, Equals, true)
+
+			return
+		}
+	}
+
+	c.Fatalf("session %s is not found in list", id)
 }
 
 func (s *testSuite) TestStorageCreate(c *C) {
 	storage := New(context.Background())
-	c.Assert(string(storage.ListAllSessions()), Equals, "[]")
+	c.Assert(storage.ListAllSessions(), HasLen, 0)
 
-	id := storage.Create(30)
-	checkAllInStorage(c, id, string(storage.ListAllSessions()))
+	id, _ := storage.Create(30)
+	checkAllInStorage(c, id, storage.ListAllSessions())
 }
 
 func (s *testSuite) TestStorageExpired(c *C) {
-	storage := New(context.Background())
-	c.Assert(string(storage.ListAllSessions()), Equals, "[]")
+	storage, clock := newTestStorage(context.Background())
+	c.Assert(storage.ListAllSessions(), HasLen, 0)
 
-	id := storage.Create(1)
-	checkAllInStorage(c, id, string(storage.ListAllSessions()))
+	id, _ := storage.Create(1)
+	checkAllInStorage(c, id, storage.ListAllSessions())
 
-	time.Sleep(2 * time.Second)
-	c.Assert(string(storage.ListAllSessions()), Equals, "[]")
+	clock.Add(2 * time.Second)
+	c.Assert(storage.ListAllSessions(), HasLen, 0)
 }
 
 func (s *testSuite) TestStorageDestroy(c *C) {
 	storage := New(context.Background())
-	c.Assert(string(storage.ListAllSessions()), Equals, "[]")
+	c.Assert(storage.ListAllSessions(), HasLen, 0)
 
-	id := storage.Create(30)
-	checkAllInStorage(c, id, string(storage.ListAllSessions()))
+	id, _ := storage.Create(30)
+	checkAllInStorage(c, id, storage.ListAllSessions())
 
 	c.Assert(storage.Destroy(id), Equals, true)
-	c.Assert(string(storage.ListAllSessions()), Equals, "[]")
+	c.Assert(storage.ListAllSessions(), HasLen, 0)
 
 	c.Assert(storage.Destroy(id), Equals, false)
-	c.Assert(string(storage.ListAllSessions()), Equals, "[]")
+	c.Assert(storage.ListAllSessions(), HasLen, 0)
 }
 
 func (s *testSuite) TestStorageDestroyMassive(c *C) {
 	storage := New(context.Background())
-	c.Assert(string(storage.ListAllSessions()), Equals, "[]")
+	c.Assert(storage.ListAllSessions(), HasLen, 0)
 
 	ids := make([]string, 1000, 1000)
 	for i := 0; i < 1000; i++ {
-		ids[i] = storage.Create(30)
+		ids[i], _ = storage.Create(30)
 	}
 
-	all := string(storage.ListAllSessions())
+	all := storage.ListAllSessions()
 	for i := 0; i < 1000; i++ {
 		checkAllInStorage(c, ids[i], all)
 	}
@@ -67,54 +81,87 @@ func (s *testSuite) TestStorageDestroyMassive(c *C) {
 	for i := 0; i < 1000; i++ {
 		c.Assert(storage.Destroy(ids[i]), Equals, true)
 	}
-	c.Assert(string(storage.ListAllSessions()), Equals, "[]")
+	c.Assert(storage.ListAllSessions(), HasLen, 0)
 	for i := 0; i < 1000; i++ {
 		c.Assert(storage.Destroy(ids[i]), Equals, false)
 	}
 }
 
 func (s *testSuite) TestStorageExtend(c *C) {
-	storage := New(context.Background())
-	c.Assert(string(storage.ListAllSessions()), Equals, "[]")
+	storage, clock := newTestStorage(context.Background())
+	c.Assert(storage.ListAllSessions(), HasLen, 0)
 
-	id := storage.Create(1)
-	checkAllInStorage(c, id, string(storage.ListAllSessions()))
+	id, _ := storage.Create(1)
+	checkAllInStorage(c, id, storage.ListAllSessions())
 
 	c.Assert(storage.Extend(id, 10), Equals, true)
-	checkAllInStorage(c, id, string(storage.ListAllSessions()))
+	checkAllInStorage(c, id, storage.ListAllSessions())
 
-	time.Sleep(2 * time.Second)
-	checkAllInStorage(c, id, string(storage.ListAllSessions()))
+	clock.Add(2 * time.Second)
+	checkAllInStorage(c, id, storage.ListAllSessions())
 }
 
 func (s *testSuite) TestStorageExtendExpired(c *C) {
-	storage := New(context.Background())
-	c.Assert(string(storage.ListAllSessions()), Equals, "[]")
+	storage, clock := newTestStorage(context.Background())
+	c.Assert(storage.ListAllSessions(), HasLen, 0)
 
-	id := storage.Create(1)
-	checkAllInStorage(c, id, string(storage.ListAllSessions()))
+	id, _ := storage.Create(1)
+	checkAllInStorage(c, id, storage.ListAllSessions())
 
-	time.Sleep(2 * time.Second)
+	clock.Add(2 * time.Second)
 	c.Assert(storage.Extend(id, 10), Equals, false)
-	c.Assert(string(storage.ListAllSessions()), Equals, "[]")
+	c.Assert(storage.ListAllSessions(), HasLen, 0)
 }
 
 func (s *testSuite) TestStorageCreateManyRecords(c *C) {
 	storage := New(context.Background())
-	c.Assert(string(storage.ListAllSessions()), Equals, "[]")
+	c.Assert(storage.ListAllSessions(), HasLen, 0)
 
 	for i := 0; i < 1000; i++ {
 		storage.Create(10)
 	}
 
-	id := storage.Create(10)
-	checkAllInStorage(c, id, string(storage.ListAllSessions()))
+	id, _ := storage.Create(10)
+	checkAllInStorage(c, id, storage.ListAllSessions())
 }
 
 func (s *testSuite) TestStorageStopExpired(c *C) {
 	ctx, cxtFunc := context.WithCancel(context.Background())
 	storage := New(ctx)
-	c.Assert(string(storage.ListAllSessions()), Equals, "[]")
+	c.Assert(storage.ListAllSessions(), HasLen, 0)
 	cxtFunc()
-	c.Assert(string(storage.ListAllSessions()), Equals, "[]")
+	c.Assert(storage.ListAllSessions(), HasLen, 0)
+}
+
+func (s *testSuite) TestStorageOptions(c *C) {
+	clock := NewManualClock(testNow)
+	storage := New(context.Background(), WithClock(clock), WithBunches(4), WithMaxExtendedTTL(1000))
+	c.Assert(storage.Bunches, HasLen, 4)
+
+	id, _ := storage.Create(10)
+	c.Assert(storage.Extend(id, 5000), Equals, true)
+	session, find := storage.Get(id)
+	c.Assert(find, Equals, true)
+	c.Assert(session.TTL, Equals, 1000)
+}
+
+func (s *testSuite) TestStorageStats(c *C) {
+	storage, clock := newTestStorage(context.Background())
+	id, _ := storage.Create(10)
+	expired, _ := storage.Create(1)
+	c.Assert(storage.Extend(id, 20), Equals, true)
+
+	stats := storage.Stats()
+	c.Assert(stats.Sessions, Equals, 2)
+	c.Assert(stats.BunchSizes, HasLen, CountBunches)
+	c.Assert(stats.Created, Equals, uint64(2))
+	c.Assert(stats.Extended, Equals, uint64(1))
+
+	c.Assert(storage.Destroy(id), Equals, true)
+	c.Assert(storage.getBunches(uuid.MustParse(expired)).expire(clock.Now().Add(2*time.Second)), Equals, 1)
+
+	stats = storage.Stats()
+	c.Assert(stats.Sessions, Equals, 0)
+	c.Assert(stats.Destroyed, Equals, uint64(1))
+	c.Assert(stats.Expired, Equals, uint64(1))
 }
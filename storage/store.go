@@ -0,0 +1,36 @@
+package storage
+
+/*
+	SessionStore describes the session storage backend used by the HTTP server.
+	Storage (bunch-sharded in-memory hashmaps) is the default implementation.
+	Any other backend should pass the conformance suite from storage/storetest.
+*/
+
+import "github.com/iostrovok/aura-test/response"
+
+type SessionStore interface {
+	// Create creates new session with ttl (in seconds) and returns its id.
+	Create(ttl uint32, opts ...SessionOption) (string, error)
+	// Extend extends the existing session. It returns false if the session is not found or expired.
+	Extend(id string, ttl uint32) bool
+	// Destroy deletes the session. It returns false if the session is not found.
+	Destroy(id string) bool
+	// Get returns the session with remaining TTL (in seconds) and false if the session is not found or expired.
+	Get(id string) (*response.Session, bool)
+	// Peek returns the session like Get but it changes nothing: expiry of sliding sessions is not moved.
+	Peek(id string) (*response.Session, bool)
+	// Owner returns the owner of the session (empty if it's not set) and false if the session is not found.
+	// It doesn't move expiry of sliding sessions.
+	Owner(id string) (string, bool)
+	// SetData replaces data of the session. It returns ErrNotFound if the session is not found or expired.
+	SetData(id string, data []byte) error
+	// MergeData updates top level keys of the session data. It returns ErrNotFound if the session is not found.
+	MergeData(id string, patch []byte) error
+	// ListAllSessions returns list of all active sessions and remaining TTL.
+	ListAllSessions() []response.List
+	// List returns the page of active sessions which match the filters (see ListOptions).
+	List(opts ListOptions) (*response.ListPage, error)
+}
+
+// check that Storage implements SessionStore.
+var _ SessionStore = (*Storage)(nil)
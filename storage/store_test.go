@@ -0,0 +1,15 @@
+package storage_test
+
+import (
+	"context"
+
+	. "github.com/iostrovok/check"
+
+	"github.com/iostrovok/aura-test/storage"
+	"github.com/iostrovok/aura-test/storage/storetest"
+)
+
+// Storage has to pass the SessionStore conformance suite.
+var _ = Suite(&storetest.ConformanceSuite{
+	New: func(ctx context.Context) storage.SessionStore { return storage.New(ctx) },
+})
@@ -0,0 +1,303 @@
+package storetest
+
+/*
+	storetest package provides the conformance test suite for storage.SessionStore backends.
+	Any backend has to pass it. Usage in the backend tests:
+
+		var _ = check.Suite(&storetest.ConformanceSuite{
+			New: func(ctx context.Context) storage.SessionStore { return mystore.New(ctx) },
+		})
+*/
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	. "github.com/iostrovok/check"
+
+	"github.com/iostrovok/aura-test/storage"
+)
+
+const unknownID = "790c72b9-0000-0000-0000-000000000000"
+
+// ConformanceSuite is a gocheck suite which checks storage.SessionStore behaviour.
+type ConformanceSuite struct {
+	// New returns new empty backend.
+	New func(ctx context.Context) storage.SessionStore
+}
+
+// helper.
+func list(c *C, store storage.SessionStore) map[string]int {
+	data := store.ListAllSessions()
+
+	out := make(map[string]int, len(data))
+	for _, l := range data {
+		out[l.ID] = l.TTL
+	}
+
+	return out
+}
+
+// helper.
+func create(c *C, store storage.SessionStore, ttl uint32, opts ...storage.SessionOption) string {
+	id, err := store.Create(ttl, opts...)
+	c.Assert(err, IsNil)
+	c.Assert(len(id), Equals, 36) // UUID string
+
+	return id
+}
+
+func (s *ConformanceSuite) TestStoreEmpty(c *C) {
+	store := s.New(context.Background())
+	c.Assert(list(c, store), HasLen, 0)
+
+	_, find := store.Get(unknownID)
+	c.Assert(find, Equals, false)
+	c.Assert(store.Extend(unknownID, 10), Equals, false)
+	c.Assert(store.Destroy(unknownID), Equals, false)
+	c.Assert(store.SetData(unknownID, []byte(`{}`)), Equals, storage.ErrNotFound)
+	c.Assert(store.MergeData(unknownID, []byte(`{}`)), Equals, storage.ErrNotFound)
+
+	// malformed ids are not found
+	for _, id := range []string{"", "bad-id", unknownID[1:]} {
+		_, find = store.Get(id)
+		c.Assert(find, Equals, false)
+		c.Assert(store.Extend(id, 10), Equals, false)
+		c.Assert(store.Destroy(id), Equals, false)
+		c.Assert(store.SetData(id, []byte(`{}`)), Equals, storage.ErrNotFound)
+	}
+}
+
+func (s *ConformanceSuite) TestStoreCreateGet(c *C) {
+	store := s.New(context.Background())
+
+	id := create(c, store, 30)
+	c.Assert(create(c, store, 30), Not(Equals), id)
+
+	session, find := store.Get(id)
+	c.Assert(find, Equals, true)
+	c.Assert(session.ID, Equals, id)
+	c.Assert(session.TTL > 0 && session.TTL <= 30, Equals, true)
+	c.Assert(session.Data, HasLen, 0)
+
+	all := list(c, store)
+	c.Assert(all, HasLen, 2)
+	c.Assert(all[id] > 0 && all[id] <= 30, Equals, true)
+}
+
+func (s *ConformanceSuite) TestStoreDestroy(c *C) {
+	store := s.New(context.Background())
+
+	id := create(c, store, 30)
+	c.Assert(store.Destroy(id), Equals, true)
+	c.Assert(store.Destroy(id), Equals, false)
+
+	_, find := store.Get(id)
+	c.Assert(find, Equals, false)
+	c.Assert(list(c, store), HasLen, 0)
+}
+
+func (s *ConformanceSuite) TestStoreExtend(c *C) {
+	store := s.New(context.Background())
+
+	id := create(c, store, 10)
+	c.Assert(store.Extend(id, 20), Equals, true)
+
+	session, find := store.Get(id)
+	c.Assert(find, Equals, true)
+	c.Assert(session.TTL > 10 && session.TTL <= 30, Equals, true)
+
+	// extended TTL is limited by storage.MaxAllowedExtendedTTL
+	c.Assert(store.Extend(id, 4000), Equals, true)
+	session, find = store.Get(id)
+	c.Assert(find, Equals, true)
+	c.Assert(session.TTL > 30 && int64(session.TTL) <= storage.MaxAllowedExtendedTTL, Equals, true)
+}
+
+func (s *ConformanceSuite) TestStoreData(c *C) {
+	store := s.New(context.Background())
+
+	id := create(c, store, 30, storage.SessionData([]byte(`{"user": "bla", "roles": ["admin"]}`)))
+	session, find := store.Get(id)
+	c.Assert(find, Equals, true)
+	c.Assert(string(session.Data), Equals, `{"user":"bla","roles":["admin"]}`)
+
+	// data is kept after extending
+	c.Assert(store.Extend(id, 10), Equals, true)
+	session, _ = store.Get(id)
+	c.Assert(string(session.Data), Equals, `{"user":"bla","roles":["admin"]}`)
+
+	c.Assert(store.MergeData(id, []byte(`{"roles":null,"app":"web"}`)), IsNil)
+	session, _ = store.Get(id)
+	c.Assert(string(session.Data), Equals, `{"app":"web","user":"bla"}`)
+
+	c.Assert(store.SetData(id, []byte(`{"user":"other"}`)), IsNil)
+	session, _ = store.Get(id)
+	c.Assert(string(session.Data), Equals, `{"user":"other"}`)
+}
+
+func (s *ConformanceSuite) TestStoreWrongData(c *C) {
+	store := s.New(context.Background())
+
+	_, err := store.Create(30, storage.SessionData([]byte(`[1, 2, 3]`)))
+	c.Assert(err, Equals, storage.ErrWrongData)
+
+	_, err = store.Create(30, storage.SessionData([]byte(`{"user":`)))
+	c.Assert(err, Equals, storage.ErrWrongData)
+
+	big := []byte(`{"data":"` + strings.Repeat("a", storage.DefaultMaxDataSize) + `"}`)
+	_, err = store.Create(30, storage.SessionData(big))
+	c.Assert(err, Equals, storage.ErrDataTooLarge)
+
+	id := create(c, store, 30)
+	c.Assert(store.SetData(id, big), Equals, storage.ErrDataTooLarge)
+	c.Assert(store.MergeData(id, []byte(`"bla"`)), Equals, storage.ErrWrongData)
+	c.Assert(list(c, store), HasLen, 1)
+}
+
+func (s *ConformanceSuite) TestStoreSliding(c *C) {
+	store := s.New(context.Background())
+
+	fixed := create(c, store, 5)
+	sliding := create(c, store, 5, storage.SessionSliding(20))
+
+	session, find := store.Get(fixed)
+	c.Assert(find, Equals, true)
+	c.Assert(session.TTL <= 5, Equals, true)
+
+	// lookup moves expiry of the sliding session
+	session, find = store.Get(sliding)
+	c.Assert(find, Equals, true)
+	c.Assert(session.TTL > 5 && session.TTL <= 20, Equals, true)
+	c.Assert(list(c, store)[sliding] > 5, Equals, true)
+
+	// peek doesn't move expiry
+	sliding = create(c, store, 5, storage.SessionSliding(20))
+	session, find = store.Peek(sliding)
+	c.Assert(find, Equals, true)
+	c.Assert(session.TTL <= 5, Equals, true)
+	c.Assert(list(c, store)[sliding] <= 5, Equals, true)
+
+	_, find = store.Peek(unknownID)
+	c.Assert(find, Equals, false)
+
+	// slide is limited by storage.MaxAllowedExtendedTTL
+	sliding = create(c, store, 5, storage.SessionSliding(4000))
+	session, find = store.Get(sliding)
+	c.Assert(find, Equals, true)
+	c.Assert(session.TTL > 20 && int64(session.TTL) <= storage.MaxAllowedExtendedTTL, Equals, true)
+}
+
+func (s *ConformanceSuite) TestStoreMaxLifetime(c *C) {
+	store := s.New(context.Background())
+
+	id := create(c, store, 5, storage.SessionMaxLifetime(10))
+	session, find := store.Get(id)
+	c.Assert(find, Equals, true)
+	c.Assert(session.Created > 0, Equals, true)
+	c.Assert(session.AbsoluteTTL > 5 && session.AbsoluteTTL <= 10, Equals, true)
+
+	// extend can't exceed max lifetime
+	c.Assert(store.Extend(id, 100), Equals, true)
+	session, _ = store.Get(id)
+	c.Assert(session.TTL > 5 && session.TTL <= 10, Equals, true)
+	c.Assert(session.TTL <= session.AbsoluteTTL, Equals, true)
+
+	// nor sliding
+	id = create(c, store, 5, storage.SessionSliding(100), storage.SessionMaxLifetime(10))
+	session, _ = store.Get(id)
+	c.Assert(session.TTL > 5 && session.TTL <= 10, Equals, true)
+
+	// TTL of the new session is limited too
+	id = create(c, store, 30, storage.SessionMaxLifetime(10))
+	session, _ = store.Get(id)
+	c.Assert(session.TTL <= 10, Equals, true)
+
+	for _, l := range store.ListAllSessions() {
+		c.Assert(l.AbsoluteTTL > 0 && l.AbsoluteTTL <= 10, Equals, true)
+	}
+}
+
+func (s *ConformanceSuite) TestStoreList(c *C) {
+	store := s.New(context.Background())
+
+	ids := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		ids[create(c, store, uint32(10+i))] = true
+	}
+
+	opts := storage.ListOptions{Limit: 2, Sort: "-ttl"}
+	prev := 0
+	for {
+		page, err := store.List(opts)
+		c.Assert(err, IsNil)
+		c.Assert(page.Total, Equals, 5)
+		c.Assert(len(page.Sessions) <= 2, Equals, true)
+
+		for _, l := range page.Sessions {
+			c.Assert(ids[l.ID], Equals, true)
+			c.Assert(prev == 0 || l.TTL <= prev, Equals, true)
+			prev = l.TTL
+			delete(ids, l.ID)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	c.Assert(ids, HasLen, 0)
+
+	page, err := store.List(storage.ListOptions{MaxTTL: 11})
+	c.Assert(err, IsNil)
+	c.Assert(page.Total >= 1 && page.Total <= 2, Equals, true)
+
+	_, err = store.List(storage.ListOptions{Sort: "unknown"})
+	c.Assert(err, Equals, storage.ErrListSort)
+}
+
+func (s *ConformanceSuite) TestStoreOwner(c *C) {
+	store := s.New(context.Background())
+
+	id := create(c, store, 30, storage.SessionOwner("user-1"))
+	other := create(c, store, 30)
+
+	owner, find := store.Owner(id)
+	c.Assert(find, Equals, true)
+	c.Assert(owner, Equals, "user-1")
+
+	session, find := store.Get(other)
+	c.Assert(find, Equals, true)
+	c.Assert(session.Owner, Equals, "")
+	owner, find = store.Owner(other)
+	c.Assert(find, Equals, true)
+	c.Assert(owner, Equals, "")
+
+	_, find = store.Owner(unknownID)
+	c.Assert(find, Equals, false)
+
+	page, err := store.List(storage.ListOptions{Owner: "user-1"})
+	c.Assert(err, IsNil)
+	c.Assert(page.Total, Equals, 1)
+	c.Assert(page.Sessions[0].ID, Equals, id)
+	c.Assert(page.Sessions[0].Owner, Equals, "user-1")
+
+	_, err = store.Create(30, storage.SessionOwner(strings.Repeat("a", storage.MaxOwnerSize+1)))
+	c.Assert(err, Equals, storage.ErrWrongOwner)
+}
+
+func (s *ConformanceSuite) TestStoreExpired(c *C) {
+	store := s.New(context.Background())
+
+	id := create(c, store, 1)
+	c.Assert(list(c, store), HasLen, 1)
+
+	time.Sleep(2 * time.Second)
+
+	_, find := store.Get(id)
+	c.Assert(find, Equals, false)
+	c.Assert(store.Extend(id, 10), Equals, false)
+	c.Assert(store.SetData(id, []byte(`{}`)), Equals, storage.ErrNotFound)
+	c.Assert(list(c, store), HasLen, 0)
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/iostrovok/aura-test/response"
+)
+
+/*
+	EachSession passes sessions bunch by bunch to the callback without collecting them,
+	so the memory doesn't depend on the number of sessions.
+	It stops on the first error of the callback (the client is gone) or when the context is done.
+*/
+
+// Iterator is implemented by storage backends which can pass all sessions without collecting them in memory.
+type Iterator interface {
+	// EachSession calls fn for all active sessions till fn returns error or ctx is done.
+	EachSession(ctx context.Context, fn func(l response.List) error) error
+}
+
+// check that Storage implements Iterator.
+var _ Iterator = (*Storage)(nil)
+
+// EachSession calls fn for all active sessions. It returns the error of fn or ctx.
+func (s *Storage) EachSession(ctx context.Context, fn func(l response.List) error) error {
+	for i := uint32(0); i < s.CountBunches; i++ {
+		if err := s.Bunches[i].eachSession(ctx, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// eachSession calls fn for active sessions of the bunch.
+func (b *Bunch) eachSession(ctx context.Context, fn func(l response.List) error) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	counter := 0
+	b.eachList(func(l response.List) bool {
+		if err = fn(l); err != nil {
+			return false
+		}
+
+		counter++
+		if counter > numberCyclesForReloadTime {
+			counter = 0
+			err = ctx.Err()
+		}
+
+		return err == nil
+	})
+
+	return err
+}
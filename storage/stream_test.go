@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/iostrovok/check"
+
+	"github.com/iostrovok/aura-test/response"
+)
+
+func (s *testSuite) TestEachSession(c *C) {
+	storage, _ := newTestStorage(context.Background())
+
+	ids := map[string]bool{}
+	for i := 0; i < 500; i++ {
+		id, _ := storage.Create(30, SessionData([]byte(`{"user":"bla"}`)))
+		ids[id] = true
+	}
+
+	err := storage.EachSession(context.Background(), func(l response.List) error {
+		c.Assert(ids[l.ID], Equals, true)
+		c.Assert(l.TTL, Equals, 30)
+		c.Assert(l.DataSize, Equals, 14)
+		delete(ids, l.ID)
+
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(ids, HasLen, 0)
+}
+
+func (s *testSuite) TestEachSessionAbort(c *C) {
+	storage, _ := newTestStorage(context.Background())
+	for i := 0; i < 5000; i++ {
+		_, _ = storage.Create(30)
+	}
+
+	// the client is gone
+	count := 0
+	err := storage.EachSession(context.Background(), func(response.List) error {
+		count++
+		if count == 100 {
+			return errors.New("client is gone")
+		}
+
+		return nil
+	})
+	c.Assert(err, ErrorMatches, "client is gone")
+	c.Assert(count, Equals, 100)
+
+	// the request is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	count = 0
+	err = storage.EachSession(ctx, func(response.List) error {
+		count++
+		if count == 10 {
+			cancel()
+		}
+
+		return nil
+	})
+	c.Assert(err, Equals, context.Canceled)
+	c.Assert(count < 5000, Equals, true)
+}
@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/iostrovok/aura-test/response"
+)
+
+/*
+	Sessions may have a small set of tags (device type, region, client app) set on create.
+	Each tag "key=value" is indexed, so sessions are found by tag queries without full scans:
+
+		app=mobile AND region=eu
+
+	A query matches sessions which have all its tags. Tags of a session are never changed.
+*/
+
+const (
+	// MaxTags is a limit of tags of one session.
+	MaxTags = 16
+	// MaxTagSize is a limit of the tag key and the tag value (in bytes).
+	MaxTagSize = 64
+)
+
+var (
+	ErrWrongTags = errors.New("session tags are wrong")
+	ErrTagQuery  = errors.New("wrong tag query, expected key=value [AND key=value ...]")
+)
+
+// TagIndex is implemented by storage backends which index sessions by tags.
+type TagIndex interface {
+	// TaggedSessions returns active sessions which match the query.
+	TaggedSessions(q TagQuery) []response.List
+	// DestroyTagged destroys all sessions which match the query and returns their number.
+	DestroyTagged(q TagQuery) int
+}
+
+// check that Storage implements TagIndex.
+var _ TagIndex = (*Storage)(nil)
+
+// TagQuery selects sessions by tags.
+type TagQuery struct {
+	Tags  []string // "key=value", sessions should have all of them
+	Owner string   // owner of sessions, empty - any owner
+}
+
+// ParseTagQuery parses the query "key=value AND key=value ...". AND is case insensitive.
+func ParseTagQuery(expr string) (TagQuery, error) {
+	q := TagQuery{}
+
+	fields := strings.Fields(expr)
+	if len(fields)%2 == 0 {
+		return q, ErrTagQuery
+	}
+
+	for i, field := range fields {
+		if i%2 == 1 {
+			if !strings.EqualFold(field, "AND") {
+				return q, ErrTagQuery
+			}
+
+			continue
+		}
+
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 || !validTag(parts[0], parts[1]) {
+			return q, ErrTagQuery
+		}
+		q.Tags = append(q.Tags, field)
+	}
+
+	return q, nil
+}
+
+// SessionTags sets tags of the new session. Their number and size are limited by MaxTags and MaxTagSize,
+// keys and values should be not empty and should not have spaces, keys should not have "=".
+func SessionTags(tags map[string]string) SessionOption {
+	return func(p *sessionParams) {
+		p.tagMap = tags
+	}
+}
+
+// prepareTags checks tags and returns them as sorted "key=value" list.
+func prepareTags(tags map[string]string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	if len(tags) > MaxTags {
+		return nil, ErrWrongTags
+	}
+
+	out := make([]string, 0, len(tags))
+	for key, value := range tags {
+		if !validTag(key, value) {
+			return nil, ErrWrongTags
+		}
+		out = append(out, key+"="+value)
+	}
+	sort.Strings(out)
+
+	return out, nil
+}
+
+func validTag(key, value string) bool {
+	if key == "" || value == "" || len(key) > MaxTagSize || len(value) > MaxTagSize || strings.Contains(key, "=") {
+		return false
+	}
+
+	return strings.IndexFunc(key+value, unicode.IsSpace) == -1
+}
+
+// TaggedSessions returns active sessions which match the query sorted by id.
+func (s *Storage) TaggedSessions(q TagQuery) []response.List {
+	now := s.clock.Now().Unix()
+
+	out := make([]response.List, 0)
+	for _, id := range s.tags.ids(q.Tags) {
+		b, ok := s.bunchOf(id)
+		if !ok {
+			continue
+		}
+
+		l, ok := b.item(id, now)
+		if ok && (q.Owner == "" || l.Owner == q.Owner) {
+			out = append(out, l)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+
+	return out
+}
+
+// DestroyTagged destroys all sessions which match the query and returns their number.
+func (s *Storage) DestroyTagged(q TagQuery) int {
+	count := 0
+	for _, id := range s.tags.ids(q.Tags) {
+		b, ok := s.bunchOf(id)
+		if !ok {
+			continue
+		}
+
+		if q.Owner != "" {
+			if owner, ok := b.owner(id); !ok || owner != q.Owner {
+				continue
+			}
+		}
+
+		if b.destroy(id) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// tagIndex keeps ids of sessions by tags.
+type tagIndex struct {
+	sync.RWMutex
+
+	tags map[string]map[string]struct{} // "key=value" => ids
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{tags: make(map[string]map[string]struct{})}
+}
+
+func (x *tagIndex) add(tags []string, id string) {
+	x.Lock()
+	defer x.Unlock()
+
+	for _, tag := range tags {
+		ids, ok := x.tags[tag]
+		if !ok {
+			ids = make(map[string]struct{})
+			x.tags[tag] = ids
+		}
+		ids[id] = struct{}{}
+	}
+}
+
+func (x *tagIndex) remove(tags []string, id string) {
+	x.Lock()
+	defer x.Unlock()
+
+	for _, tag := range tags {
+		if ids, ok := x.tags[tag]; ok {
+			delete(ids, id)
+			if len(ids) == 0 {
+				delete(x.tags, tag)
+			}
+		}
+	}
+}
+
+// ids returns ids of sessions which have all the tags. It walks the least set of sessions.
+func (x *tagIndex) ids(tags []string) []string {
+	x.RLock()
+	defer x.RUnlock()
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	least := tags[0]
+	for _, tag := range tags[1:] {
+		if len(x.tags[tag]) < len(x.tags[least]) {
+			least = tag
+		}
+	}
+
+	out := make([]string, 0, len(x.tags[least]))
+	for id := range x.tags[least] {
+		found := true
+		for _, tag := range tags {
+			if _, ok := x.tags[tag][id]; !ok {
+				found = false
+
+				break
+			}
+		}
+
+		if found {
+			out = append(out, id)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/iostrovok/check"
+)
+
+// helper.
+func taggedIDs(c *C, storage *Storage, expr, owner string) []string {
+	q, err := ParseTagQuery(expr)
+	c.Assert(err, IsNil)
+	q.Owner = owner
+
+	out := make([]string, 0)
+	for _, l := range storage.TaggedSessions(q) {
+		out = append(out, l.ID)
+	}
+
+	return out
+}
+
+func (s *testSuite) TestTaggedSessions(c *C) {
+	storage, clock := newTestStorage(context.Background())
+
+	mobileEU, err := storage.Create(10, SessionTags(map[string]string{"app": "mobile", "region": "eu"}), SessionOwner("user-1"))
+	c.Assert(err, IsNil)
+	mobileUS, _ := storage.Create(20, SessionTags(map[string]string{"app": "mobile", "region": "us"}))
+	webEU, _ := storage.Create(20, SessionTags(map[string]string{"app": "web", "region": "eu"}))
+	_, _ = storage.Create(20)
+
+	mobile := []string{mobileEU, mobileUS}
+	sort.Strings(mobile)
+	c.Assert(taggedIDs(c, storage, "app=mobile", ""), DeepEquals, mobile)
+	c.Assert(taggedIDs(c, storage, "app=mobile AND region=eu", ""), DeepEquals, []string{mobileEU})
+	c.Assert(taggedIDs(c, storage, "region=eu and app=web", ""), DeepEquals, []string{webEU})
+	c.Assert(taggedIDs(c, storage, "app=mobile AND app=web", ""), HasLen, 0)
+	c.Assert(taggedIDs(c, storage, "app=desktop", ""), HasLen, 0)
+	c.Assert(taggedIDs(c, storage, "region=eu", "user-1"), DeepEquals, []string{mobileEU})
+
+	session, _ := storage.Get(mobileEU)
+	c.Assert(session.Tags, DeepEquals, []string{"app=mobile", "region=eu"})
+
+	// expired sessions leave the index
+	clock.Add(11 * time.Second)
+	c.Assert(taggedIDs(c, storage, "region=eu", ""), DeepEquals, []string{webEU})
+	for i := uint32(0); i < storage.CountBunches; i++ {
+		storage.Bunches[i].expire(clock.Now())
+	}
+	c.Assert(storage.tags.tags, HasLen, 4)
+
+	q, _ := ParseTagQuery("app=mobile")
+	c.Assert(storage.DestroyTagged(TagQuery{Tags: q.Tags, Owner: "user-2"}), Equals, 0)
+	c.Assert(storage.DestroyTagged(q), Equals, 1)
+	c.Assert(storage.DestroyTagged(q), Equals, 0)
+	c.Assert(storage.Len(), Equals, 2)
+	c.Assert(storage.tags.tags, HasLen, 2)
+}
+
+func (s *testSuite) TestSessionTagsErrors(c *C) {
+	storage, _ := newTestStorage(context.Background())
+
+	tooMany := map[string]string{}
+	for i := 0; i <= MaxTags; i++ {
+		tooMany[strings.Repeat("k", i+1)] = "v"
+	}
+
+	for _, tags := range []map[string]string{
+		tooMany,
+		{"": "v"},
+		{"k": ""},
+		{"a=b": "c"},
+		{"k": "with space"},
+		{"k": strings.Repeat("v", MaxTagSize+1)},
+	} {
+		_, err := storage.Create(10, SessionTags(tags))
+		c.Assert(err, Equals, ErrWrongTags, Commentf("%v", tags))
+	}
+	c.Assert(storage.Len(), Equals, 0)
+}
+
+func (s *testSuite) TestParseTagQuery(c *C) {
+	q, err := ParseTagQuery(" app=mobile  AND region=eu=west ")
+	c.Assert(err, IsNil)
+	c.Assert(q, DeepEquals, TagQuery{Tags: []string{"app=mobile", "region=eu=west"}})
+
+	for _, expr := range []string{"", "app", "app=", "=mobile", "app=mobile AND", "app=mobile OR region=eu", "app=mobile region=eu"} {
+		_, err = ParseTagQuery(expr)
+		c.Assert(err, Equals, ErrTagQuery, Commentf(expr))
+	}
+}
+
+func (s *testSuite) TestTagsRestore(c *C) {
+	path := filepath.Join(c.MkDir(), "sessions.wal")
+
+	storage := New(context.Background(), WithWAL(path, WALSyncAlways, 0))
+	id, _ := storage.Create(100, SessionTags(map[string]string{"app": "mobile"}))
+	c.Assert(storage.Close(), IsNil)
+
+	storage = New(context.Background(), WithWAL(path, WALSyncAlways, 0))
+	defer storage.Close()
+	c.Assert(taggedIDs(c, storage, "app=mobile", ""), DeepEquals, []string{id})
+}
@@ -0,0 +1,332 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+	Write-ahead log keeps all changes of sessions since the last snapshot.
+	Each record is (big endian):
+
+		operation (1 byte), session id (36 bytes), size of session (uint32),
+		session (see session.marshalBinary), CRC32 (IEEE) of the previous fields (uint32)
+
+	Records keep the whole session with absolute expiry, so replaying of the same record twice is harmless.
+	Snapshot rotates the log to "<path>.1" before collecting sessions and removes it after
+	the snapshot is saved. Replaying is: snapshot, "<path>.1" (if exists), "<path>".
+*/
+
+// WALSync is fsync policy of the write-ahead log.
+type WALSync int
+
+const (
+	// WALSyncAlways makes fsync after each record.
+	WALSyncAlways WALSync = iota
+	// WALSyncBatch makes fsync periodically.
+	WALSyncBatch
+	// WALSyncNever leaves flushing to the OS.
+	WALSyncNever
+)
+
+const (
+	walOpCreate = byte(1)
+	walOpExtend = byte(2)
+	walOpDelete = byte(3)
+	walOpData   = byte(4)
+
+	walHeaderSize   = 1 + 36 + 4
+	walTrailerSize  = 4
+	walOldSuffix    = ".1"
+	defaultWALBatch = 100 * time.Millisecond
+)
+
+var (
+	ErrWALSync   = errors.New("unknown WAL sync policy")
+	ErrWALClosed = errors.New("WAL is closed")
+)
+
+// ParseWALSync converts name of the policy ("always", "batch", "never") to WALSync.
+func ParseWALSync(name string) (WALSync, error) {
+	switch name {
+	case "always":
+		return WALSyncAlways, nil
+	case "batch":
+		return WALSyncBatch, nil
+	case "never":
+		return WALSyncNever, nil
+	}
+
+	return 0, ErrWALSync
+}
+
+type wal struct {
+	sync.Mutex
+
+	path     string
+	policy   WALSync
+	interval time.Duration
+	file     *os.File
+	dirty    bool
+	closed   bool
+}
+
+// walRecord is one change of session.
+type walRecord struct {
+	Op      byte
+	ID      string
+	Session *session // nil for delete
+}
+
+// openWAL opens the log for appending.
+func openWAL(path string, policy WALSync, interval time.Duration) (*wal, error) {
+	if interval <= 0 {
+		interval = defaultWALBatch
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wal{path: path, policy: policy, interval: interval, file: f}, nil
+}
+
+func encodeWALRecord(r walRecord) []byte {
+	var data []byte
+	if r.Session != nil {
+		data = r.Session.marshalBinary()
+	}
+
+	buf := make([]byte, walHeaderSize+len(data)+walTrailerSize)
+	buf[0] = r.Op
+	copy(buf[1:37], r.ID)
+	binary.BigEndian.PutUint32(buf[37:41], uint32(len(data)))
+	copy(buf[walHeaderSize:], data)
+
+	size := walHeaderSize + len(data)
+	binary.BigEndian.PutUint32(buf[size:], crc32.ChecksumIEEE(buf[:size]))
+
+	return buf
+}
+
+// readWAL returns all valid records and the size of valid data.
+// Reading stops on the first broken record (the tail written during crash).
+func readWAL(r io.Reader) ([]walRecord, int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	records := make([]walRecord, 0)
+	valid := int64(0)
+	for len(data) >= walHeaderSize+walTrailerSize {
+		size := walHeaderSize + int(binary.BigEndian.Uint32(data[37:41]))
+		if size+walTrailerSize > len(data) ||
+			crc32.ChecksumIEEE(data[:size]) != binary.BigEndian.Uint32(data[size:size+walTrailerSize]) {
+			break
+		}
+
+		record := walRecord{Op: data[0], ID: string(data[1:37])}
+		if size > walHeaderSize {
+			if record.Session, err = unmarshalSession(data[walHeaderSize:size]); err != nil {
+				break
+			}
+		}
+
+		records = append(records, record)
+		data = data[size+walTrailerSize:]
+		valid += int64(size + walTrailerSize)
+	}
+
+	return records, valid, nil
+}
+
+// append writes the record to the log. Nil wal does nothing.
+func (w *wal) append(op byte, id string, s *session) {
+	if w == nil {
+		return
+	}
+
+	record := encodeWALRecord(walRecord{Op: op, ID: id, Session: s})
+
+	w.Lock()
+	defer w.Unlock()
+
+	if w.closed {
+		return
+	}
+
+	if _, err := w.file.Write(record); err != nil {
+		logrus.Errorf("wal: %s", err.Error())
+
+		return
+	}
+
+	switch w.policy {
+	case WALSyncAlways:
+		if err := w.file.Sync(); err != nil {
+			logrus.Errorf("wal: %s", err.Error())
+		}
+	case WALSyncBatch:
+		w.dirty = true
+	}
+}
+
+// sync flushes the log to disk if something was written after the last flush.
+func (w *wal) sync() {
+	w.Lock()
+	defer w.Unlock()
+
+	if !w.dirty || w.closed {
+		return
+	}
+
+	w.dirty = false
+	if err := w.file.Sync(); err != nil {
+		logrus.Errorf("wal: %s", err.Error())
+	}
+}
+
+// syncer makes fsync for WALSyncBatch policy each interval and once more when the context is done.
+func (w *wal) syncer(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.sync()
+
+			return
+		case <-ticker.C:
+			w.sync()
+		}
+	}
+}
+
+// close flushes the log to disk and closes it. Next records are dropped.
+func (w *wal) close() error {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.closed {
+		return nil
+	}
+
+	w.closed = true
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+
+		return err
+	}
+
+	return w.file.Close()
+}
+
+// rotate moves the current log to "<path>.1" and starts a new one.
+// If "<path>.1" is still here (previous snapshot failed) the log is not rotated.
+func (w *wal) rotate() error {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.closed {
+		return ErrWALClosed
+	}
+
+	if _, err := os.Stat(w.path + walOldSuffix); err == nil {
+		return nil
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(w.path, w.path+walOldSuffix); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	w.file = f
+	w.dirty = false
+
+	return nil
+}
+
+// compact removes the log which is covered by the snapshot.
+func (w *wal) compact() error {
+	if err := os.Remove(w.path + walOldSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// replayWAL applies both logs ("<path>.1" and "<path>") to the storage.
+// Broken tail of the current log is truncated, so new records are appended after valid ones.
+func (s *Storage) replayWAL(path string) error {
+	for _, p := range []string{path + walOldSuffix, path} {
+		f, err := os.Open(p)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return err
+		}
+
+		records, valid, err := readWAL(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		s.applyWAL(records)
+
+		if info, err := os.Stat(p); err == nil && info.Size() != valid {
+			logrus.Errorf("wal %s: broken tail is truncated at %d", p, valid)
+			if err := os.Truncate(p, valid); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) applyWAL(records []walRecord) {
+	now := s.clock.Now().Unix()
+	for _, r := range records {
+		u, err := uuid.Parse(r.ID)
+		if err != nil {
+			continue
+		}
+
+		b := s.getBunches(u)
+		if r.Op == walOpDelete || r.Session == nil || r.Session.expiry <= now {
+			b.remove(r.ID)
+
+			continue
+		}
+
+		// each record keeps the whole session
+		b.set(r.ID, r.Session)
+	}
+}
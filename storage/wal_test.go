@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+
+	. "github.com/iostrovok/check"
+)
+
+// helper.
+func mustReadFile(c *C, path string) []byte {
+	data, err := os.ReadFile(path)
+	c.Assert(err, IsNil)
+
+	return data
+}
+
+func (s *testSuite) TestWALReadWrite(c *C) {
+	records := []walRecord{
+		{Op: walOpCreate, ID: uuid.New().String(), Session: &session{expiry: 100, data: []byte(`{"user":"bla"}`)}},
+		{Op: walOpDelete, ID: uuid.New().String()},
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	for _, r := range records {
+		buf.Write(encodeWALRecord(r))
+	}
+	full := buf.Len()
+
+	// broken tail
+	buf.WriteString("bla-bla")
+
+	out, valid, err := readWAL(buf)
+	c.Assert(err, IsNil)
+	c.Assert(out, DeepEquals, records)
+	c.Assert(valid, Equals, int64(full))
+}
+
+func (s *testSuite) TestParseWALSync(c *C) {
+	p, err := ParseWALSync("batch")
+	c.Assert(err, IsNil)
+	c.Assert(p, Equals, WALSyncBatch)
+
+	_, err = ParseWALSync("sometimes")
+	c.Assert(err, Equals, ErrWALSync)
+}
+
+func (s *testSuite) TestWALReplay(c *C) {
+	path := filepath.Join(c.MkDir(), "sessions.wal")
+
+	storage := New(context.Background(), WithWAL(path, WALSyncAlways, 0))
+	alive, _ := storage.Create(10, SessionData([]byte(`{"user":"bla"}`)))
+	destroyed, _ := storage.Create(10)
+	c.Assert(storage.Extend(alive, 100), Equals, true)
+	c.Assert(storage.Destroy(destroyed), Equals, true)
+	c.Assert(storage.MergeData(alive, []byte(`{"role":"admin"}`)), IsNil)
+
+	// crash during writing of the last record
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	c.Assert(err, IsNil)
+	_, err = f.Write([]byte{walOpCreate, 'x', 'y'})
+	c.Assert(err, IsNil)
+	c.Assert(f.Close(), IsNil)
+
+	restored := New(context.Background(), WithWAL(path, WALSyncAlways, 0))
+	session, find := restored.Get(alive)
+	c.Assert(find, Equals, true)
+	c.Assert(session.TTL > 10, Equals, true)
+	c.Assert(string(session.Data), Equals, `{"role":"admin","user":"bla"}`)
+
+	_, find = restored.Get(destroyed)
+	c.Assert(find, Equals, false)
+
+	// broken tail is truncated
+	_, valid, err := readWAL(bytes.NewReader(mustReadFile(c, path)))
+	c.Assert(err, IsNil)
+	info, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Assert(info.Size(), Equals, valid)
+}
+
+func (s *testSuite) TestWALCompaction(c *C) {
+	dir := c.MkDir()
+	walPath := filepath.Join(dir, "sessions.wal")
+	snapshotPath := filepath.Join(dir, "sessions.snapshot")
+
+	storage := New(context.Background(), WithSnapshot(snapshotPath, 0), WithWAL(walPath, WALSyncNever, 0))
+	before, _ := storage.Create(30)
+	c.Assert(storage.Snapshot(), IsNil)
+
+	// log is empty after the snapshot
+	info, err := os.Stat(walPath)
+	c.Assert(err, IsNil)
+	c.Assert(info.Size(), Equals, int64(0))
+	_, err = os.Stat(walPath + walOldSuffix)
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	after, _ := storage.Create(30)
+	c.Assert(storage.Destroy(before), Equals, true)
+
+	restored := New(context.Background(), WithSnapshot(snapshotPath, 0), WithWAL(walPath, WALSyncNever, 0))
+	_, find := restored.Get(before)
+	c.Assert(find, Equals, false)
+	_, find = restored.Get(after)
+	c.Assert(find, Equals, true)
+}
+
+func (s *testSuite) TestStorageClose(c *C) {
+	dir := c.MkDir()
+	snapshotPath := filepath.Join(dir, "sessions.snapshot")
+	walPath := filepath.Join(dir, "sessions.wal")
+
+	storage := New(context.Background(), WithSnapshot(snapshotPath, 0), WithWAL(walPath, WALSyncNever, 0))
+	id, _ := storage.Create(30)
+	c.Assert(storage.Close(), IsNil)
+	c.Assert(storage.Close(), IsNil)
+
+	// cleaners are stopped
+	for i := uint32(0); i < storage.CountBunches; i++ {
+		_, open := <-storage.Bunches[i].done
+		c.Assert(open, Equals, false)
+	}
+
+	// changes after Close are not written
+	_, _ = storage.Create(30)
+
+	// the final snapshot keeps the session and covers the log
+	records, err := readSnapshot(bytes.NewReader(mustReadFile(c, snapshotPath)))
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+	c.Assert(records[0].ID, Equals, id)
+	c.Assert(mustReadFile(c, walPath), HasLen, 0)
+}